@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <file>",
+	Short: "Backs the database up to a file",
+	Long: `Writes a consistent copy of the database to file. It is safe to run while the
+server is serving requests.`,
+	Args: cobra.ExactArgs(1),
+	RunE: doBackup,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Restores the database from a backup",
+	Long: `Replaces the database with the backup in file, after checking that it is an
+intact todolist database whose schema this build supports. Backups with an
+older schema are migrated when the database is next opened. Restoring is
+refused while the database is in use, but stop the server first all the same,
+as it would otherwise go on using the database that was replaced.`,
+	Args: cobra.ExactArgs(1),
+	RunE: doRestore,
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func doBackup(cmd *cobra.Command, args []string) error {
+	tododb, err := openDb()
+	if err != nil {
+		return err
+	}
+	defer tododb.Close()
+
+	if err := sqlitedb.Backup(context.Background(), tododb, args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "backed up to %s\n", args[0])
+	return nil
+}
+
+func doRestore(cmd *cobra.Command, args []string) error {
+	if cfg.DB.DSN != "" {
+		return fmt.Errorf("restore needs the database file, given with db.path rather than db.dsn")
+	}
+	path := cfg.DB.Path
+	if path == "" {
+		var err error
+		if path, err = sqlitedb.DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	version, err := sqlitedb.Restore(args[0], path)
+	if errors.Is(err, sqlitedb.ErrDatabaseInUse) {
+		return fmt.Errorf("%w; stop the server before restoring", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "restored %s from %s (schema version %d)\n", path, args[0], version)
+	return nil
+}
+
+// serveSnapshot streams a consistent copy of the database, for taking
+// backups over the admin listener.
+func serveSnapshot(db *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.sqlite3")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+sqlitedb.BackupName(time.Now())+`"`)
+		// nothing is written until the copy is complete, so failures can
+		// still be reported
+		if err := sqlitedb.Snapshot(r.Context(), db, w); err != nil {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("Backup tests", func() {
+	var dir, path string
+	var tododb *sqlx.DB
+	ctx := context.Background()
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		// the database is named in the environment, as cobra keeps flags
+		// parsed by earlier commands
+		GinkgoT().Setenv("TODOLIST_DB_PATH", path)
+		rootCmd.SetArgs(args)
+		err := rootCmd.Execute()
+		return out.String(), err
+	}
+
+	add := func(db *sqlx.DB, id string) {
+		service := todolist.NewItemsService(store.NewSqlStore(db))
+		Expect(service.AddItem(ctx, &structs.TodoItem{Id: id, Item: "Item " + id, Priority: 1})).To(Succeed())
+	}
+
+	count := func(path string) int {
+		db, err := sqlitedb.OpenDb(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		items, err := todolist.NewItemsService(store.NewSqlStore(db)).ListItems(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		return items.Count
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		path = filepath.Join(dir, "todolist.db")
+		var err error
+		tododb, err = sqlitedb.OpenDb(path)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+		add(tododb, "a")
+	})
+
+	Specify("Backups taken while the database is open can be restored", func() {
+		backup := filepath.Join(dir, "backup.db")
+		out, err := run("backup", backup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("backed up to " + backup))
+
+		add(tododb, "b")
+		Expect(count(path)).To(Equal(2))
+		Expect(tododb.Close()).To(Succeed())
+
+		out, err = run("restore", backup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("restored " + path))
+		Expect(count(path)).To(Equal(1))
+	})
+
+	Specify("Databases in use are not restored", func() {
+		backup := filepath.Join(dir, "backup.db")
+		Expect(sqlitedb.Backup(ctx, tododb, backup)).To(Succeed())
+		add(tododb, "b")
+
+		tx, err := tododb.Beginx()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = run("restore", backup)
+		Expect(err).To(MatchError(sqlitedb.ErrDatabaseInUse))
+		Expect(err).To(MatchError(ContainSubstring("stop the server")))
+		Expect(tx.Rollback()).To(Succeed())
+		Expect(count(path)).To(Equal(2))
+
+		Expect(tododb.Close()).To(Succeed())
+		_, err = run("restore", backup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count(path)).To(Equal(1))
+	})
+
+	Specify("Only intact backups with a supported schema are restored", func() {
+		backup := filepath.Join(dir, "backup.db")
+		Expect(sqlitedb.Backup(ctx, tododb, backup)).To(Succeed())
+		newer, err := sqlx.Connect("sqlite3", "file:"+backup)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = newer.Exec("PRAGMA user_version = 99")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newer.Close()).To(Succeed())
+
+		_, err = run("restore", backup)
+		Expect(err).To(MatchError(ContainSubstring("has schema version 99, newer than supported")))
+
+		notes := filepath.Join(dir, "notes.txt")
+		Expect(os.WriteFile(notes, []byte("wash car"), 0o644)).To(Succeed())
+		_, err = run("restore", notes)
+		Expect(err).To(HaveOccurred())
+
+		_, err = run("restore", filepath.Join(dir, "missing.db"))
+		Expect(err).To(HaveOccurred())
+		Expect(count(path)).To(Equal(1))
+	})
+
+	Specify("Snapshots of the database are streamed", func() {
+		w := httptest.NewRecorder()
+		serveSnapshot(tododb)(w, httptest.NewRequest(http.MethodGet, "/backup", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/vnd.sqlite3"))
+		Expect(w.Header().Get("Content-Disposition")).To(MatchRegexp(`attachment; filename="todolist-\d{8}T\d{6}Z\.db"`))
+
+		snapshot := filepath.Join(dir, "snapshot.db")
+		Expect(os.WriteFile(snapshot, w.Body.Bytes(), 0o644)).To(Succeed())
+		Expect(sqlitedb.CheckBackup(snapshot)).To(Equal(sqlitedb.SchemaVersion()))
+		Expect(count(snapshot)).To(Equal(1))
+	})
+
+	Specify("Scheduled backups keep the most recent", func() {
+		backups := &sqlitedb.Backups{DB: tododb, Dir: filepath.Join(dir, "backups"), Keep: 2}
+		start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		var taken []string
+		for i := 0; i < 3; i++ {
+			path, err := backups.Backup(ctx, start.Add(time.Duration(i)*time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			taken = append(taken, path)
+		}
+		Expect(taken[0]).To(HaveSuffix("todolist-20240501T120000Z.db"))
+
+		// other files in the directory are left alone
+		Expect(os.WriteFile(filepath.Join(backups.Dir, "README"), nil, 0o644)).To(Succeed())
+		kept, err := backups.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kept).To(Equal(taken[1:]))
+		Expect(filepath.Join(backups.Dir, "README")).To(BeAnExistingFile())
+	})
+})
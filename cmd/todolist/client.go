@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.altair.com/todolist/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	serverEnvVar  = "TODOLIST_SERVER"
+	defaultServer = "http://localhost:8080"
+)
+
+var (
+	serverURL    string
+	outputFormat string
+)
+
+// addClientFlags registers the flags shared by the subcommands that talk to
+// a running server.
+func addClientFlags(cmd *cobra.Command) {
+	server := os.Getenv(serverEnvVar)
+	if server == "" {
+		server = defaultServer
+	}
+	cmd.Flags().StringVarP(&serverURL, "server", "s", server, "todolist server URL (env "+serverEnvVar+")")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format: table, json or plain")
+}
+
+func newAPIClient() *client.Client {
+	return client.New(serverURL)
+}
+
+// resolveId accepts either a full item id or a unique prefix of one, so
+// that ids copied from the table output can be shortened.
+func resolveId(ctx context.Context, c *client.Client, prefix string) (string, error) {
+	_, err := c.GetItem(ctx, prefix)
+	if err == nil {
+		return prefix, nil
+	}
+	if !errors.Is(err, client.ErrNotFound) {
+		return "", err
+	}
+
+	items, err := c.ListItems(ctx)
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	for _, item := range items.Items {
+		if strings.HasPrefix(item.Id, prefix) {
+			matches = append(matches, item.Id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no item with id %q", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("id %q is ambiguous: matches %s", prefix, strings.Join(matches, ", "))
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Shows the server configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Prints the effective configuration",
+	Long: `Prints the configuration after layering the defaults, the configuration file,
+TODOLIST_* environment variables and flags, in that order.`,
+	Args: cobra.NoArgs,
+	RunE: doConfigPrint,
+}
+
+var (
+	configFormat string
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPrintCmd)
+	configPrintCmd.Flags().StringVarP(&configFormat, "format", "f", "yaml", "output format: yaml or toml")
+}
+
+func doConfigPrint(cmd *cobra.Command, args []string) error {
+	return cfg.Print(cmd.OutOrStdout(), configFormat)
+}
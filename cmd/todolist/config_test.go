@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"go.altair.com/todolist/pkg/config"
+)
+
+var _ = Describe("config command tests", func() {
+	AfterEach(func() {
+		configPath = ""
+		flag := rootCmd.PersistentFlags().Lookup("log-format")
+		Expect(flag.Value.Set(config.Defaults().Log.Format)).To(Succeed())
+		flag.Changed = false
+		cfg = config.Defaults()
+	})
+
+	Specify("Flags override the environment, which overrides the file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "todolist.yaml")
+		Expect(os.WriteFile(file, []byte("log:\n  format: console\nserver:\n  bind: 127.0.0.1:1\n  grpc_bind: 127.0.0.1:2\n"), 0o644)).To(Succeed())
+		GinkgoT().Setenv("TODOLIST_SERVER_BIND", "127.0.0.1:3")
+		GinkgoT().Setenv("TODOLIST_LOG_FORMAT", "console")
+
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetArgs([]string{"--config", file, "--log-format", "json", "config", "print"})
+		Expect(rootCmd.Execute()).To(Succeed())
+
+		var printed config.Config
+		Expect(yaml.Unmarshal(out.Bytes(), &printed)).To(Succeed())
+		Expect(printed.Server.Bind).To(Equal("127.0.0.1:3"))
+		Expect(printed.Server.GRPCBind).To(Equal("127.0.0.1:2"))
+		Expect(printed.Log.Format).To(Equal("json"))
+		Expect(printed.Server.RequestTimeout).To(Equal(config.Defaults().Server.RequestTimeout))
+	})
+
+	Specify("The item quota is set for clients with certificates only", func() {
+		flag := serveCmd.Flags().Lookup("items-per-user")
+		DeferCleanup(func() {
+			Expect(flag.Value.Set("0")).To(Succeed())
+			flag.Changed = false
+		})
+		Expect(flag.Usage).To(ContainSubstring("clients without certificates are not capped"))
+
+		Expect(serveCmd.Flags().Set("items-per-user", "2")).To(Succeed())
+		c, err := loadConfig(serveCmd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Limits.ItemsPerUser).To(Equal(2))
+	})
+})
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.altair.com/todolist/pkg/config"
+)
+
+// corsPolicy answers cross-origin requests from browsers according to the
+// configured policy. Preflight requests are answered here, and refused with
+// 403 if the origin, method or any header is not allowed; other requests
+// pass through, with CORS headers only if their origin is allowed.
+type corsPolicy struct {
+	config.CORS
+	anyOrigin, anyHeader bool
+}
+
+func newCORSPolicy(c config.CORS) *corsPolicy {
+	p := &corsPolicy{CORS: c}
+	for _, origin := range c.AllowedOrigins {
+		p.anyOrigin = p.anyOrigin || origin == "*"
+	}
+	for _, header := range c.AllowedHeaders {
+		p.anyHeader = p.anyHeader || header == "*"
+	}
+	return p
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// nothing if it is not allowed.
+func (p *corsPolicy) allowOrigin(origin string) string {
+	if p.anyOrigin && !p.AllowCredentials {
+		return "*"
+	}
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return origin
+		}
+		// https://*.todo.example matches https://app.todo.example but not
+		// https://todo.example
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok {
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) &&
+				!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+				return origin
+			}
+		}
+	}
+	return ""
+}
+
+// varies reports whether responses depend on the Origin header.
+func (p *corsPolicy) varies() bool {
+	return !p.anyOrigin || p.AllowCredentials
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodPost {
+		// CORS-safelisted methods are always allowed
+		return true
+	}
+	for _, allowed := range p.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		allowed := false
+		for _, h := range p.AllowedHeaders {
+			if strings.EqualFold(h, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *corsPolicy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if p.varies() {
+			w.Header().Add("Vary", "Origin")
+		}
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed := p.allowOrigin(origin)
+
+		if !preflight {
+			if allowed != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				if p.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				if len(p.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if allowed == "" || !p.allowMethod(r.Header.Get("Access-Control-Request-Method")) || !p.allowHeaders(requestedHeaders) {
+			http.Error(w, "cross-origin request not allowed", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if p.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+		if p.anyHeader {
+			// echo the request, as * is not a wildcard when credentials are
+			// allowed
+			w.Header().Set("Access-Control-Allow-Headers", requestedHeaders)
+		} else if len(p.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
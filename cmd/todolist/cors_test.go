@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.altair.com/todolist/pkg/config"
+)
+
+var _ = Describe("CORS tests", func() {
+	restricted := func() config.CORS {
+		c := config.Defaults().CORS
+		c.AllowedOrigins = []string{"https://todo.example", "https://*.todo.example"}
+		c.AllowCredentials = true
+		return c
+	}
+
+	// serve passes the request through the policy to a handler answering
+	// with 200 OK.
+	serve := func(c config.CORS, req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		newCORSPolicy(c).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Handled", "yes")
+		})).ServeHTTP(w, req)
+		return w
+	}
+
+	DescribeTable("Requests get CORS headers for allowed origins",
+		func(c config.CORS, origin, allowOrigin string, vary []string) {
+			req := httptest.NewRequest(http.MethodGet, "/todolist/", nil)
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			w := serve(c, req)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("X-Handled")).To(Equal("yes"))
+			Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal(allowOrigin))
+			Expect(w.Header().Values("Vary")).To(Equal(vary))
+			if allowOrigin != "" {
+				Expect(w.Header().Get("Access-Control-Expose-Headers")).To(Equal("ETag"))
+			} else {
+				Expect(w.Header().Get("Access-Control-Expose-Headers")).To(BeEmpty())
+			}
+		},
+		Entry("any origin by default", config.Defaults().CORS, "https://elsewhere.example", "*", nil),
+		Entry("no origin", restricted(), "", "", []string{"Origin"}),
+		Entry("an exact origin", restricted(), "https://todo.example", "https://todo.example", []string{"Origin"}),
+		Entry("a subdomain", restricted(), "https://app.todo.example", "https://app.todo.example", []string{"Origin"}),
+		Entry("a nested subdomain", restricted(), "https://eu.app.todo.example", "https://eu.app.todo.example", []string{"Origin"}),
+		Entry("another scheme", restricted(), "http://app.todo.example", "", []string{"Origin"}),
+		Entry("a lookalike domain", restricted(), "https://apptodo.example", "", []string{"Origin"}),
+		Entry("another port", restricted(), "https://app.todo.example:8443", "", []string{"Origin"}),
+		Entry("another origin", restricted(), "https://elsewhere.example", "", []string{"Origin"}),
+	)
+
+	Specify("Credentials are allowed only when configured", func() {
+		req := httptest.NewRequest(http.MethodGet, "/todolist/", nil)
+		req.Header.Set("Origin", "https://todo.example")
+		Expect(serve(restricted(), req).Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+		Expect(serve(config.Defaults().CORS, req).Header().Get("Access-Control-Allow-Credentials")).To(BeEmpty())
+	})
+
+	preflight := func(origin, method, headers string) *http.Request {
+		req := httptest.NewRequest(http.MethodOptions, "/todolist/item/1", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		if headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", headers)
+		}
+		return req
+	}
+
+	Specify("Allowed preflights are answered", func() {
+		w := serve(restricted(), preflight("https://app.todo.example", http.MethodPut, "content-type, authorization"))
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		Expect(w.Header().Get("X-Handled")).To(BeEmpty())
+		Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://app.todo.example"))
+		Expect(w.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+		Expect(w.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET, POST, PUT, DELETE"))
+		Expect(w.Header().Get("Access-Control-Allow-Headers")).To(Equal("Content-Type, Authorization"))
+		Expect(w.Header().Get("Access-Control-Max-Age")).To(Equal("600"))
+		Expect(w.Header().Values("Vary")).To(Equal([]string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}))
+	})
+
+	Specify("Any requested header is echoed when all are allowed", func() {
+		c := restricted()
+		c.AllowedHeaders = []string{"*"}
+		c.MaxAge = 0
+		w := serve(c, preflight("https://todo.example", http.MethodDelete, "X-Custom"))
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		Expect(w.Header().Get("Access-Control-Allow-Headers")).To(Equal("X-Custom"))
+		Expect(w.Header().Get("Access-Control-Max-Age")).To(BeEmpty())
+	})
+
+	DescribeTable("Disallowed preflights are rejected",
+		func(c config.CORS, req *http.Request) {
+			w := serve(c, req)
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			Expect(w.Header().Get("X-Handled")).To(BeEmpty())
+			Expect(w.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+			Expect(w.Header().Get("Access-Control-Allow-Methods")).To(BeEmpty())
+		},
+		Entry("from another origin", restricted(), preflight("https://elsewhere.example", http.MethodPut, "")),
+		Entry("for another method", restricted(), preflight("https://todo.example", http.MethodPatch, "")),
+		Entry("with another header", restricted(), preflight("https://todo.example", http.MethodPut, "Content-Type, X-Custom")),
+	)
+
+	Specify("Other OPTIONS requests reach the router", func() {
+		req := httptest.NewRequest(http.MethodOptions, "/todolist/", nil)
+		req.Header.Set("Origin", "https://todo.example")
+		w := serve(restricted(), req)
+		Expect(w.Header().Get("X-Handled")).To(Equal("yes"))
+		Expect(w.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://todo.example"))
+	})
+
+	Specify("The router applies the configured policy", func() {
+		cfg.CORS = restricted()
+		cfg.CORS.MaxAge = time.Hour
+		DeferCleanup(func() {
+			cfg = config.Defaults()
+		})
+		router := newRouter()
+		router.Put("/todolist/item/{id}", func(http.ResponseWriter, *http.Request) {})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, preflight("https://todo.example", http.MethodPut, ""))
+		Expect(w.Code).To(Equal(http.StatusNoContent))
+		Expect(w.Header().Get("Access-Control-Max-Age")).To(Equal("3600"))
+	})
+})
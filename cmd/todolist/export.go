@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Exports the todo list from the database",
+	Long: `Writes every item in the database to file, or to stdout if no file is given.
+The format is taken from --format, or else from the file extension.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: doExport,
+}
+
+var (
+	exportFormat string
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "", "export format: json, csv, markdown, ics or todotxt")
+}
+
+// transferFormat resolves the format for export and import, preferring an
+// explicit name over the extension of path.
+func transferFormat(name string, path string) (*todolist.ItemsFormat, error) {
+	if name == "" {
+		if f, ok := todolist.FormatForFile(path); ok {
+			return f, nil
+		}
+		name = todolist.FormatJSON
+	}
+	return todolist.LookupFormat(name)
+}
+
+func doExport(cmd *cobra.Command, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	format, err := transferFormat(exportFormat, path)
+	if err != nil {
+		return err
+	}
+
+	tododb, err := openDb()
+	if err != nil {
+		return err
+	}
+	defer tododb.Close()
+
+	todoService := todolist.NewItemsService(store.NewSqlStore(tododb))
+	items, err := todoService.ListItems(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = cmd.OutOrStdout()
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return format.Encode(out, items.Items)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"go.altair.com/todolist/pkg/todolist"
+)
+
+// grpcMiddleware wraps a gRPC call, unary or streaming, as HTTP middleware
+// wraps a handler. It calls next to carry on with the call, passing the
+// context the call is to have.
+type grpcMiddleware func(ctx context.Context, method string, next func(ctx context.Context) error) error
+
+// newGRPCServer makes a server whose calls go through the same middleware as
+// HTTP requests do in newRouter: they are counted, traced and logged, and
+// the client is identified and rate limited. Calls are served over TLS if
+// tlsConfig is given.
+func newGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	var middleware []grpcMiddleware
+	if cfg.Features.Metrics {
+		middleware = append(middleware, instrumentGRPC)
+	}
+	middleware = append(middleware, traceGRPC, logGRPC, identifyGRPCClient, newRateLimiter(cfg.Limits).GRPC)
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryInterceptor(middleware)),
+		grpc.StreamInterceptor(streamInterceptor(middleware)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	return grpc.NewServer(opts...)
+}
+
+// runGRPC runs call through middleware, outermost first.
+func runGRPC(ctx context.Context, method string, middleware []grpcMiddleware, call func(ctx context.Context) error) error {
+	if len(middleware) == 0 {
+		return call(ctx)
+	}
+	return middleware[0](ctx, method, func(ctx context.Context) error {
+		return runGRPC(ctx, method, middleware[1:], call)
+	})
+}
+
+func unaryInterceptor(middleware []grpcMiddleware) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var resp any
+		err := runGRPC(ctx, info.FullMethod, middleware, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+func streamInterceptor(middleware []grpcMiddleware) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return runGRPC(ss.Context(), info.FullMethod, middleware, func(ctx context.Context) error {
+			return handler(srv, contextStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+// contextStream is a stream whose context has been replaced by middleware.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// identifyGRPCClient is the gRPC counterpart of todolist.IdentifyClient.
+func identifyGRPCClient(ctx context.Context, method string, next func(ctx context.Context) error) error {
+	return next(todolist.WithPeerIdentity(ctx))
+}
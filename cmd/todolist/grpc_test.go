@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go.altair.com/todolist/pkg/config"
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+	"go.altair.com/todolist/pkg/todolistpb"
+)
+
+var _ = Describe("gRPC middleware tests", func() {
+	var ca *testCA
+	var addr string
+	ctx := context.Background()
+
+	// serve serves gRPC over mutual TLS, with clients' certificates
+	// optional, and items capped at one per client.
+	serve := func() {
+		dir := GinkgoT().TempDir()
+		ca = newTestCA()
+		certPEM, keyPEM := ca.issue("server one")
+		tlsSettings := config.Defaults().TLS
+		tlsSettings.Cert = filepath.Join(dir, "server.crt")
+		tlsSettings.Key = filepath.Join(dir, "server.key")
+		tlsSettings.ClientCA = filepath.Join(dir, "clients.crt")
+		tlsSettings.ClientAuth = "optional"
+		Expect(os.WriteFile(tlsSettings.Cert, certPEM, 0o600)).To(Succeed())
+		Expect(os.WriteFile(tlsSettings.Key, keyPEM, 0o600)).To(Succeed())
+		Expect(os.WriteFile(tlsSettings.ClientCA, ca.pem, 0o600)).To(Succeed())
+		tlsConfig, err := newTLSConfig(tlsSettings)
+		Expect(err).NotTo(HaveOccurred())
+
+		tododb, err := sqlitedb.OpenDb(filepath.Join(dir, "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+		todoService := todolist.NewItemsService(store.NewSqlStore(tododb), todolist.WithItemQuota(1))
+
+		server := newGRPCServer(tlsConfig)
+		(&todolist.GRPCServer{ItemsService: todoService, Events: todolist.NewBroker()}).Register(server)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		addr = listener.Addr().String()
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		DeferCleanup(server.Stop)
+	}
+
+	// client makes a client trusting the test CA, presenting a certificate
+	// for name if one is given.
+	client := func(name string) todolistpb.TodolistClient {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		tlsConfig := &tls.Config{RootCAs: pool}
+		if name != "" {
+			certPEM, keyPEM := ca.issue(name)
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			Expect(err).NotTo(HaveOccurred())
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+		return todolistpb.NewTodolistClient(conn)
+	}
+
+	add := func(c todolistpb.TodolistClient, opts ...grpc.CallOption) error {
+		_, err := c.AddItem(ctx, &todolistpb.AddItemRequest{Item: &todolistpb.TodoItem{Id: structs.NewItemId(), Item: "Wash car", Priority: 1}}, opts...)
+		return err
+	}
+
+	BeforeEach(func() {
+		DeferCleanup(func() {
+			cfg = config.Defaults()
+		})
+		cfg.Limits = config.Limits{}
+	})
+
+	Specify("Clients with certificates are held to their quota", func() {
+		serve()
+		alice := client("alice")
+		Expect(add(alice)).To(Succeed())
+		err := add(alice)
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		Expect(status.Convert(err).Message()).To(ContainSubstring("quota"))
+
+		Expect(add(client("bob"))).To(Succeed())
+		// clients without certificates are not limited
+		anonymous := client("")
+		Expect(add(anonymous)).To(Succeed())
+		Expect(add(anonymous)).To(Succeed())
+	})
+
+	Specify("Clients are rate limited", func() {
+		cfg.Limits = config.Limits{WritesPerMinute: 6, WriteBurst: 1}
+		serve()
+		alice := client("alice")
+		Expect(add(alice)).To(Succeed())
+		err := add(alice)
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		details := status.Convert(err).Details()
+		Expect(details).To(HaveLen(1))
+		Expect(details[0].(*errdetails.RetryInfo).RetryDelay.AsDuration().Seconds()).To(BeNumerically("~", 10, 0.1))
+
+		// reads have a bucket of their own, and other clients their own
+		_, err = alice.ListItems(ctx, &todolistpb.ListItemsRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(add(client("bob"))).To(Succeed())
+	})
+
+	Specify("Calls are counted and given request ids", func() {
+		cfg.Features.Metrics = true
+		serve()
+		c := client("")
+		method := todolistpb.Todolist_AddItem_FullMethodName
+		before := testutil.ToFloat64(grpcRequests.WithLabelValues(method, "OK"))
+
+		var header metadata.MD
+		Expect(add(c, grpc.Header(&header))).To(Succeed())
+		Expect(header.Get(requestIdHeader)).To(ConsistOf(MatchRegexp(`^[0-9a-f]{24}$`)))
+
+		ctx := metadata.AppendToOutgoingContext(ctx, requestIdHeader, "caller-1")
+		_, err := c.AddItem(ctx, &todolistpb.AddItemRequest{Item: &todolistpb.TodoItem{Id: structs.NewItemId(), Item: "Fix bike", Priority: 1}}, grpc.Header(&header))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Get(requestIdHeader)).To(Equal([]string{"caller-1"}))
+		Expect(testutil.ToFloat64(grpcRequests.WithLabelValues(method, "OK"))).To(Equal(before + 2))
+	})
+})
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+
+	"go.altair.com/todolist/pkg/config"
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// readyTimeout bounds the checks made for /readyz, so that a stuck database
+// fails the probe rather than hanging it.
+const readyTimeout = 2 * time.Second
+
+// health serves the endpoints an orchestrator probes, and diagnostics.
+type health struct {
+	store   store.Store
+	db      *sqlx.DB
+	started time.Time
+
+	mu      sync.Mutex
+	workers map[string]bool
+}
+
+func newHealth(s store.Store, db *sqlx.DB) *health {
+	return &health{store: s, db: db, started: time.Now(), workers: map[string]bool{}}
+}
+
+// running records that the named background worker is running, until the
+// returned function is called once it stops.
+func (h *health) running(name string) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.workers[name] = true
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.workers[name] = false
+	}
+}
+
+// stoppedWorkers lists the workers that are no longer running.
+func (h *health) stoppedWorkers() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var stopped []string
+	for name, running := range h.workers {
+		if !running {
+			stopped = append(stopped, name)
+		}
+	}
+	sort.Strings(stopped)
+	return stopped
+}
+
+// ConfigureRoutes serves /healthz and /readyz.
+func (h *health) ConfigureRoutes(router chi.Router) {
+	router.Get("/healthz", h.live)
+	router.Get("/readyz", h.ready)
+}
+
+// ConfigureDebugRoutes serves /debug/info, and the profiles under
+// /debug/pprof/ with the pprof feature. They tell more about the server than
+// clients need to know, so are only served on the admin listener.
+func (h *health) ConfigureDebugRoutes(router chi.Router) {
+	router.Get("/debug/info", h.info)
+	if cfg.Features.Pprof {
+		router.HandleFunc("/debug/pprof/*", pprof.Index)
+		router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+}
+
+// live answers as long as the process can serve requests at all.
+func (h *health) live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// ready reports whether requests can be served: the database answers, its
+// schema is the one this build expects and the background workers run.
+func (h *health) ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	result := readiness{Status: "ready", Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err != nil {
+			result.Status = "unready"
+			result.Checks[name] = err.Error()
+			return
+		}
+		result.Checks[name] = "ok"
+	}
+
+	check("database", h.store.Ping(ctx))
+	check("migrations", h.checkSchema())
+	var err error
+	if stopped := h.stoppedWorkers(); len(stopped) > 0 {
+		err = fmt.Errorf("stopped: %v", stopped)
+	}
+	check("workers", err)
+
+	code := http.StatusOK
+	if result.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, result)
+}
+
+func (h *health) checkSchema() error {
+	version, err := sqlitedb.Version(h.db)
+	if err != nil {
+		return err
+	}
+	if version != sqlitedb.SchemaVersion() {
+		return fmt.Errorf("schema version %d, expected %d", version, sqlitedb.SchemaVersion())
+	}
+	return nil
+}
+
+// configSummary is the part of the configuration shown in /debug/info,
+// leaving out anything that could hold credentials such as the DSN.
+type configSummary struct {
+	Bind      string          `json:"bind"`
+	GRPCBind  string          `json:"grpc_bind"`
+	AdminBind string          `json:"admin_bind"`
+	TLS       bool            `json:"tls"`
+	MutualTLS bool            `json:"mutual_tls"`
+	DBDriver  string          `json:"db_driver"`
+	Backup    config.Backup   `json:"backup"`
+	LogLevel  string          `json:"log_level"`
+	Tracing   string          `json:"tracing"`
+	Limits    config.Limits   `json:"limits"`
+	Features  config.Features `json:"features"`
+}
+
+type debugInfo struct {
+	buildInfo
+	Started       time.Time     `json:"started"`
+	SchemaVersion int           `json:"schema_version"`
+	Config        configSummary `json:"config"`
+}
+
+// info describes the build and how the server was configured.
+func (h *health) info(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, debugInfo{
+		buildInfo:     readBuildInfo(),
+		Started:       h.started,
+		SchemaVersion: sqlitedb.SchemaVersion(),
+		Config: configSummary{
+			Bind:      cfg.Server.Bind,
+			GRPCBind:  cfg.Server.GRPCBind,
+			AdminBind: cfg.Server.AdminBind,
+			TLS:       cfg.TLS.Enabled(),
+			MutualTLS: cfg.TLS.ClientCA != "",
+			DBDriver:  cfg.DB.Driver,
+			Backup:    cfg.Backup,
+			LogLevel:  cfg.Log.Level,
+			Tracing:   cfg.Tracing.Exporter,
+			Limits:    cfg.Limits,
+			Features:  cfg.Features,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
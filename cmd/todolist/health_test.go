@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.altair.com/todolist/pkg/config"
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("Health tests", func() {
+	var tododb *sqlx.DB
+	var probes *health
+
+	BeforeEach(func() {
+		var err error
+		tododb, err = sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+		probes = newHealth(store.NewSqlStore(tododb), tododb)
+		DeferCleanup(func() {
+			cfg = config.Defaults()
+		})
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		router := chi.NewRouter()
+		probes.ConfigureRoutes(router)
+		probes.ConfigureDebugRoutes(router)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	readiness := func() (int, map[string]string) {
+		w := get("/readyz")
+		var result struct {
+			Status string
+			Checks map[string]string
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&result)).To(Succeed())
+		Expect(result.Status).To(Equal(map[bool]string{true: "ready", false: "unready"}[w.Code == http.StatusOK]))
+		return w.Code, result.Checks
+	}
+
+	Specify("The server is alive while it can answer", func() {
+		w := get("/healthz")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("ok\n"))
+	})
+
+	Specify("The server is ready with its database and workers", func() {
+		stopped := probes.running("outbox relay")
+		code, checks := readiness()
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(checks).To(Equal(map[string]string{"database": "ok", "migrations": "ok", "workers": "ok"}))
+
+		stopped()
+		code, checks = readiness()
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(checks).To(HaveKeyWithValue("workers", "stopped: [outbox relay]"))
+	})
+
+	Specify("The server is not ready with an old schema", func() {
+		_, err := tododb.Exec("PRAGMA user_version = 1")
+		Expect(err).NotTo(HaveOccurred())
+		code, checks := readiness()
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(checks).To(HaveKeyWithValue("migrations", ContainSubstring("schema version 1")))
+		Expect(checks).To(HaveKeyWithValue("database", "ok"))
+	})
+
+	Specify("The server is not ready without its database", func() {
+		Expect(tododb.Close()).To(Succeed())
+		code, checks := readiness()
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(checks).To(HaveKeyWithValue("database", ContainSubstring("closed")))
+	})
+
+	Specify("Diagnostics describe the build and configuration", func() {
+		cfg.DB.DSN = "file:secret.db?_auth_pass=hunter2"
+		w := get("/debug/info")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).NotTo(ContainSubstring("hunter2"))
+
+		var info map[string]interface{}
+		Expect(json.NewDecoder(w.Body).Decode(&info)).To(Succeed())
+		Expect(info).To(HaveKeyWithValue("version", "dev"))
+		Expect(info).To(HaveKey("commit"))
+		Expect(info).To(HaveKey("build_time"))
+		Expect(info).To(HaveKeyWithValue("schema_version", BeNumerically("==", sqlitedb.SchemaVersion())))
+		Expect(info).To(HaveKeyWithValue("config", HaveKeyWithValue("bind", cfg.Server.Bind)))
+	})
+
+	Specify("Diagnostics and snapshots are only served on the admin listener", func() {
+		serve := func(router *chi.Mux, path string) int {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			return w.Code
+		}
+
+		cfg.Features.Pprof = true
+		api, admin := newAdminRouter(chi.NewRouter(), probes, tododb)
+		Expect(admin).To(BeNil())
+		Expect(serve(api, "/healthz")).To(Equal(http.StatusOK))
+		Expect(serve(api, "/debug/info")).To(Equal(http.StatusNotFound))
+		Expect(serve(api, "/debug/pprof/")).To(Equal(http.StatusNotFound))
+		Expect(serve(api, "/backup")).To(Equal(http.StatusNotFound))
+
+		cfg.Server.AdminBind = "127.0.0.1:9091"
+		router := chi.NewRouter()
+		api, admin = newAdminRouter(router, probes, tododb)
+		Expect(api).To(BeIdenticalTo(router))
+		Expect(serve(router, "/healthz")).To(Equal(http.StatusNotFound))
+		Expect(serve(router, "/debug/info")).To(Equal(http.StatusNotFound))
+		Expect(serve(admin, "/healthz")).To(Equal(http.StatusOK))
+		Expect(serve(admin, "/debug/info")).To(Equal(http.StatusOK))
+		Expect(serve(admin, "/debug/pprof/")).To(Equal(http.StatusOK))
+		Expect(serve(admin, "/backup")).To(Equal(http.StatusOK))
+	})
+
+	Specify("Probes served with the API are not rate limited", func() {
+		cfg.Limits = config.Limits{ReadsPerMinute: 1, ReadBurst: 1}
+		router := newRouter()
+		router.Get("/todolist/", func(w http.ResponseWriter, r *http.Request) {})
+		api, _ := newAdminRouter(router, probes, tododb)
+		serve := func(path string) int {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			api.ServeHTTP(w, asClient(req, "192.0.2.1:1234", ""))
+			return w.Code
+		}
+
+		Expect(serve("/todolist/")).To(Equal(http.StatusOK))
+		Expect(serve("/todolist/")).To(Equal(http.StatusTooManyRequests))
+		for i := 0; i < 3; i++ {
+			Expect(serve("/healthz")).To(Equal(http.StatusOK))
+			Expect(serve("/readyz")).To(Equal(http.StatusOK))
+		}
+	})
+
+	Specify("Profiles are only served with the pprof feature", func() {
+		Expect(get("/debug/pprof/").Code).To(Equal(http.StatusNotFound))
+
+		cfg.Features.Pprof = true
+		w := get("/debug/pprof/")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(ContainSubstring("goroutine"))
+		Expect(get("/debug/pprof/goroutine?debug=1").Code).To(Equal(http.StatusOK))
+	})
+})
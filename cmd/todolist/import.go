@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Imports items into the database",
+	Long: `Adds the items in file to the database. The format is taken from --format,
+or else from the file extension. Use "-" to read from stdin.`,
+	Args: cobra.ExactArgs(1),
+	RunE: doImport,
+}
+
+var (
+	importFormat   string
+	importDryRun   bool
+	importConflict string
+)
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVarP(&importFormat, "format", "f", "", "import format: json, csv, markdown, ics or todotxt")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "report what would be imported without changing the database")
+	importCmd.Flags().StringVar(&importConflict, "conflict", structs.ConflictSkip, "how to handle items whose id already exists: skip, overwrite or rename")
+}
+
+func doImport(cmd *cobra.Command, args []string) error {
+	format, err := transferFormat(importFormat, args[0])
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if args[0] != "-" {
+		if in, err = os.Open(args[0]); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	items, err := format.Decode(in)
+	if err != nil {
+		return err
+	}
+
+	tododb, err := openDb()
+	if err != nil {
+		return err
+	}
+	defer tododb.Close()
+
+	todoService := todolist.NewItemsService(store.NewSqlStore(tododb))
+	result, err := todoService.ImportItems(context.Background(), items, structs.ImportOptions{
+		DryRun:   importDryRun,
+		Conflict: importConflict,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range result.Items {
+		if item.Original_id != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "%-12s %s (was %s)\n", item.Action, item.Id, item.Original_id)
+		} else {
+			fmt.Fprintf(cmd.OutOrStdout(), "%-12s %s\n", item.Action, item.Id)
+		}
+	}
+	summary := "imported"
+	if result.DryRun {
+		summary = "would import"
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s: %d created, %d overwritten, %d renamed, %d skipped\n",
+		summary, result.Created, result.Overwritten, result.Renamed, result.Skipped)
+	return nil
+}
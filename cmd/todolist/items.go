@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommands that manage items on a running server over the REST API.
+
+var addCmd = &cobra.Command{
+	Use:   "add <item>...",
+	Short: "Adds an item to the end of the list",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  doAdd,
+}
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "Lists the items in order",
+	Args:    cobra.NoArgs,
+	RunE:    doList,
+}
+
+var getCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Shows a single item",
+	Args:  cobra.ExactArgs(1),
+	RunE:  doGet,
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit <id>",
+	Short: "Changes an item",
+	Args:  cobra.ExactArgs(1),
+	RunE:  doEdit,
+}
+
+var doneCmd = &cobra.Command{
+	Use:   "done <id>...",
+	Short: "Marks items as completed",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  doDone,
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm <id>...",
+	Short: "Removes items",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  doRm,
+}
+
+var moveCmd = &cobra.Command{
+	Use:   "move <id> <position>",
+	Short: "Moves an item to a position in the list, starting from 1",
+	Args:  cobra.ExactArgs(2),
+	RunE:  doMove,
+}
+
+var (
+	itemPriority int
+	itemDue      string
+	itemStatus   string
+	itemText     string
+	itemProjects []string
+	itemContexts []string
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{addCmd, listCmd, getCmd, editCmd, doneCmd, rmCmd, moveCmd} {
+		rootCmd.AddCommand(cmd)
+		addClientFlags(cmd)
+	}
+
+	for _, cmd := range []*cobra.Command{addCmd, editCmd} {
+		cmd.Flags().IntVarP(&itemPriority, "priority", "p", 0, "item priority, lower first")
+		cmd.Flags().StringVar(&itemDue, "due", "", "due date as YYYY-MM-DD or RFC 3339, empty to clear")
+		cmd.Flags().StringSliceVar(&itemProjects, "project", nil, "project tag, may be repeated")
+		cmd.Flags().StringSliceVar(&itemContexts, "context", nil, "context tag, may be repeated")
+	}
+	editCmd.Flags().StringVarP(&itemText, "item", "i", "", "new item text")
+	editCmd.Flags().StringVar(&itemStatus, "status", "", "status: needs-action, in-process, completed or cancelled")
+}
+
+func parseDue(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid due date %q", value)
+}
+
+func doAdd(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	ctx := cmd.Context()
+
+	item := structs.TodoItem{
+		Id:       structs.NewItemId(),
+		Item:     strings.Join(args, " "),
+		Priority: itemPriority,
+		Projects: itemProjects,
+		Contexts: itemContexts,
+	}
+	var err error
+	if item.Due, err = parseDue(itemDue); err != nil {
+		return err
+	}
+
+	if item.Priority == 0 {
+		items, err := client.ListItems(ctx)
+		if err != nil {
+			return err
+		}
+		item.Priority = 1
+		for _, existing := range items.Items {
+			if existing.Priority >= item.Priority {
+				item.Priority = existing.Priority + 1
+			}
+		}
+	}
+
+	if err := client.AddItem(ctx, &item); err != nil {
+		return err
+	}
+	created, err := client.GetItem(ctx, item.Id)
+	if err != nil {
+		return err
+	}
+	return printItems(cmd.OutOrStdout(), []structs.TodoItem{*created})
+}
+
+func doList(cmd *cobra.Command, args []string) error {
+	items, err := newAPIClient().ListItems(cmd.Context())
+	if err != nil {
+		return err
+	}
+	if outputFormat == "json" {
+		return printJSON(cmd.OutOrStdout(), items)
+	}
+	return printItems(cmd.OutOrStdout(), items.Items)
+}
+
+func doGet(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	id, err := resolveId(cmd.Context(), client, args[0])
+	if err != nil {
+		return err
+	}
+	item, err := client.GetItem(cmd.Context(), id)
+	if err != nil {
+		return err
+	}
+	if outputFormat == "json" {
+		return printJSON(cmd.OutOrStdout(), item)
+	}
+	return printItems(cmd.OutOrStdout(), []structs.TodoItem{*item})
+}
+
+func doEdit(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	ctx := cmd.Context()
+	id, err := resolveId(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	item, err := client.GetItem(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("item") {
+		item.Item = itemText
+	}
+	if flags.Changed("priority") {
+		item.Priority = itemPriority
+	}
+	if flags.Changed("status") {
+		item.Status = itemStatus
+	}
+	if flags.Changed("due") {
+		if item.Due, err = parseDue(itemDue); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("project") {
+		item.Projects = itemProjects
+	}
+	if flags.Changed("context") {
+		item.Contexts = itemContexts
+	}
+
+	if err := client.UpdateItem(ctx, item); err != nil {
+		return err
+	}
+	if item, err = client.GetItem(ctx, id); err != nil {
+		return err
+	}
+	return printItems(cmd.OutOrStdout(), []structs.TodoItem{*item})
+}
+
+func doDone(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	ctx := cmd.Context()
+
+	var done []structs.TodoItem
+	for _, arg := range args {
+		id, err := resolveId(ctx, client, arg)
+		if err != nil {
+			return err
+		}
+		item, err := client.GetItem(ctx, id)
+		if err != nil {
+			return err
+		}
+		item.Status = structs.StatusCompleted
+		if err := client.UpdateItem(ctx, item); err != nil {
+			return err
+		}
+		if item, err = client.GetItem(ctx, id); err != nil {
+			return err
+		}
+		done = append(done, *item)
+	}
+	return printItems(cmd.OutOrStdout(), done)
+}
+
+func doRm(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	ctx := cmd.Context()
+
+	for _, arg := range args {
+		id, err := resolveId(ctx, client, arg)
+		if err != nil {
+			return err
+		}
+		if err := client.DeleteItem(ctx, id); err != nil {
+			return err
+		}
+		if outputFormat != "json" {
+			fmt.Fprintf(cmd.OutOrStdout(), "removed %s\n", id)
+		}
+	}
+	return nil
+}
+
+func doMove(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	ctx := cmd.Context()
+
+	position, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid position %q", args[1])
+	}
+	id, err := resolveId(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	if err := client.MoveItem(ctx, id, position); err != nil {
+		return err
+	}
+
+	items, err := client.ListItems(ctx)
+	if err != nil {
+		return err
+	}
+	if outputFormat == "json" {
+		return printJSON(cmd.OutOrStdout(), items)
+	}
+	return printItems(cmd.OutOrStdout(), items.Items)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+// printItems writes items in the format selected by --output.
+func printItems(w io.Writer, items []structs.TodoItem) error {
+	switch outputFormat {
+	case "json":
+		if len(items) == 1 {
+			return printJSON(w, items[0])
+		}
+		return printJSON(w, items)
+
+	case "plain":
+		for _, item := range items {
+			status := item.Status
+			if status == "" {
+				status = structs.StatusNeedsAction
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", item.Id, item.Priority, status, formatDate(item.Due), item.Item)
+		}
+		return nil
+
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPRI\tDONE\tDUE\tITEM")
+		for _, item := range items {
+			done := ""
+			if item.IsCompleted() {
+				done = "x"
+			}
+			text := item.Item
+			for _, project := range item.Projects {
+				text += " +" + project
+			}
+			for _, context := range item.Contexts {
+				text += " @" + context
+			}
+			// the first block of a UUID is enough to tell items apart
+			id := item.Id
+			if len(id) == 36 && id[8] == '-' {
+				id = id[:8]
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", id, item.Priority, done, formatDate(item.Due), text)
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown output format %q", outputFormat)
+	}
+}
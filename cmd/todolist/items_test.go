@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("Client subcommand tests", func() {
+	var ts *httptest.Server
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetArgs(append(args, "--server", ts.URL))
+		err := rootCmd.Execute()
+		for _, cmd := range rootCmd.Commands() {
+			// cobra keeps flag values between executions
+			cmd.Flags().VisitAll(func(f *pflag.Flag) {
+				if slice, ok := f.Value.(pflag.SliceValue); ok {
+					_ = slice.Replace(nil)
+				} else {
+					_ = f.Value.Set(f.DefValue)
+				}
+				f.Changed = false
+			})
+		}
+		return out.String(), err
+	}
+
+	listJSON := func() structs.TodoItemList {
+		out, err := run("list", "-o", "json")
+		Expect(err).NotTo(HaveOccurred())
+		var items structs.TodoItemList
+		Expect(json.Unmarshal([]byte(out), &items)).To(Succeed())
+		return items
+	}
+
+	BeforeEach(func() {
+		tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+
+		handler := &todolist.ItemsHandlers{
+			ItemsService: todolist.NewItemsService(store.NewSqlStore(tododb)),
+		}
+		router := newRouter()
+		handler.ConfigureRoutes(router)
+		ts = httptest.NewServer(router)
+		DeferCleanup(ts.Close)
+	})
+
+	Specify("Items are added to the end of the list and shown as a table", func() {
+		_, err := run("add", "Wash", "car", "--project", "chores")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = run("add", "Fix bike", "--due", "2024-05-01")
+		Expect(err).NotTo(HaveOccurred())
+
+		items := listJSON()
+		Expect(items.Count).To(Equal(2))
+		Expect(items.Items[0].Item).To(Equal("Wash car"))
+		Expect(items.Items[0].Priority).To(Equal(1))
+		Expect(items.Items[0].Projects).To(Equal([]string{"chores"}))
+		Expect(items.Items[1].Item).To(Equal("Fix bike"))
+		Expect(items.Items[1].Priority).To(Equal(2))
+
+		out, err := run("list")
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		Expect(lines).To(HaveLen(3))
+		Expect(lines[0]).To(MatchRegexp(`^ID\s+PRI\s+DONE\s+DUE\s+ITEM$`))
+		Expect(lines[1]).To(MatchRegexp(`^[0-9a-f]{8}\s+1\s+Wash car \+chores$`))
+		Expect(lines[2]).To(MatchRegexp(`^[0-9a-f]{8}\s+2\s+2024-05-01\s+Fix bike$`))
+	})
+
+	Specify("Items can be edited, completed, moved and removed by id prefix", func() {
+		for _, text := range []string{"First", "Second", "Third"} {
+			_, err := run("add", text)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		items := listJSON()
+		first, third := items.Items[0].Id, items.Items[2].Id
+
+		_, err := run("edit", first[:8], "--item", "First, edited")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = run("done", first[:8])
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := run("get", first, "-o", "json")
+		Expect(err).NotTo(HaveOccurred())
+		var item structs.TodoItem
+		Expect(json.Unmarshal([]byte(out), &item)).To(Succeed())
+		Expect(item.Item).To(Equal("First, edited"))
+		Expect(item.IsCompleted()).To(BeTrue())
+		Expect(item.Completed_at).NotTo(BeNil())
+
+		_, err = run("move", third[:8], "1")
+		Expect(err).NotTo(HaveOccurred())
+		items = listJSON()
+		Expect(items.Items[0].Item).To(Equal("Third"))
+		Expect(items.Items[1].Item).To(Equal("First, edited"))
+		Expect(items.Items[2].Item).To(Equal("Second"))
+		for i, item := range items.Items {
+			Expect(item.Priority).To(Equal(i + 1))
+		}
+
+		out, err = run("rm", third)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("removed " + third + "\n"))
+		Expect(listJSON().Count).To(Equal(2))
+
+		_, err = run("get", "does-not-exist")
+		Expect(err).To(MatchError(ContainSubstring("no item with id")))
+	})
+})
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"go.altair.com/todolist/pkg/logging"
+)
+
+// requestIdHeader carries the id that a request's log lines share. It is
+// taken from the caller when given, so that one id can follow a request
+// across services, and is always sent back.
+const requestIdHeader = "X-Request-ID"
+
+// validRequestId accepts ids that are safe to log as they are: up to 128
+// letters, digits and the punctuation ids are usually made with.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// logRequests is middleware giving each request an id and a logger, kept in
+// its context for the handlers, service and store, and logging each request
+// once it has been served.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIdHeader)
+		if !validRequestId(id) {
+			id = newRequestId()
+		}
+		w.Header().Set(requestIdHeader, id)
+
+		// the context is kept with the logger so that its lines carry the
+		// request's trace
+		logger := log.Logger.With().Str("request_id", id).Ctx(r.Context()).Logger()
+		ctx := logger.WithContext(r.Context())
+
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		access := logging.For(ctx, "http")
+		event := access.Info()
+		if code >= 500 {
+			event = access.Error()
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			event = event.Str("route", rctx.RoutePattern())
+		}
+		event.
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", code).
+			Dur("latency", time.Since(start)).
+			Int("bytes", ww.BytesWritten()).
+			Str("remote", r.RemoteAddr).
+			Msg("Request served")
+	})
+}
+
+// logGRPC gives each gRPC call an id and a logger as logRequests does for
+// requests, taking the id from the call's x-request-id metadata and sending
+// it back in the header, and logs each call once it has been handled.
+func logGRPC(ctx context.Context, method string, next func(ctx context.Context) error) error {
+	start := time.Now()
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIdHeader); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	if !validRequestId(id) {
+		id = newRequestId()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIdHeader, id))
+
+	logger := log.Logger.With().Str("request_id", id).Ctx(ctx).Logger()
+	ctx = logger.WithContext(ctx)
+
+	err := next(ctx)
+
+	code := status.Code(err)
+	access := logging.For(ctx, "http")
+	event := access.Info()
+	if serverFault(code) {
+		event = access.Error()
+	}
+	event = event.
+		Str("method", method).
+		Str("code", code.String()).
+		Dur("latency", time.Since(start))
+	if p, ok := peer.FromContext(ctx); ok {
+		event = event.Str("remote", p.Addr.String())
+	}
+	event.Msg("Call handled")
+	return err
+}
+
+// setLogLevels sets the global log level and those of each package. Events
+// are filtered by the global level first, so it is set to the most verbose
+// of them and the global logger keeps the configured level.
+func setLogLevels(level string, byPackage []string) error {
+	base, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels, err := logging.ParseLevels(byPackage)
+	if err != nil {
+		return err
+	}
+	lowest := base
+	for _, l := range levels {
+		if l < lowest {
+			lowest = l
+		}
+	}
+	zerolog.SetGlobalLevel(lowest)
+	log.Logger = log.Logger.Level(base)
+	logging.SetLevels(levels)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"go.altair.com/todolist/pkg/logging"
+	"go.altair.com/todolist/pkg/todolist"
+)
+
+var _ = Describe("Logging tests", func() {
+	var router *chi.Mux
+	var logs *bytes.Buffer
+
+	BeforeEach(func() {
+		router = testRouter(todolist.NewItemsService(testStore()))
+
+		logs = &bytes.Buffer{}
+		logger, level := log.Logger, zerolog.GlobalLevel()
+		log.Logger = zerolog.New(logs).Hook(traceHook{})
+		DeferCleanup(func() {
+			log.Logger = logger
+			zerolog.SetGlobalLevel(level)
+			logging.SetLevels(nil)
+		})
+	})
+
+	send := func(method, path, body, requestId string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if requestId != "" {
+			req.Header.Set(requestIdHeader, requestId)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// lines returns the logged events with the given message.
+	lines := func(msg string) []map[string]interface{} {
+		var found []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var event map[string]interface{}
+			if json.Unmarshal([]byte(line), &event) == nil && event["message"] == msg {
+				found = append(found, event)
+			}
+		}
+		return found
+	}
+
+	Specify("Requests keep the id they are sent with, or are given one", func() {
+		Expect(setLogLevels("info", nil)).To(Succeed())
+		w := send(http.MethodGet, "/todolist/", "", "checkout-42")
+		Expect(w.Header().Get(requestIdHeader)).To(Equal("checkout-42"))
+
+		w = send(http.MethodGet, "/todolist/", "", "")
+		Expect(w.Header().Get(requestIdHeader)).To(MatchRegexp("^[0-9a-f]{24}$"))
+
+		w = send(http.MethodGet, "/todolist/", "", "bad id\n")
+		Expect(w.Header().Get(requestIdHeader)).To(MatchRegexp("^[0-9a-f]{24}$"))
+	})
+
+	Specify("Each request is logged once it has been served", func() {
+		Expect(setLogLevels("info", nil)).To(Succeed())
+		send(http.MethodPost, "/todolist/", `{"id":"one","item":"Wash car","priority":1}`, "add-1")
+		req := httptest.NewRequest(http.MethodGet, "/todolist/one", nil)
+		req.Header.Set(requestIdHeader, "get-1")
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		served := lines("Request served")
+		Expect(served).To(HaveLen(2))
+		Expect(served[1]).To(HaveKeyWithValue("request_id", "get-1"))
+		Expect(served[1]).To(HaveKeyWithValue("package", "http"))
+		Expect(served[1]).To(HaveKeyWithValue("method", "GET"))
+		Expect(served[1]).To(HaveKeyWithValue("path", "/todolist/one"))
+		Expect(served[1]).To(HaveKeyWithValue("route", "/todolist/{id}"))
+		Expect(served[1]).To(HaveKeyWithValue("status", 200.0))
+		Expect(served[1]).To(HaveKeyWithValue("bytes", BeNumerically(">", 0)))
+		Expect(served[1]).To(HaveKey("latency"))
+		Expect(served[1]).To(HaveKeyWithValue("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"))
+	})
+
+	Specify("Packages log at their own levels with the request's id", func() {
+		Expect(setLogLevels("info", []string{"store=trace", "http=warn"})).To(Succeed())
+		send(http.MethodGet, "/todolist/missing", "", "get-2")
+
+		Expect(lines("Request served")).To(BeEmpty(), "http only logs warnings")
+		statements := lines("Ran statement")
+		Expect(statements).NotTo(BeEmpty())
+		Expect(statements[0]).To(HaveKeyWithValue("request_id", "get-2"))
+		Expect(statements[0]).To(HaveKeyWithValue("package", "store"))
+		Expect(statements[0]).To(HaveKeyWithValue("query", ContainSubstring("SELECT")))
+	})
+
+	Specify("Failed requests are logged as errors", func() {
+		Expect(setLogLevels("error", nil)).To(Succeed())
+		router.Get("/broken", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		})
+		send(http.MethodGet, "/todolist/", "", "")
+		send(http.MethodGet, "/broken", "", "")
+
+		served := lines("Request served")
+		Expect(served).To(HaveLen(1))
+		Expect(served[0]).To(HaveKeyWithValue("level", "error"))
+		Expect(served[0]).To(HaveKeyWithValue("status", 500.0))
+	})
+})
@@ -3,37 +3,113 @@ package main
 import (
 	"os"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.altair.com/todolist/pkg/config"
+	sqlitedb "go.altair.com/todolist/pkg/db"
 )
 
 var rootCmd = &cobra.Command{
 	Use:              "todolist",
 	Short:            description,
 	Long:             ``,
-	PersistentPreRun: doPersistentPreRun,
+	PersistentPreRunE: doPersistentPreRun,
 	SilenceErrors:    true, // allows us to log errors uniformly using the logger, without a duplicate from cobra
 }
 
 var (
-	debug bool
+	debug      bool
+	configPath string
+
+	// cfg is the effective configuration, layered from defaults, the
+	// configuration file, the environment and flags before each command runs.
+	cfg = config.Defaults()
 )
 
 const (
 	description = "todolist server"
 )
 
+// configKey annotates flags with the configuration key they override.
+const configKey = "config-key"
+
 func init() {
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "read settings from a YAML or TOML file (or set "+config.EnvPrefix+"CONFIG)")
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "enable debug logging")
+	rootCmd.PersistentFlags().String("db", "", "path to the SQLite database (default todolist.db next to the executable)")
+	rootCmd.PersistentFlags().String("log-format", cfg.Log.Format, "log as json or console")
+	bindFlag(rootCmd.PersistentFlags(), "db", "db.path")
+	rootCmd.PersistentFlags().String("log-levels", "", "set comma-separated log levels for the http, todolist and store packages, as in store=debug")
+	bindFlag(rootCmd.PersistentFlags(), "log-format", "log.format")
+	bindFlag(rootCmd.PersistentFlags(), "log-levels", "log.levels")
 }
 
-func doPersistentPreRun(cmd *cobra.Command, args []string) {
+// bindFlag makes a flag, when given, override a configuration key. Bound
+// flags are read through cfg, so need no variable of their own.
+func bindFlag(flags *pflag.FlagSet, name, key string) {
+	_ = flags.SetAnnotation(name, configKey, []string{key})
+}
+
+// loadConfig layers the configuration file, the environment and the flags
+// given to cmd over the defaults.
+func loadConfig(cmd *cobra.Command) (config.Config, error) {
+	c := config.Defaults()
+	path := configPath
+	if path == "" {
+		path = os.Getenv(config.EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return c, err
+		}
+	}
+	if err := c.LoadEnv(os.LookupEnv); err != nil {
+		return c, err
+	}
+
+	var err error
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if keys, ok := f.Annotations[configKey]; ok && err == nil {
+			err = c.Set(keys[0], f.Value.String())
+		}
+	})
+	if err != nil {
+		return c, err
+	}
 	if debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		c.Log.Level = "debug"
+	}
+	return c, c.Validate()
+}
+
+// openDb opens the configured database.
+func openDb() (*sqlx.DB, error) {
+	switch {
+	case cfg.DB.DSN != "":
+		return sqlitedb.Connect(cfg.DB.Driver, cfg.DB.DSN)
+	case cfg.DB.Path != "":
+		return sqlitedb.OpenDb(cfg.DB.Path)
+	default:
+		return sqlitedb.CreateDb()
+	}
+}
+
+func doPersistentPreRun(cmd *cobra.Command, args []string) error {
+	var err error
+	if cfg, err = loadConfig(cmd); err != nil {
+		return err
+	}
+
+	if cfg.Log.Format == "console" {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	} else {
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
 	}
+	log.Logger = log.Logger.Hook(traceHook{})
+	return setLogLevels(cfg.Log.Level, cfg.Log.Levels)
 }
 
 func main() {
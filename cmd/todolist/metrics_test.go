@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("Metrics tests", func() {
+	var router *chi.Mux
+	var todostore store.Store
+
+	BeforeEach(func() {
+		todostore = testStore()
+		// testRouter puts cfg back once the spec is done
+		cfg.Features.Metrics = true
+		router = testRouter(todolist.NewItemsService(todostore))
+		router.Handle("/metrics", metricsHandler())
+	})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	Specify("Requests are counted by route pattern and status", func() {
+		found := httpRequests.WithLabelValues(http.MethodGet, "/todolist/{id}", "200")
+		missing := httpRequests.WithLabelValues(http.MethodGet, "/todolist/{id}", "404")
+		unmatched := httpRequests.WithLabelValues("OTHER", "unmatched", "405")
+		before := []float64{testutil.ToFloat64(found), testutil.ToFloat64(missing), testutil.ToFloat64(unmatched)}
+
+		Expect(send(http.MethodPost, "/todolist/", `{"id":"one","item":"Wash car","priority":1}`).Code).To(Equal(http.StatusAccepted))
+		Expect(send(http.MethodGet, "/todolist/one", "").Code).To(Equal(http.StatusOK))
+		Expect(send(http.MethodGet, "/todolist/two", "").Code).To(Equal(http.StatusNotFound))
+		Expect(send(http.MethodGet, "/todolist/three", "").Code).To(Equal(http.StatusNotFound))
+		Expect(send("BREW", "/todolist/", "").Code).To(Equal(http.StatusMethodNotAllowed))
+
+		Expect(testutil.ToFloat64(found) - before[0]).To(Equal(1.0))
+		Expect(testutil.ToFloat64(missing) - before[1]).To(Equal(2.0))
+		Expect(testutil.ToFloat64(unmatched) - before[2]).To(Equal(1.0))
+	})
+
+	Specify("Transactions are timed and rollbacks counted", func() {
+		durations, rollbacks := store.Collectors()[0], store.Collectors()[1]
+		before := testutil.ToFloat64(rollbacks)
+		Expect(send(http.MethodPost, "/todolist/", `{"id":"one","item":"Wash car","priority":1}`).Code).To(Equal(http.StatusAccepted))
+		Expect(send(http.MethodDelete, "/todolist/missing", "").Code).To(Equal(http.StatusNotFound))
+		Expect(testutil.ToFloat64(rollbacks) - before).To(Equal(1.0))
+		// one series each for committed and rolled back transactions
+		Expect(testutil.CollectAndCount(durations)).To(Equal(2))
+	})
+
+	Specify("Items are counted by status", func() {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(todolist.NewItemsCollector(todostore))
+		send(http.MethodPost, "/todolist/", `{"id":"one","item":"Wash car","priority":1}`)
+		send(http.MethodPost, "/todolist/", `{"id":"two","item":"Fix bike","priority":2,"status":"completed"}`)
+		send(http.MethodPost, "/todolist/", `{"id":"three","item":"Book holiday","priority":3,"status":"needs-action"}`)
+
+		Expect(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP todolist_items Items in the list, by status.
+# TYPE todolist_items gauge
+todolist_items{status="cancelled"} 0
+todolist_items{status="completed"} 1
+todolist_items{status="in-process"} 0
+todolist_items{status="needs-action"} 2
+`))).To(Succeed())
+	})
+
+	Specify("Metrics are served in the Prometheus text format", func() {
+		send(http.MethodGet, "/todolist/", "")
+		w := send(http.MethodGet, "/metrics", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(HavePrefix("text/plain"))
+		body, err := io.ReadAll(w.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`todolist_http_requests_total{code="200",method="GET",route="/todolist"}`))
+		Expect(string(body)).To(ContainSubstring("go_goroutines"))
+		Expect(string(body)).To(ContainSubstring("todolist_store_transaction_duration_seconds_bucket"))
+	})
+
+	Specify("Requests are not instrumented without the metrics feature", func() {
+		cfg.Features.Metrics = false
+		plain := newRouter()
+		plain.Get("/", func(http.ResponseWriter, *http.Request) {})
+		counter := httpRequests.WithLabelValues(http.MethodGet, "/", "200")
+		before := testutil.ToFloat64(counter)
+		plain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(testutil.ToFloat64(counter)).To(Equal(before))
+	})
+
+})
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"go.altair.com/todolist/pkg/config"
+	"go.altair.com/todolist/pkg/todolist"
+)
+
+// rateLimiter throttles each client with a pair of token buckets, one for
+// reads and one for writes. A bucket holds up to burst tokens and refills at
+// a steady rate; each request takes a token, and is refused with 429 Too
+// Many Requests if there is none. Responses carry RateLimit-* headers
+// describing the bucket the request drew from. gRPC calls are limited the
+// same way, by a limiter of their own.
+type rateLimiter struct {
+	reads, writes bucketPolicy
+	now           func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*tokenBucket
+	swept   time.Time
+}
+
+// bucketPolicy is the size and refill rate, in tokens per second, of a
+// bucket. A rate of zero means no limit.
+type bucketPolicy struct {
+	rate  float64
+	burst int
+}
+
+type bucketKey struct {
+	client string
+	write  bool
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(c config.Limits) *rateLimiter {
+	return &rateLimiter{
+		reads:   bucketPolicy{rate: float64(c.ReadsPerMinute) / 60, burst: c.ReadBurst},
+		writes:  bucketPolicy{rate: float64(c.WritesPerMinute) / 60, burst: c.WriteBurst},
+		now:     time.Now,
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// isRead reports whether a request only reads, including the WebDAV methods
+// CalDAV clients query with.
+func isRead(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+		return true
+	}
+	return false
+}
+
+// clientKey identifies the client by its certificate if it presented one,
+// and otherwise by its IP address.
+func clientKey(r *http.Request) string {
+	if identity, ok := todolist.ClientIdentityFrom(r.Context()); ok {
+		return "user:" + identity.Name()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// isGRPCRead reports whether a gRPC method only reads, which those that get,
+// list or watch items do.
+func isGRPCRead(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	return strings.HasPrefix(method, "Get") || strings.HasPrefix(method, "List") || strings.HasPrefix(method, "Watch")
+}
+
+// grpcClientKey identifies the client of a gRPC call as clientKey does that
+// of a request.
+func grpcClientKey(ctx context.Context) string {
+	if identity, ok := todolist.ClientIdentityFrom(ctx); ok {
+		return "user:" + identity.Name()
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// policy returns the policy for reads or writes.
+func (l *rateLimiter) policy(write bool) bucketPolicy {
+	if write {
+		return l.writes
+	}
+	return l.reads
+}
+
+// take removes a token from the client's bucket if there is one. It returns
+// the tokens left and how long until the next one, and until the bucket is
+// full again.
+func (l *rateLimiter) take(key bucketKey, policy bucketPolicy) (ok bool, remaining int, next, full time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, found := l.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: float64(policy.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(policy.burst), b.tokens+now.Sub(b.last).Seconds()*policy.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		next = time.Duration((1 - b.tokens) / policy.rate * float64(time.Second))
+	}
+	full = time.Duration((float64(policy.burst) - b.tokens) / policy.rate * float64(time.Second))
+	return ok, int(b.tokens), next, full
+}
+
+// sweep forgets buckets that have refilled, at most once a minute, so that
+// clients that have gone away do not use memory.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		policy := l.policy(key.write)
+		if b.tokens+now.Sub(b.last).Seconds()*policy.rate >= float64(policy.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers need.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func (l *rateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := bucketKey{client: clientKey(r), write: !isRead(r.Method)}
+		policy := l.policy(key.write)
+		if policy.rate == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, remaining, retry, reset := l.take(key, policy)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", seconds(reset))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", policy.burst, seconds(time.Duration(float64(policy.burst)/policy.rate*float64(time.Second)))))
+		if !ok {
+			w.Header().Set("Retry-After", seconds(retry))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GRPC limits gRPC calls as Handler does requests. Refused calls fail with
+// ResourceExhausted, saying how long to wait in a RetryInfo detail.
+func (l *rateLimiter) GRPC(ctx context.Context, method string, next func(ctx context.Context) error) error {
+	key := bucketKey{client: grpcClientKey(ctx), write: !isGRPCRead(method)}
+	policy := l.policy(key.write)
+	if policy.rate == 0 {
+		return next(ctx)
+	}
+
+	if ok, _, retry, _ := l.take(key, policy); !ok {
+		st := status.New(codes.ResourceExhausted, "Too Many Requests")
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retry)}); err == nil {
+			st = detailed
+		}
+		return st.Err()
+	}
+	return next(ctx)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.altair.com/todolist/pkg/config"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+)
+
+// asClient makes req come from addr, and from a client presenting a verified
+// certificate for name if one is given.
+func asClient(req *http.Request, addr, name string) *http.Request {
+	req.RemoteAddr = addr
+	if name != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return req
+}
+
+var _ = Describe("Rate limit tests", func() {
+	var now time.Time
+	var limits config.Limits
+	var handler http.Handler
+
+	BeforeEach(func() {
+		now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		limits = config.Limits{ReadsPerMinute: 60, ReadBurst: 3, WritesPerMinute: 6, WriteBurst: 2}
+	})
+
+	JustBeforeEach(func() {
+		limiter := newRateLimiter(limits)
+		limiter.now = func() time.Time { return now }
+		handler = todolist.IdentifyClient(limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	})
+
+	request := func(method, addr, name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, asClient(httptest.NewRequest(method, "/todolist/", nil), addr, name))
+		return w
+	}
+
+	Specify("Clients are refused once their burst is used up", func() {
+		for remaining := 1; remaining >= 0; remaining-- {
+			w := request(http.MethodPost, "192.0.2.1:1234", "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("RateLimit-Limit")).To(Equal("2"))
+			Expect(w.Header().Get("RateLimit-Remaining")).To(Equal(strconv.Itoa(remaining)))
+		}
+
+		w := request(http.MethodPost, "192.0.2.1:1234", "")
+		Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(w.Header().Get("Retry-After")).To(Equal("10"))
+		Expect(w.Header().Get("RateLimit-Remaining")).To(Equal("0"))
+		Expect(w.Header().Get("RateLimit-Reset")).To(Equal("20"))
+		Expect(w.Header().Get("RateLimit-Policy")).To(Equal("2;w=20"))
+	})
+
+	Specify("Buckets refill over time", func() {
+		request(http.MethodPost, "192.0.2.1:1234", "")
+		request(http.MethodPost, "192.0.2.1:1234", "")
+
+		now = now.Add(5 * time.Second)
+		w := request(http.MethodPost, "192.0.2.1:1234", "")
+		Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(w.Header().Get("Retry-After")).To(Equal("5"))
+
+		now = now.Add(5 * time.Second)
+		Expect(request(http.MethodPost, "192.0.2.1:1234", "").Code).To(Equal(http.StatusOK))
+	})
+
+	Specify("Reads and writes are limited separately", func() {
+		request(http.MethodPost, "192.0.2.1:1234", "")
+		request(http.MethodPut, "192.0.2.1:1234", "")
+		Expect(request(http.MethodDelete, "192.0.2.1:1234", "").Code).To(Equal(http.StatusTooManyRequests))
+
+		for _, method := range []string{http.MethodGet, http.MethodHead, "PROPFIND"} {
+			w := request(method, "192.0.2.1:1234", "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("RateLimit-Limit")).To(Equal("3"))
+		}
+		Expect(request("REPORT", "192.0.2.1:1234", "").Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	Specify("Clients are told apart by certificate, or else by address", func() {
+		request(http.MethodPost, "192.0.2.1:1234", "")
+		request(http.MethodPost, "192.0.2.1:5678", "")
+		Expect(request(http.MethodPost, "192.0.2.1:9012", "").Code).To(Equal(http.StatusTooManyRequests))
+		Expect(request(http.MethodPost, "192.0.2.2:1234", "").Code).To(Equal(http.StatusOK))
+
+		// alice has her own bucket wherever she connects from
+		request(http.MethodPost, "192.0.2.1:1234", "alice")
+		Expect(request(http.MethodPost, "198.51.100.1:1234", "alice").Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodPost, "198.51.100.2:1234", "alice").Code).To(Equal(http.StatusTooManyRequests))
+		Expect(request(http.MethodPost, "198.51.100.2:1234", "bob").Code).To(Equal(http.StatusOK))
+	})
+
+	Context("Without a rate", func() {
+		BeforeEach(func() {
+			limits.WritesPerMinute = 0
+		})
+
+		Specify("Requests are not limited", func() {
+			for i := 0; i < 10; i++ {
+				w := request(http.MethodPost, "192.0.2.1:1234", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Header().Get("RateLimit-Limit")).To(BeEmpty())
+			}
+			Expect(request(http.MethodGet, "192.0.2.1:1234", "").Header().Get("RateLimit-Limit")).To(Equal("3"))
+		})
+	})
+
+	Specify("Idle clients are forgotten", func() {
+		limiter := newRateLimiter(limits)
+		limiter.now = func() time.Time { return now }
+		limiter.take(bucketKey{client: "ip:192.0.2.1"}, limiter.reads)
+		limiter.take(bucketKey{client: "ip:192.0.2.2", write: true}, limiter.writes)
+		Expect(limiter.buckets).To(HaveLen(2))
+
+		now = now.Add(time.Minute)
+		limiter.take(bucketKey{client: "ip:192.0.2.3"}, limiter.reads)
+		Expect(limiter.buckets).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Quota tests", func() {
+	var router *chi.Mux
+
+	BeforeEach(func() {
+		todoService := todolist.NewItemsService(testStore(), todolist.WithItemQuota(2))
+		router = testRouter(todoService)
+		(&todolist.CalDAVHandlers{ItemsService: todoService}).ConfigureRoutes(router)
+	})
+
+	send := func(method, path, contentType, body, name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, asClient(req, "192.0.2.1:1234", name))
+		return w
+	}
+
+	create := func(name, item string) int {
+		return send(http.MethodPost, "/todolist/", "application/json", `{"id":"`+structs.NewItemId()+`","item":"`+item+`","priority":1}`, name).Code
+	}
+
+	Specify("Each client may create items up to its quota", func() {
+		Expect(create("alice", "one")).To(Equal(http.StatusAccepted))
+		Expect(create("alice", "two")).To(Equal(http.StatusAccepted))
+		w := send(http.MethodPost, "/todolist/", "application/json", `{"id":"three","item":"three","priority":1}`, "alice")
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		Expect(w.Body.String()).To(ContainSubstring("at most 2 items"))
+
+		Expect(create("bob", "one")).To(Equal(http.StatusAccepted))
+		// clients without certificates are not limited
+		for i := 0; i < 3; i++ {
+			Expect(create("", "anonymous")).To(Equal(http.StatusAccepted))
+		}
+
+		var items struct{ Items []struct{ Owner string } }
+		w = send(http.MethodGet, "/todolist/", "", "", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(json.Unmarshal(w.Body.Bytes(), &items)).To(Succeed())
+		owners := map[string]int{}
+		for _, item := range items.Items {
+			owners[item.Owner]++
+		}
+		Expect(owners).To(Equal(map[string]int{"alice": 2, "bob": 1, "": 3}))
+	})
+
+	Specify("Imports past the quota are rolled back", func() {
+		Expect(create("alice", "one")).To(Equal(http.StatusAccepted))
+		w := send(http.MethodPost, "/todolist/import", "application/json", `[{"item":"two"},{"item":"three"}]`, "alice")
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+
+		w = send(http.MethodPost, "/todolist/import", "application/json", `[{"item":"two"}]`, "alice")
+		Expect(w.Code).To(Equal(http.StatusOK))
+	})
+
+	Specify("CalDAV clients are told there is no room", func() {
+		Expect(create("alice", "one")).To(Equal(http.StatusAccepted))
+		Expect(create("alice", "two")).To(Equal(http.StatusAccepted))
+		vtodo := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:three\r\nSUMMARY:three\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+		w := send(http.MethodPut, todolist.CalDAVPrefix+"/todolist/three.ics", "text/calendar", vtodo, "alice")
+		Expect(w.Code).To(Equal(http.StatusInsufficientStorage))
+	})
+})
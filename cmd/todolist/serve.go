@@ -1,7 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	sqlitedb "go.altair.com/todolist/pkg/db"
@@ -10,8 +18,10 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
 )
 
 var serveCmd = &cobra.Command{
@@ -21,65 +31,380 @@ var serveCmd = &cobra.Command{
 	RunE:  doServe,
 }
 
-var (
-	bindAddress string
-)
-
 func init() {
 	rootCmd.AddCommand(serveCmd)
-	serveCmd.Flags().StringVarP(&bindAddress, "bind", "b", "0.0.0.0:8080", "set the bind address for the server")
+	serveCmd.Flags().StringP("bind", "b", cfg.Server.Bind, "set the bind address for the server")
+	serveCmd.Flags().String("grpc-bind", cfg.Server.GRPCBind, "set the bind address for the gRPC server, empty to disable it")
+	bindFlag(serveCmd.Flags(), "bind", "server.bind")
+	serveCmd.Flags().String("tls-cert", "", "serve HTTPS and gRPC over TLS with this PEM certificate, reloaded when it changes")
+	serveCmd.Flags().String("tls-key", "", "PEM private key for --tls-cert")
+	serveCmd.Flags().String("tls-client-ca", "", "verify client certificates against this PEM CA bundle (mutual TLS)")
+	serveCmd.Flags().String("https-redirect-bind", "", "set a bind address that redirects HTTP requests to HTTPS")
+	serveCmd.Flags().String("admin-bind", "", "set a separate bind address for /metrics, /healthz, /readyz, /debug and /backup, empty to serve /metrics, /healthz and /readyz with the API")
+	serveCmd.Flags().Bool("metrics", false, "serve Prometheus metrics at /metrics")
+	bindFlag(serveCmd.Flags(), "metrics", "features.metrics")
+	serveCmd.Flags().Bool("pprof", false, "serve runtime profiles under /debug/pprof/ on the admin listener")
+	bindFlag(serveCmd.Flags(), "pprof", "features.pprof")
+	serveCmd.Flags().Int("items-per-user", 0, "cap the items each client with a certificate may create, zero for no cap; clients without certificates are not capped")
+	bindFlag(serveCmd.Flags(), "items-per-user", "limits.items_per_user")
+	serveCmd.Flags().String("backup-dir", "", "back the database up to this directory while serving, as often as backup.interval")
+	bindFlag(serveCmd.Flags(), "backup-dir", "backup.dir")
+	bindFlag(serveCmd.Flags(), "grpc-bind", "server.grpc_bind")
+	bindFlag(serveCmd.Flags(), "admin-bind", "server.admin_bind")
+	serveCmd.Flags().String("trace-exporter", cfg.Tracing.Exporter, "export traces with none, otlp or stdout")
+	bindFlag(serveCmd.Flags(), "trace-exporter", "tracing.exporter")
+	bindFlag(serveCmd.Flags(), "tls-cert", "tls.cert")
+	bindFlag(serveCmd.Flags(), "tls-key", "tls.key")
+	bindFlag(serveCmd.Flags(), "tls-client-ca", "tls.client_ca")
+	bindFlag(serveCmd.Flags(), "https-redirect-bind", "tls.redirect_bind")
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow any origin
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		// Allow certain methods
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		// Allow certain headers
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		// Allow credentials (if needed)
-		// w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		// If the request method is OPTIONS, return immediately
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Continue to the next middleware/handler
-		next.ServeHTTP(w, r)
-	})
+// logEvent records outbox events at debug level as they are relayed.
+func logEvent(ctx context.Context, event store.Event) error {
+	log.Debug().
+		Int64("id", event.Id).
+		Str("topic", event.Topic).
+		Str("aggregateId", event.Aggregate_id).
+		Msg("Outbox event")
+	return nil
 }
 
 func newRouter() *chi.Mux {
 	router := chi.NewRouter()
+	if cfg.Features.Metrics {
+		router.Use(instrumentHTTP)
+	}
+	router.Use(traceHTTP)
+	router.Use(logRequests)
 	router.Use(chimw.Recoverer)
-	router.Use(chimw.Timeout(60 * time.Second))
-	router.Use(corsMiddleware)
+	router.Use(requestTimeout(cfg.Server.RequestTimeout))
+	router.Use(newCORSPolicy(cfg.CORS).Handler)
+	router.Use(todolist.IdentifyClient)
+	router.Use(newRateLimiter(cfg.Limits).Handler)
 	return router
 }
 
+// requestTimeout cuts off requests that run for longer than timeout, except
+// for event streams, which last until the client goes away.
+func requestTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	withTimeout := chimw.Timeout(timeout)
+	return func(next http.Handler) http.Handler {
+		timed := withTimeout(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if todolist.IsEventStream(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timed.ServeHTTP(w, r)
+		})
+	}
+}
+
 func doServe(cmd *cobra.Command, args []string) error {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
     log.Info().Msg(description + " starting")
 
-    tododb, err := sqlitedb.CreateDb()
+    shutdownTracing, err := setupTracing(ctx, cfg.Tracing)
+    if err != nil {
+        log.Error().Err(err).Msg("Failed to set up tracing")
+        return err
+    }
+    defer func() {
+        // flush spans, including those of requests drained at shutdown
+        flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+        defer cancel()
+        if err := shutdownTracing(flushCtx); err != nil {
+            log.Warn().Err(err).Msg("Failed to flush spans")
+        }
+    }()
+
+    tododb, err := openDb()
     if err != nil {
         log.Error().Err(err).Msg("Failed to create SQLite database")
         return err
     }
+    defer func() {
+        if err := tododb.Close(); err != nil {
+            log.Error().Err(err).Msg("Failed to close SQLite database")
+        }
+    }()
+
+    if cfg.Limits.ItemsPerUser > 0 && cfg.TLS.ClientCA == "" {
+        log.Warn().Int("itemsPerUser", cfg.Limits.ItemsPerUser).Msg("Item quota only applies to clients with certificates, and tls.client_ca is not set")
+    }
 
     todostore := store.NewSqlStore(tododb)
-    todoService := todolist.NewItemsService(todostore)
+    todoService := todolist.NewItemsService(todostore,
+        todolist.WithItemQuota(cfg.Limits.ItemsPerUser),
+        todolist.WithIdempotencyKeyTTL(cfg.Server.IdempotencyKeyTTL))
+
+    broker := todolist.NewBroker()
+    relay := store.NewRelay(todostore, store.SinkFunc(func(ctx context.Context, event store.Event) error {
+        _ = logEvent(ctx, event)
+        return broker.Publish(ctx, event)
+    }))
+    relay.Retention = cfg.Server.EventRetention
+
+    // background workers are stopped, and waited for, once the servers have
+    // finished and before the database is closed
+    workerCtx, stopWorkers := context.WithCancel(context.Background())
+    var workers sync.WaitGroup
+    defer func() {
+        stopWorkers()
+        workers.Wait()
+    }()
+    probes := newHealth(todostore, tododb)
+    workers.Add(1)
+    relayStopped := probes.running("outbox relay")
+    go func() {
+        defer workers.Done()
+        defer relayStopped()
+        _ = relay.Run(workerCtx)
+    }()
+    if cfg.Backup.Dir != "" {
+        backups := &sqlitedb.Backups{
+            DB:       tododb,
+            Dir:      cfg.Backup.Dir,
+            Interval: cfg.Backup.Interval,
+            Keep:     cfg.Backup.Keep,
+        }
+        workers.Add(1)
+        backupsStopped := probes.running("backups")
+        go func() {
+            defer workers.Done()
+            defer backupsStopped()
+            _ = backups.Run(workerCtx)
+        }()
+    }
+
+    // the event feed, GraphQL subscriptions and gRPC WatchItems are served
+    // only with the events feature
+    var events *todolist.Broker
+    if cfg.Features.Events {
+        events = broker
+    }
 
     handler := &todolist.ItemsHandlers{
         ItemsService: todoService,
+        Events:       events,
     }
 
     router := newRouter()
     handler.ConfigureRoutes(router)
+    if cfg.Features.CalDAV {
+        (&todolist.CalDAVHandlers{ItemsService: todoService}).ConfigureRoutes(router)
+    }
+    if cfg.Features.GraphQL {
+        (&todolist.GraphQLHandlers{ItemsService: todoService, Events: events}).ConfigureRoutes(router)
+    }
+    if cfg.Features.JSONRPC {
+        (&todolist.RPCHandlers{ItemsService: todoService}).ConfigureRoutes(router)
+    }
+
+    if cfg.Features.Metrics {
+        registry.MustRegister(todolist.NewItemsCollector(todostore))
+    }
+    apiRouter, adminRouter := newAdminRouter(router, probes, tododb)
+
+    // a server failing stops the others, as does a signal
+    serveCtx, stopServing := context.WithCancel(ctx)
+    defer stopServing()
+    // streams to clients only end when their subscriptions do
+    go func() {
+        <-serveCtx.Done()
+        broker.Close()
+    }()
+
+    var tlsConfig *tls.Config
+    if cfg.TLS.Enabled() {
+        if tlsConfig, err = newTLSConfig(cfg.TLS); err != nil {
+            log.Error().Err(err).Msg("Failed to configure TLS")
+            return err
+        }
+    }
+
+    // every listener is opened before any server is started, so that if
+    // one cannot be there are no servers to stop
+    var listeners []net.Listener
+    listen := func(bind, what string) (net.Listener, error) {
+        listener, err := net.Listen("tcp", bind)
+        if err != nil {
+            log.Error().Err(err).Msg("Failed to listen for " + what)
+            for _, l := range listeners {
+                _ = l.Close()
+            }
+            return nil, err
+        }
+        listeners = append(listeners, listener)
+        return listener, nil
+    }
+    var grpcListener, redirectListener, adminListener net.Listener
+    if cfg.Server.GRPCBind != "" {
+        if grpcListener, err = listen(cfg.Server.GRPCBind, "gRPC requests"); err != nil {
+            return err
+        }
+    }
+    listener, err := listen(cfg.Server.Bind, "HTTP requests")
+    if err != nil {
+        return err
+    }
+    if cfg.TLS.RedirectBind != "" {
+        if redirectListener, err = listen(cfg.TLS.RedirectBind, "HTTP requests to redirect"); err != nil {
+            return err
+        }
+    }
+    if cfg.Server.AdminBind != "" {
+        if adminListener, err = listen(cfg.Server.AdminBind, "admin requests"); err != nil {
+            return err
+        }
+    }
+
+    errs := make(chan error, 4)
+    servers := 0
+    if grpcListener != nil {
+        grpcServer := newGRPCServer(tlsConfig)
+        (&todolist.GRPCServer{
+            ItemsService: todoService,
+            Events:       events,
+        }).Register(grpcServer)
+
+        log.Info().Str("bindAddress", cfg.Server.GRPCBind).Msg("Listening for gRPC requests")
+        servers++
+        go func() {
+            errs <- serveGRPC(serveCtx, grpcServer, grpcListener)
+        }()
+    }
+
+    srv := newHTTPServer(apiRouter)
+    if tlsConfig != nil {
+        srv.TLSConfig = tlsConfig
+        log.Info().Str("bindAddress", cfg.Server.Bind).Msg("Listening for HTTPS requests")
+    } else {
+        log.Info().Str("bindAddress", cfg.Server.Bind).Msg("Listening for HTTP requests")
+    }
+    servers++
+    go func() {
+        errs <- serveHTTP(serveCtx, srv, listener)
+    }()
+
+    if redirectListener != nil {
+        log.Info().Str("bindAddress", cfg.TLS.RedirectBind).Msg("Redirecting HTTP requests to HTTPS")
+        servers++
+        go func() {
+            errs <- serveHTTP(serveCtx, newHTTPServer(redirectToHTTPS(cfg.Server.Bind)), redirectListener)
+        }()
+    }
+
+    if adminListener != nil {
+        log.Info().Str("bindAddress", cfg.Server.AdminBind).Msg("Listening for admin requests")
+        servers++
+        go func() {
+            errs <- serveHTTP(serveCtx, newHTTPServer(adminRouter), adminListener)
+        }()
+    }
+
+    var serveErr error
+    for ; servers > 0; servers-- {
+        if err := <-errs; err != nil && serveErr == nil {
+            serveErr = err
+            stopServing()
+        }
+    }
+    log.Info().Msg(description + " stopped")
+    return serveErr
+}
+
+// newHTTPServer applies the configured connection limits to a server for
+// handler.
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+}
+
+// serveHTTP serves on listener, over TLS if srv has a TLS configuration,
+// until ctx is done, then stops accepting connections and gives in-flight
+// requests the shutdown timeout to finish before cutting them off.
+func serveHTTP(ctx context.Context, srv *http.Server, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errs <- srv.ServeTLS(listener, "", "")
+		} else {
+			errs <- srv.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("Draining HTTP requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		_ = srv.Close()
+		return fmt.Errorf("HTTP requests did not finish in %s: %w", cfg.Server.ShutdownTimeout, err)
+	}
+	return nil
+}
 
-    log.Info().Str("bindAddress", bindAddress).Msg("Listening for HTTP requests")
-    return http.ListenAndServe(bindAddress, router)
+// newAdminRouter serves the operational endpoints on a router of their own,
+// returning the routers for the API and for the admin listener. Without an
+// admin listener, the API is served by that router, with router mounted
+// behind the endpoints, so that probes and scrapes skip router's middleware
+// and are not rate limited along with the clients sharing their address.
+// Diagnostics and snapshots, which hold every client's items, are only
+// served to those who can reach the admin listener.
+func newAdminRouter(router *chi.Mux, probes *health, tododb *sqlx.DB) (apiRouter, adminRouter *chi.Mux) {
+	adminRouter = chi.NewRouter()
+	if cfg.Features.Metrics {
+		adminRouter.Handle("/metrics", metricsHandler())
+	}
+	probes.ConfigureRoutes(adminRouter)
+	if cfg.Server.AdminBind == "" {
+		adminRouter.Mount("/", router)
+		return adminRouter, nil
+	}
+	probes.ConfigureDebugRoutes(adminRouter)
+	adminRouter.Get("/backup", serveSnapshot(tododb))
+	return router, adminRouter
 }
 
+// serveGRPC is serveHTTP for gRPC.
+func serveGRPC(ctx context.Context, server *grpc.Server, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("Draining gRPC requests")
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(cfg.Server.ShutdownTimeout):
+		server.Stop()
+		<-stopped
+		return fmt.Errorf("gRPC requests did not finish in %s", cfg.Server.ShutdownTimeout)
+	}
+}
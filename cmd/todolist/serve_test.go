@@ -6,12 +6,17 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+	"go.altair.com/todolist/pkg/config"
 	sqlitedb "go.altair.com/todolist/pkg/db"
 	"go.altair.com/todolist/pkg/structs"
 	"go.altair.com/todolist/pkg/todolist"
@@ -27,6 +32,28 @@ func TestTodoServe(t *testing.T) {
 	RunSpecs(t, "serve suite")
 }
 
+// testStore opens a database in a temporary directory, which is closed once
+// the spec is done.
+func testStore() store.Store {
+	tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(tododb.Close)
+	return store.NewSqlStore(tododb)
+}
+
+// testRouter makes a router serving the items API from service, with no
+// rate limits so that specs may send as many requests as they like. cfg is
+// put back to the defaults once the spec is done.
+func testRouter(service todolist.ItemsService) *chi.Mux {
+	DeferCleanup(func() {
+		cfg = config.Defaults()
+	})
+	cfg.Limits = config.Limits{}
+	router := newRouter()
+	(&todolist.ItemsHandlers{ItemsService: service}).ConfigureRoutes(router)
+	return router
+}
+
 func testRequest(ts *httptest.Server, method, path string, requestBody interface{}, decodedRespBody interface{}) *http.Response {
 
 	var body io.Reader
@@ -51,6 +78,25 @@ func testRequest(ts *httptest.Server, method, path string, requestBody interface
 	return resp
 }
 
+func testRawRequest(ts *httptest.Server, method, path, contentType, requestBody string, headers ...string) (*http.Response, string) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(requestBody))
+	Expect(err).NotTo(HaveOccurred())
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+	return resp, string(body)
+}
+
 var _ = Describe("Todo Serve tests", func() {
 	Context("When serving", Ordered, func() {
 		var ts *httptest.Server
@@ -62,13 +108,20 @@ var _ = Describe("Todo Serve tests", func() {
 			handler := &todolist.ItemsHandlers{
 				ItemsService: todoService,
 			}
+			caldav := &todolist.CalDAVHandlers{
+				ItemsService: todoService,
+			}
+			// these specs make more requests than the default limits allow
+			cfg.Limits = config.Limits{}
 			router := newRouter()
 			handler.ConfigureRoutes(router)
+			caldav.ConfigureRoutes(router)
 			ts = httptest.NewServer(router)
 		})
 
 		AfterAll(func() {
 			ts.Close()
+			cfg = config.Defaults()
 		})
 
 		Specify("List returns empty", func() {
@@ -112,11 +165,10 @@ var _ = Describe("Todo Serve tests", func() {
 			
 				Expect(resp.StatusCode).To(Equal(200))
 			
-				// Round the created_at and updated_at to seconds
-				gItem.Created_at = gItem.Created_at.Round(time.Second)
-				gItem.Updated_at = gItem.Updated_at.Round(time.Second)
-				item.Created_at = item.Created_at.Round(time.Second)
-				item.Updated_at = item.Updated_at.Round(time.Second)
+				// times are compared as instants, whatever their location
+				Expect(gItem.Created_at).To(BeTemporally("~", item.Created_at, time.Second))
+				Expect(gItem.Updated_at).To(BeTemporally("~", item.Updated_at, time.Second))
+				gItem.Created_at, gItem.Updated_at = item.Created_at, item.Updated_at
 			
 				Expect(item).To(Equal(gItem))
 			})
@@ -128,18 +180,15 @@ var _ = Describe("Todo Serve tests", func() {
 				Expect(resp.StatusCode).To(Equal(200))
 				Expect(items.Count).To(Equal(1))
 
-				// Round the Created_at and Updated_at fields of each item in the list
-				for i := range items.Items {
-					items.Items[i].Created_at = items.Items[i].Created_at.Round(time.Second)
-					items.Items[i].Updated_at = items.Items[i].Updated_at.Round(time.Second)
-				}
-
-				// Round the Created_at and Updated_at fields of the item to compare with the list
-				item.Created_at = item.Created_at.Round(time.Second)
-				item.Updated_at = item.Updated_at.Round(time.Second)
+				// Compare the times as instants, whatever their location
+				var listed structs.TodoItem
+				Expect(items.Items).To(ContainElement(HaveField("Id", item.Id), &listed))
+				Expect(listed.Created_at).To(BeTemporally("~", item.Created_at, time.Second))
+				Expect(listed.Updated_at).To(BeTemporally("~", item.Updated_at, time.Second))
+				listed.Created_at, listed.Updated_at = item.Created_at, item.Updated_at
 
 				// Now compare
-				Expect(items.Items).To(ContainElement(item))
+				Expect(listed).To(Equal(item))
 			})
 
 			Context("When todo item modified", func() {
@@ -242,5 +291,482 @@ var _ = Describe("Todo Serve tests", func() {
 				})
 			})
 		})
+
+		Context("When importing and exporting", func() {
+			const csvList = "id,item,priority\n" +
+				"11111111-1111-4111-8111-111111111111,Wash car,1\n" +
+				"22222222-2222-4222-8222-222222222222,\"Fix bike, then ride it\",2\n"
+
+			AfterEach(func() {
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				for _, item := range items.Items {
+					resp := testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+					Expect(resp.StatusCode).To(Equal(204))
+				}
+			})
+
+			Specify("Dry run reports without importing", func() {
+				var result structs.ImportResult
+				resp, body := testRawRequest(ts, "POST", "/todolist/import?dry_run=true", "text/csv", csvList)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(json.Unmarshal([]byte(body), &result)).To(Succeed())
+				Expect(result.DryRun).To(BeTrue())
+				Expect(result.Created).To(Equal(2))
+
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				Expect(items.Count).To(Equal(0))
+			})
+
+			Specify("Imported items round trip through every format", func() {
+				resp, _ := testRawRequest(ts, "POST", "/todolist/import", "text/csv", csvList)
+				Expect(resp.StatusCode).To(Equal(200))
+
+				resp, body := testRawRequest(ts, "GET", "/todolist/export?format=csv", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/csv"))
+				Expect(body).To(ContainSubstring(`"Fix bike, then ride it"`))
+
+				resp, body = testRawRequest(ts, "GET", "/todolist/export?format=markdown", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(body).To(HavePrefix("- [ ] Wash car <!-- id:11111111-1111-4111-8111-111111111111 -->\n"))
+
+				var result structs.ImportResult
+				resp, reimport := testRawRequest(ts, "POST", "/todolist/import?format=markdown", "", body)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(json.Unmarshal([]byte(reimport), &result)).To(Succeed())
+				Expect(result.Skipped).To(Equal(2))
+
+				resp, body = testRawRequest(ts, "GET", "/todolist/export?format=json", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				resp, reimport = testRawRequest(ts, "POST", "/todolist/import?conflict=rename", "application/json", body)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(json.Unmarshal([]byte(reimport), &result)).To(Succeed())
+				Expect(result.Renamed).To(Equal(2))
+
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				Expect(items.Count).To(Equal(4))
+			})
+
+			Specify("Items round trip through todo.txt", func() {
+				const todoTxt = "(B) Plan trip +holiday @home due:2024-06-01 id:33333333-3333-4333-8333-333333333333\n" +
+					"x 2024-01-02 Renew insurance\n"
+				resp, _ := testRawRequest(ts, "POST", "/todolist/import?format=todotxt", "", todoTxt)
+				Expect(resp.StatusCode).To(Equal(200))
+
+				var gItem structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/33333333-3333-4333-8333-333333333333", nil, &gItem)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(gItem.Priority).To(Equal(2))
+				Expect(gItem.Projects).To(Equal([]string{"holiday"}))
+				Expect(gItem.Contexts).To(Equal([]string{"home"}))
+
+				resp, body := testRawRequest(ts, "GET", "/todolist/export?format=todotxt", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+				Expect(body).To(MatchRegexp(`(?m)^\(B\) \d{4}-\d{2}-\d{2} Plan trip \+holiday @home due:2024-06-01 id:33333333-3333-4333-8333-333333333333$`))
+				Expect(body).To(MatchRegexp(`(?m)^x 2024-01-02 \d{4}-\d{2}-\d{2} Renew insurance pri:C id:\S+$`))
+			})
+
+			Specify("Unknown formats and conflict strategies are rejected", func() {
+				resp, _ := testRawRequest(ts, "GET", "/todolist/export?format=xml", "", "")
+				Expect(resp.StatusCode).To(Equal(400))
+
+				resp, _ = testRawRequest(ts, "POST", "/todolist/import?conflict=merge", "text/csv", csvList)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+		})
+
+		Context("When exchanging iCalendar files", func() {
+			const calendar = "BEGIN:VCALENDAR\r\n" +
+				"VERSION:2.0\r\n" +
+				"PRODID:-//Example//Tasks//EN\r\n" +
+				"BEGIN:VTODO\r\n" +
+				"UID:task-1@example.com\r\n" +
+				"DTSTAMP:20240101T090000Z\r\n" +
+				"SUMMARY:Renew passport\\, then book\r\n" +
+				"  flights\r\n" +
+				"PRIORITY:2\r\n" +
+				"DUE;VALUE=DATE:20240301\r\n" +
+				"END:VTODO\r\n" +
+				"BEGIN:VTODO\r\n" +
+				"UID:task-2@example.com\r\n" +
+				"DTSTAMP:20240101T090000Z\r\n" +
+				"SUMMARY:Pay council tax\r\n" +
+				"BEGIN:VALARM\r\n" +
+				"ACTION:EMAIL\r\n" +
+				"TRIGGER:-P1D\r\n" +
+				"SUMMARY:Council tax is due tomorrow\r\n" +
+				"END:VALARM\r\n" +
+				"STATUS:COMPLETED\r\n" +
+				"COMPLETED:20240105T120000Z\r\n" +
+				"END:VTODO\r\n" +
+				"END:VCALENDAR\r\n"
+
+			AfterEach(func() {
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				for _, item := range items.Items {
+					resp := testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+					Expect(resp.StatusCode).To(Equal(204))
+				}
+			})
+
+			Specify("Imported tasks keep their UID and are not duplicated on re-import", func() {
+				var result structs.ImportResult
+				resp, body := testRawRequest(ts, "POST", "/todolist/import", "text/calendar", calendar)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(json.Unmarshal([]byte(body), &result)).To(Succeed())
+				Expect(result.Created).To(Equal(2))
+
+				var gItem structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/task-1@example.com", nil, &gItem)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(gItem.Item).To(Equal("Renew passport, then book flights"))
+				Expect(gItem.Priority).To(Equal(2))
+				Expect(gItem.Due.UTC()).To(Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)))
+
+				resp = testRequest(ts, "GET", "/todolist/task-2@example.com", nil, &gItem)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(gItem.Item).To(Equal("Pay council tax"))
+				Expect(gItem.Status).To(Equal(structs.StatusCompleted))
+				Expect(gItem.Completed_at.UTC()).To(Equal(time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)))
+
+				resp, body = testRawRequest(ts, "POST", "/todolist/import", "text/calendar", calendar)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(json.Unmarshal([]byte(body), &result)).To(Succeed())
+				Expect(result.Created).To(Equal(0))
+				Expect(result.Skipped).To(Equal(2))
+			})
+
+			Specify("Items are served as VTODO components", func() {
+				resp, _ := testRawRequest(ts, "POST", "/todolist/import", "text/calendar", calendar)
+				Expect(resp.StatusCode).To(Equal(200))
+
+				resp, body := testRawRequest(ts, "GET", "/todolist.ics", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/calendar"))
+				Expect(body).To(HavePrefix("BEGIN:VCALENDAR\r\n"))
+				Expect(body).To(ContainSubstring("UID:task-1@example.com\r\n"))
+				Expect(body).To(ContainSubstring("SUMMARY:Renew passport\\, then book flights\r\n"))
+				Expect(body).To(ContainSubstring("DUE;VALUE=DATE:20240301\r\n"))
+				Expect(body).To(ContainSubstring("STATUS:COMPLETED\r\n"))
+				Expect(body).To(ContainSubstring("COMPLETED:20240105T120000Z\r\n"))
+				Expect(body).To(HaveSuffix("END:VCALENDAR\r\n"))
+			})
+		})
+
+		Context("When syncing over CalDAV", func() {
+			const task = "BEGIN:VCALENDAR\r\n" +
+				"VERSION:2.0\r\n" +
+				"PRODID:-//Example//Tasks//EN\r\n" +
+				"BEGIN:VTODO\r\n" +
+				"UID:caldav-1\r\n" +
+				"DTSTAMP:20240101T090000Z\r\n" +
+				"SUMMARY:Water plants\r\n" +
+				"END:VTODO\r\n" +
+				"END:VCALENDAR\r\n"
+
+			const query = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter></c:filter>
+</c:calendar-query>`
+
+			AfterEach(func() {
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				for _, item := range items.Items {
+					resp := testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+					Expect(resp.StatusCode).To(Equal(204))
+				}
+			})
+
+			Specify("The collection is discoverable", func() {
+				resp, body := testRawRequest(ts, "PROPFIND", "/caldav/", "application/xml",
+					`<d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/><d:resourcetype/></d:prop></d:propfind>`,
+					"Depth", "1")
+				Expect(resp.StatusCode).To(Equal(207))
+				Expect(body).To(ContainSubstring("<d:href>/caldav/todolist/</d:href>"))
+				Expect(body).To(ContainSubstring("<c:calendar/>"))
+			})
+
+			Specify("Tasks can be created, queried, updated and deleted", func() {
+				resp, _ := testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", task, "If-None-Match", "*")
+				Expect(resp.StatusCode).To(Equal(201))
+				etag := resp.Header.Get("ETag")
+				Expect(etag).NotTo(BeEmpty())
+
+				var gItem structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/caldav-1", nil, &gItem)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(gItem.Item).To(Equal("Water plants"))
+				Expect(gItem.Priority).To(Equal(1))
+
+				resp, body := testRawRequest(ts, "REPORT", "/caldav/todolist/", "application/xml", query, "Depth", "1")
+				Expect(resp.StatusCode).To(Equal(207))
+				Expect(body).To(ContainSubstring("<d:href>/caldav/todolist/caldav-1.ics</d:href>"))
+				Expect(body).To(ContainSubstring("<d:getetag>&#34;"))
+				Expect(body).To(ContainSubstring("SUMMARY:Water plants"))
+
+				updated := strings.Replace(task, "Water plants", "Water plants and feed cat", 1)
+				resp, _ = testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", updated, "If-Match", `"stale"`)
+				Expect(resp.StatusCode).To(Equal(412))
+				resp, _ = testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", updated, "If-Match", etag)
+				Expect(resp.StatusCode).To(Equal(204))
+				Expect(resp.Header.Get("ETag")).NotTo(Equal(etag))
+
+				resp, body = testRawRequest(ts, "GET", "/caldav/todolist/caldav-1.ics", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(body).To(ContainSubstring("SUMMARY:Water plants and feed cat\r\n"))
+
+				resp, _ = testRawRequest(ts, "DELETE", "/caldav/todolist/caldav-1.ics", "", "")
+				Expect(resp.StatusCode).To(Equal(204))
+				resp, _ = testRawRequest(ts, "GET", "/caldav/todolist/caldav-1.ics", "", "")
+				Expect(resp.StatusCode).To(Equal(404))
+			})
+
+			Specify("Changes are refused unless their preconditions hold", func() {
+				resp, _ := testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", task, "If-Match", "*")
+				Expect(resp.StatusCode).To(Equal(412))
+				resp, _ = testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", task, "If-None-Match", "*")
+				Expect(resp.StatusCode).To(Equal(201))
+				resp, _ = testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", task, "If-None-Match", "*")
+				Expect(resp.StatusCode).To(Equal(412))
+
+				resp, _ = testRawRequest(ts, "DELETE", "/caldav/todolist/caldav-1.ics", "", "", "If-Match", `"stale"`)
+				Expect(resp.StatusCode).To(Equal(412))
+				resp, _ = testRawRequest(ts, "GET", "/caldav/todolist/caldav-1.ics", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				resp, _ = testRawRequest(ts, "DELETE", "/caldav/todolist/caldav-1.ics", "", "", "If-Match", resp.Header.Get("ETag"))
+				Expect(resp.StatusCode).To(Equal(204))
+				resp, _ = testRawRequest(ts, "DELETE", "/caldav/todolist/caldav-1.ics", "", "")
+				Expect(resp.StatusCode).To(Equal(404))
+			})
+
+			Specify("Tasks without a priority are added to the end of the list", func() {
+				resp, _ := testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", task, "If-None-Match", "*")
+				Expect(resp.StatusCode).To(Equal(201))
+				second := strings.Replace(task, "Water plants", "Repot cactus", 1)
+				resp, _ = testRawRequest(ts, "PUT", "/caldav/todolist/caldav-2.ics", "text/calendar", second, "If-None-Match", "*")
+				Expect(resp.StatusCode).To(Equal(201))
+
+				var gItem structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/caldav-2", nil, &gItem)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(gItem.Priority).To(Equal(2))
+			})
+
+			Specify("Request bodies are capped", func() {
+				filler := strings.Repeat("X-FILLER:"+strings.Repeat("x", 64)+"\r\n", todolist.MaxRequestBody/64)
+				oversized := strings.Replace(task, "END:VTODO", filler+"END:VTODO", 1)
+				resp, _ := testRawRequest(ts, "PUT", "/caldav/todolist/caldav-1.ics", "text/calendar", oversized)
+				Expect(resp.StatusCode).To(Equal(413))
+				resp, _ = testRawRequest(ts, "GET", "/caldav/todolist/caldav-1.ics", "", "")
+				Expect(resp.StatusCode).To(Equal(404))
+
+				resp, _ = testRawRequest(ts, "REPORT", "/caldav/todolist/", "application/xml", query+strings.Repeat(" ", todolist.MaxRequestBody), "Depth", "1")
+				Expect(resp.StatusCode).To(Equal(413))
+			})
+		})
+
+		Context("When validating requests", func() {
+			invalid := func(method, path, body string) []structs.FieldError {
+				resp, respBody := testRawRequest(ts, method, path, "application/json", body)
+				Expect(resp.StatusCode).To(Equal(400))
+				Expect(resp.Header.Get("Content-Type")).To(HavePrefix("application/json"))
+				var errs structs.ValidationError
+				Expect(json.Unmarshal([]byte(respBody), &errs)).To(Succeed())
+				return errs.Errors
+			}
+
+			DescribeTable("Invalid items are rejected with every problem",
+				func(body string, expected ...structs.FieldError) {
+					errs := invalid("POST", "/todolist", body)
+					Expect(errs).To(HaveLen(len(expected)))
+					for i, fe := range expected {
+						Expect(errs[i].Field).To(Equal(fe.Field))
+						Expect(errs[i].Code).To(Equal(fe.Code))
+						Expect(errs[i].Message).NotTo(BeEmpty())
+					}
+				},
+				Entry("empty body", ``,
+					structs.FieldError{Code: structs.CodeRequired}),
+				Entry("missing fields", `{"id":"v1"}`,
+					structs.FieldError{Field: "item", Code: structs.CodeRequired},
+					structs.FieldError{Field: "priority", Code: structs.CodeOutOfRange}),
+				Entry("every field invalid", `{"id":"v1","item":"`+strings.Repeat("x", 251)+`","priority":-1,"status":"doing"}`,
+					structs.FieldError{Field: "item", Code: structs.CodeTooLong},
+					structs.FieldError{Field: "priority", Code: structs.CodeOutOfRange},
+					structs.FieldError{Field: "status", Code: structs.CodeInvalidValue}),
+				Entry("unknown field", `{"id":"v1","item":"Walk dog","priority":1,"colour":"red"}`,
+					structs.FieldError{Field: "colour", Code: structs.CodeUnknownField}),
+				Entry("wrong type", `{"id":"v1","item":"Walk dog","priority":"high"}`,
+					structs.FieldError{Field: "priority", Code: structs.CodeInvalidType}),
+				Entry("malformed JSON", `{"id":"v1",`,
+					structs.FieldError{Code: structs.CodeInvalidJSON}),
+				Entry("trailing data", `{"id":"v1","item":"Walk dog","priority":1} {}`,
+					structs.FieldError{Code: structs.CodeTrailingData}),
+			)
+
+			Specify("Item length is counted in characters", func() {
+				item := structs.TodoItem{Id: "v2", Item: strings.Repeat("é", structs.MaxItemLength), Priority: 1}
+				resp := testRequest(ts, "POST", "/todolist", item, nil)
+				Expect(resp.StatusCode).To(Equal(202))
+
+				item.Item += "é"
+				errs := invalid("PUT", "/todolist/v2", `{"item":"`+item.Item+`","priority":1}`)
+				Expect(errs).To(ConsistOf(HaveField("Code", structs.CodeTooLong)))
+
+				resp = testRequest(ts, "DELETE", "/todolist/v2", nil, nil)
+				Expect(resp.StatusCode).To(Equal(204))
+			})
+
+			Specify("Moves and imports are validated", func() {
+				errs := invalid("POST", "/todolist/v3/move", `{"position":0}`)
+				Expect(errs).To(ConsistOf(structs.FieldError{Field: "position", Code: structs.CodeOutOfRange, Message: "position must be at least 1"}))
+
+				errs = invalid("POST", "/todolist/import?format=json", `[{"item":"Fine"},{"item":"","status":"doing"}]`)
+				Expect(errs).To(HaveLen(2))
+				Expect(errs[0].Field).To(Equal("items[1].item"))
+				Expect(errs[1].Field).To(Equal("items[1].status"))
+
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				Expect(items.Count).To(Equal(0))
+			})
+
+			Specify("Request bodies are capped", func() {
+				body := `{"id":"v4","item":"` + strings.Repeat("x", todolist.MaxRequestBody) + `","priority":1}`
+				resp, _ := testRawRequest(ts, "POST", "/todolist", "application/json", body)
+				Expect(resp.StatusCode).To(Equal(413))
+
+				resp, _ = testRawRequest(ts, "POST", "/todolist/import", "text/csv", strings.Repeat("x", todolist.MaxRequestBody+1))
+				Expect(resp.StatusCode).To(Equal(413))
+			})
+		})
+
+		Context("When negotiating content", func() {
+			AfterEach(func() {
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				for _, item := range items.Items {
+					testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+				}
+			})
+
+			Specify("Items are sent and received as YAML", func() {
+				resp, _ := testRawRequest(ts, "POST", "/todolist", "application/yaml",
+					"id: yaml-1\nitem: 'Feed cat: twice'\npriority: 1\ndue: 2024-05-01\nprojects: [pets]\n")
+				Expect(resp.StatusCode).To(Equal(202))
+
+				resp, body := testRawRequest(ts, "GET", "/todolist/yaml-1", "", "", "Accept", "application/yaml")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("Content-Type")).To(HavePrefix("application/yaml"))
+				Expect(resp.Header.Get("Vary")).To(Equal("Accept"))
+				Expect(body).To(HavePrefix("id: yaml-1\nitem: 'Feed cat: twice'\npriority: 1\n"))
+				Expect(body).To(ContainSubstring("projects:\n  - pets\n"))
+
+				var item map[string]interface{}
+				Expect(yaml.Unmarshal([]byte(body), &item)).To(Succeed())
+				Expect(item["item"]).To(Equal("Feed cat: twice"))
+
+				resp, body = testRawRequest(ts, "GET", "/todolist", "", "", "Accept", "application/json;q=0.5, application/x-yaml")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("Content-Type")).To(HavePrefix("application/yaml"))
+				Expect(body).To(HavePrefix("Items:\n  - id: yaml-1\n"))
+				Expect(body).To(HaveSuffix("Count: 1\n"))
+			})
+
+			Specify("Items are submitted from HTML forms", func() {
+				resp, _ := testRawRequest(ts, "POST", "/todolist", "application/x-www-form-urlencoded",
+					"id=form-1&item=Buy+milk&priority=2&due=2024-05-01&projects=shopping,home&projects=errands")
+				Expect(resp.StatusCode).To(Equal(202))
+
+				var gItem structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/form-1", nil, &gItem)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(gItem.Item).To(Equal("Buy milk"))
+				Expect(gItem.Priority).To(Equal(2))
+				Expect(gItem.Due.UTC()).To(Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+				Expect(gItem.Projects).To(Equal([]string{"shopping", "home", "errands"}))
+
+				resp, _ = testRawRequest(ts, "PUT", "/todolist/form-1", "application/x-www-form-urlencoded; charset=UTF-8", "item=Buy+oat+milk&priority=1&status=completed")
+				Expect(resp.StatusCode).To(Equal(202))
+				resp = testRequest(ts, "GET", "/todolist/form-1", nil, &gItem)
+				Expect(gItem.Item).To(Equal("Buy oat milk"))
+				Expect(gItem.IsCompleted()).To(BeTrue())
+
+				resp, body := testRawRequest(ts, "POST", "/todolist", "application/x-www-form-urlencoded", "id=form-2&item=Buy+eggs&priority=soon&colour=red")
+				Expect(resp.StatusCode).To(Equal(400))
+				var errs structs.ValidationError
+				Expect(json.Unmarshal([]byte(body), &errs)).To(Succeed())
+				Expect(errs.Errors).To(HaveLen(2))
+				Expect(errs.Errors[0]).To(HaveField("Code", structs.CodeUnknownField))
+				Expect(errs.Errors[1]).To(HaveField("Code", structs.CodeInvalidType))
+			})
+
+			Specify("Malformed bodies are reported in their own media type", func() {
+				resp, body := testRawRequest(ts, "POST", "/todolist", "application/yaml", "item: [unclosed")
+				Expect(resp.StatusCode).To(Equal(400))
+				Expect(body).To(ContainSubstring(`"code":"malformed"`))
+				Expect(body).To(ContainSubstring("not valid YAML"))
+
+				resp, body = testRawRequest(ts, "POST", "/todolist", "application/yaml", "id: a\n---\nid: b\n")
+				Expect(resp.StatusCode).To(Equal(400))
+				Expect(body).To(ContainSubstring(`"code":"trailing_data"`))
+			})
+
+			DescribeTable("Unsupported media types are refused",
+				func(method, path, contentType, accept string, status int) {
+					resp, _ := testRawRequest(ts, method, path, contentType, `{"id":"media-1","item":"Refused","priority":1}`, "Accept", accept)
+					Expect(resp.StatusCode).To(Equal(status))
+					if status == 415 {
+						Expect(resp.Header.Get("Accept")).To(ContainSubstring("application/yaml"))
+					}
+
+					var items structs.TodoItemList
+					testRequest(ts, "GET", "/todolist", nil, &items)
+					Expect(items.Count).To(Equal(0))
+				},
+				Entry("XML item", "POST", "/todolist", "application/xml", "", 415),
+				Entry("malformed Content-Type", "PUT", "/todolist/media-1", "application/", "", 415),
+				Entry("XML import", "POST", "/todolist/import", "application/xml", "", 415),
+				Entry("form import", "POST", "/todolist/import", "application/x-www-form-urlencoded", "", 415),
+				Entry("HTML list", "GET", "/todolist", "", "text/html", 406),
+				Entry("form list", "GET", "/todolist", "", "application/x-www-form-urlencoded", 406),
+				Entry("explicitly refused JSON", "GET", "/todolist", "", "application/json;q=0", 406),
+				Entry("import result as HTML", "POST", "/todolist/import", "application/json", "text/html", 406),
+			)
+
+			DescribeTable("Responses are negotiated from Accept",
+				func(accept, expected string) {
+					resp, _ := testRawRequest(ts, "GET", "/todolist", "", "", "Accept", accept)
+					Expect(resp.StatusCode).To(Equal(200))
+					Expect(resp.Header.Get("Content-Type")).To(HavePrefix(expected))
+				},
+				Entry("no preference", "*/*", "application/json"),
+				Entry("type wildcard", "application/*", "application/json"),
+				Entry("HTML with fallback", "text/html, application/json;q=0.5", "application/json"),
+				Entry("YAML alias", "text/yaml", "application/yaml"),
+				Entry("YAML preferred over wildcard", "*/*;q=0.1, application/yaml", "application/yaml"),
+				Entry("specific range overrides wildcard", "application/*;q=0.9, application/json;q=0.2", "application/yaml"),
+			)
+
+			Specify("Lists are imported and exported as YAML", func() {
+				const list = "- id: yaml-2\n  item: Plan trip\n  priority: 1\n- item: Pack\n"
+				resp, body := testRawRequest(ts, "POST", "/todolist/import", "application/yaml", list, "Accept", "application/yaml")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(body).To(ContainSubstring("created: 2\n"))
+
+				resp, body = testRawRequest(ts, "GET", "/todolist/export?format=yaml", "", "")
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("Content-Disposition")).To(ContainSubstring("todolist.yaml"))
+				Expect(body).To(HavePrefix("Items:\n  - id: yaml-2\n    item: Plan trip\n"))
+				Expect(body).To(ContainSubstring("    item: Pack\n    priority: 2\n"))
+			})
+		})
 	})
 })
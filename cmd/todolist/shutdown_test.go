@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"go.altair.com/todolist/pkg/config"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("Shutdown tests", func() {
+	var listener net.Listener
+	var started, release chan struct{}
+	var router *chi.Mux
+	var stopServing context.CancelFunc
+	var served chan error
+
+	serve := func() {
+		ctx, stop := context.WithCancel(context.Background())
+		stopServing = stop
+		server := newHTTPServer(router)
+		served = make(chan error, 1)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			served <- serveHTTP(ctx, server, listener)
+		}()
+		// the server reads cfg, so must have stopped before it is reset
+		DeferCleanup(func() {
+			stop()
+			<-done
+		})
+	}
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		// the handler may outlive the spec, so keeps its own channels
+		start, finish := make(chan struct{}), make(chan struct{})
+		started, release = start, finish
+		router = newRouter()
+		router.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+			close(start)
+			<-finish
+			_, _ = io.WriteString(w, "done")
+		})
+
+		DeferCleanup(func() {
+			cfg = config.Defaults()
+		})
+	})
+
+	Specify("In-flight requests finish while new connections are refused", func() {
+		serve()
+
+		type result struct {
+			body string
+			err  error
+		}
+		responses := make(chan result, 1)
+		go func() {
+			resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+			if err != nil {
+				responses <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			responses <- result{body: string(body), err: err}
+		}()
+		Eventually(started).Should(BeClosed())
+
+		stopServing()
+		Eventually(func() error {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}).Should(HaveOccurred())
+		Consistently(served, 100*time.Millisecond).ShouldNot(Receive())
+
+		close(release)
+		var resp result
+		Eventually(responses).Should(Receive(&resp))
+		Expect(resp.err).NotTo(HaveOccurred())
+		Expect(resp.body).To(Equal("done"))
+		Eventually(served).Should(Receive(BeNil()))
+	})
+
+	Specify("Nothing is left serving when a listener cannot be opened", func() {
+		defer listener.Close()
+		cfg.DB.Path = filepath.Join(GinkgoT().TempDir(), "todolist.db")
+		cfg.Server.GRPCBind = "127.0.0.1:0"
+		free, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		cfg.Server.Bind = free.Addr().String()
+		Expect(free.Close()).To(Succeed())
+		// the spec's listener holds the admin address
+		cfg.Server.AdminBind = listener.Addr().String()
+
+		var logs bytes.Buffer
+		logger := log.Logger
+		log.Logger = zerolog.New(&logs)
+		defer func() {
+			log.Logger = logger
+		}()
+
+		Expect(doServe(serveCmd, nil)).To(MatchError(ContainSubstring("address already in use")))
+		Expect(logs.String()).To(ContainSubstring("Failed to listen for admin requests"))
+		Expect(logs.String()).NotTo(ContainSubstring("Listening for"), "no server was started")
+		again, err := net.Listen("tcp", cfg.Server.Bind)
+		Expect(err).NotTo(HaveOccurred(), "the API listener is closed")
+		Expect(again.Close()).To(Succeed())
+	})
+
+	Specify("Requests still running after the shutdown timeout are cut off", func() {
+		cfg.Server.ShutdownTimeout = 50 * time.Millisecond
+		serve()
+		defer close(release)
+
+		errs := make(chan error, 1)
+		go func() {
+			resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			errs <- err
+		}()
+		Eventually(started).Should(BeClosed())
+
+		stopServing()
+		Eventually(served).Should(Receive(MatchError(ContainSubstring("did not finish in 50ms"))))
+		Eventually(errs).Should(Receive(HaveOccurred()))
+	})
+
+	Specify("Event streams end when the broker closes", func() {
+		broker := todolist.NewBroker()
+		(&todolist.ItemsHandlers{Events: broker}).ConfigureRoutes(router)
+		serve()
+
+		resp, err := http.Get("http://" + listener.Addr().String() + "/todolist/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		stopServing()
+		broker.Close()
+		_, err = io.ReadAll(bufio.NewReader(resp.Body))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(served).Should(Receive(BeNil()))
+	})
+
+	Specify("Event streams outlive the request timeout", func() {
+		cfg.Server.RequestTimeout = 50 * time.Millisecond
+		router = newRouter()
+		broker := todolist.NewBroker()
+		(&todolist.ItemsHandlers{Events: broker}).ConfigureRoutes(router)
+		(&todolist.GraphQLHandlers{Events: broker}).ConfigureRoutes(router)
+		serve()
+		defer stopServing()
+		defer broker.Close()
+
+		feed, err := http.Get("http://" + listener.Addr().String() + "/todolist/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer feed.Body.Close()
+		Expect(feed.StatusCode).To(Equal(http.StatusOK))
+
+		req, err := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+"/graphql",
+			strings.NewReader(`{"query": "subscription { itemChanged { itemId } }"}`))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", todolist.MediaTypeJSON)
+		req.Header.Set("Accept", "text/event-stream")
+		subscription, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer subscription.Body.Close()
+		Expect(subscription.StatusCode).To(Equal(http.StatusOK))
+
+		time.Sleep(4 * cfg.Server.RequestTimeout)
+		Expect(broker.Publish(context.Background(), store.Event{
+			Id:           1,
+			Topic:        todolist.EventItemCreated,
+			Aggregate_id: "a",
+			Payload:      []byte(`{"id": "a", "item": "Wash car", "priority": 1}`),
+		})).To(Succeed())
+
+		line, err := bufio.NewReader(feed.Body).ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("id: 1\n"))
+		line, err = bufio.NewReader(subscription.Body).ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("event: next\n"))
+	})
+})
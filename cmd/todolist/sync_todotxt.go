@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+
+	"github.com/spf13/cobra"
+)
+
+var syncTodoTxtCmd = &cobra.Command{
+	Use:   "sync-todotxt <file>",
+	Short: "Reconciles a todo.txt file with the database",
+	Long: `Brings a todo.txt file and the database into agreement, then rewrites the file
+from the database, which is treated as the source of truth.
+
+  - lines without an id: tag are added to the database
+  - lines whose item changed since the database copy are written back to it,
+    when the file was modified after the item was last updated
+  - lines whose id is no longer in the database are dropped
+  - items missing from the file are kept, unless --prune is given and they
+    have not been updated since the file was last modified`,
+	Args: cobra.ExactArgs(1),
+	RunE: doSyncTodoTxt,
+}
+
+var (
+	syncPrune  bool
+	syncDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(syncTodoTxtCmd)
+	syncTodoTxtCmd.Flags().BoolVar(&syncPrune, "prune", false, "delete items that were removed from the file")
+	syncTodoTxtCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "report changes without touching the database or the file")
+}
+
+// todoTxtSync counts the changes made by a reconciliation.
+type todoTxtSync struct {
+	added, updated, dropped, pruned int
+}
+
+func doSyncTodoTxt(cmd *cobra.Command, args []string) error {
+	path := args[0]
+	ctx := context.Background()
+
+	format, err := todolist.LookupFormat(todolist.FormatTodoTxt)
+	if err != nil {
+		return err
+	}
+
+	var fileItems []structs.TodoItem
+	var modTime time.Time
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// first sync: the file is created from the database
+	case err != nil:
+		return err
+	default:
+		info, err := f.Stat()
+		if err == nil {
+			modTime = info.ModTime()
+			fileItems, err = format.Decode(f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	tododb, err := openDb()
+	if err != nil {
+		return err
+	}
+	defer tododb.Close()
+	todoService := todolist.NewItemsService(store.NewSqlStore(tododb))
+
+	result, err := reconcileTodoTxt(ctx, todoService, fileItems, modTime, syncPrune, syncDryRun)
+	if err != nil {
+		return err
+	}
+
+	summary := "synced"
+	if syncDryRun {
+		summary = "would sync"
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s %s: %d added, %d updated, %d dropped from file, %d pruned\n",
+		summary, path, result.added, result.updated, result.dropped, result.pruned)
+	if syncDryRun {
+		return nil
+	}
+
+	items, err := todoService.ListItems(ctx)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, func(f *os.File) error {
+		return format.Encode(f, items.Items)
+	})
+}
+
+func reconcileTodoTxt(ctx context.Context, svc todolist.ItemsService, fileItems []structs.TodoItem, modTime time.Time, prune bool, dryRun bool) (todoTxtSync, error) {
+	var result todoTxtSync
+
+	current, err := svc.ListItems(ctx)
+	if err != nil {
+		return result, err
+	}
+	known := make(map[string]*structs.TodoItem, current.Count)
+	for i := range current.Items {
+		known[current.Items[i].Id] = &current.Items[i]
+	}
+
+	var added []structs.TodoItem
+	inFile := make(map[string]bool, len(fileItems))
+	for i := range fileItems {
+		line := fileItems[i]
+		if line.Id == "" {
+			added = append(added, line)
+			continue
+		}
+		inFile[line.Id] = true
+
+		existing, ok := known[line.Id]
+		if !ok {
+			result.dropped++
+			continue
+		}
+		if todolist.FormatTodoTxtLine(&line) == todolist.FormatTodoTxtLine(existing) || !modTime.After(existing.Updated_at) {
+			continue
+		}
+
+		// keep what the file cannot express exactly
+		if line.Priority == 0 {
+			line.Priority = existing.Priority
+		}
+		if line.IsCompleted() && existing.Completed_at != nil && line.Completed_at != nil &&
+			line.Completed_at.Format("2006-01-02") == existing.Completed_at.UTC().Format("2006-01-02") {
+			line.Completed_at = existing.Completed_at
+		}
+		if err := line.Validate(); err != nil {
+			return result, fmt.Errorf("%s: %w", line.Id, err)
+		}
+		result.updated++
+		if !dryRun {
+			if err := svc.UpdateItem(ctx, &line); err != nil {
+				return result, fmt.Errorf("updating %s: %w", line.Id, err)
+			}
+		}
+	}
+
+	if len(added) > 0 {
+		imported, err := svc.ImportItems(ctx, added, structs.ImportOptions{DryRun: dryRun})
+		if err != nil {
+			return result, err
+		}
+		result.added = imported.Created
+	}
+
+	if prune && !modTime.IsZero() {
+		for _, item := range current.Items {
+			if inFile[item.Id] || item.Updated_at.After(modTime) {
+				continue
+			}
+			result.pruned++
+			if !dryRun {
+				if err := svc.DeleteItem(ctx, item.Id); err != nil {
+					return result, fmt.Errorf("deleting %s: %w", item.Id, err)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// writeFileAtomic replaces path with the output of write, so that readers
+// never see a partially written file.
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
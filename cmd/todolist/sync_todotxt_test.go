@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("todo.txt sync tests", func() {
+	var todoService todolist.ItemsService
+	var dir, todoFile string
+	ctx := context.Background()
+
+	runSync := func(extra ...string) string {
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetArgs(append([]string{"--db", filepath.Join(dir, "todolist.db"), "sync-todotxt", todoFile}, extra...))
+		Expect(rootCmd.Execute()).To(Succeed())
+		syncPrune, syncDryRun = false, false
+		return out.String()
+	}
+
+	readLines := func() []string {
+		data, err := os.ReadFile(todoFile)
+		Expect(err).NotTo(HaveOccurred())
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		todoFile = filepath.Join(dir, "todo.txt")
+		tododb, err := sqlitedb.OpenDb(filepath.Join(dir, "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+		todoService = todolist.NewItemsService(store.NewSqlStore(tododb))
+	})
+
+	Specify("New lines are added and the file gains ids", func() {
+		Expect(os.WriteFile(todoFile, []byte(
+			"(A) Call mum +family @phone\n"+
+				"x 2024-01-05 2024-01-01 File taxes due:2024-01-31 pri:B\n"+
+				"Buy milk @shops store:corner\n"), 0o644)).To(Succeed())
+
+		Expect(runSync()).To(ContainSubstring("3 added"))
+
+		items, err := todoService.ListItems(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items.Count).To(Equal(3))
+		Expect(items.Items[0].Item).To(Equal("Call mum"))
+		Expect(items.Items[0].Projects).To(Equal([]string{"family"}))
+		Expect(items.Items[0].Contexts).To(Equal([]string{"phone"}))
+		Expect(items.Items[1].Status).To(Equal(structs.StatusCompleted))
+		Expect(items.Items[1].Priority).To(Equal(2))
+		Expect(items.Items[1].Due.UTC()).To(Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)))
+		Expect(items.Items[2].Attributes).To(Equal(map[string]string{"store": "corner"}))
+
+		lines := readLines()
+		Expect(lines).To(HaveLen(3))
+		Expect(lines[0]).To(MatchRegexp(`^\(A\) \d{4}-\d{2}-\d{2} Call mum \+family @phone id:\S+$`))
+		Expect(lines[1]).To(HavePrefix("x 2024-01-05 "))
+		Expect(lines[1]).To(ContainSubstring("due:2024-01-31 pri:B id:"))
+
+		Expect(runSync()).To(ContainSubstring("0 added, 0 updated"))
+		Expect(readLines()).To(Equal(lines))
+	})
+
+	Specify("Edits in the file are written back and deletions are pruned", func() {
+		Expect(os.WriteFile(todoFile, []byte("(A) Wash car\n(B) Fix bike\n"), 0o644)).To(Succeed())
+		runSync()
+		lines := readLines()
+
+		edited := strings.Replace(lines[0], "(A) ", "x 2024-02-01 ", 1)
+		future := time.Now().Add(time.Minute)
+		Expect(os.WriteFile(todoFile, []byte(edited+"\n"), 0o644)).To(Succeed())
+		Expect(os.Chtimes(todoFile, future, future)).To(Succeed())
+
+		Expect(runSync("--prune")).To(ContainSubstring("0 added, 1 updated, 0 dropped from file, 1 pruned"))
+
+		items, err := todoService.ListItems(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items.Count).To(Equal(1))
+		Expect(items.Items[0].Item).To(Equal("Wash car"))
+		Expect(items.Items[0].Priority).To(Equal(1))
+		Expect(items.Items[0].IsCompleted()).To(BeTrue())
+	})
+})
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.altair.com/todolist/pkg/config"
+	"go.altair.com/todolist/pkg/todolist"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64
+
+func newTestCA() *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	serial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "todolist test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for name, usable by servers on
+// 127.0.0.1 and by clients.
+func (ca *testCA) issue(name string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+var _ = Describe("TLS tests", func() {
+	var ca *testCA
+	var dir, addr string
+	var tlsSettings config.TLS
+
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+		return path
+	}
+
+	// client makes a client trusting the test CA, presenting a certificate
+	// for name if one is given.
+	client := func(name string) *http.Client {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		tlsConfig := &tls.Config{RootCAs: pool}
+		if name != "" {
+			certPEM, keyPEM := ca.issue(name)
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			Expect(err).NotTo(HaveOccurred())
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+	}
+
+	serve := func() {
+		tlsConfig, err := newTLSConfig(tlsSettings)
+		Expect(err).NotTo(HaveOccurred())
+
+		router := newRouter()
+		router.Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := todolist.ClientIdentityFrom(r.Context())
+			if !ok {
+				_, _ = io.WriteString(w, "anonymous")
+				return
+			}
+			_, _ = io.WriteString(w, identity.Name())
+		})
+		srv := newHTTPServer(router)
+		srv.TLSConfig = tlsConfig
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		addr = listener.Addr().String()
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() {
+			served <- serveHTTP(ctx, srv, listener)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(served).Should(Receive(BeNil()))
+		})
+	}
+
+	get := func(c *http.Client, path string) (*http.Response, string, error) {
+		resp, err := c.Get("https://" + addr + path)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, string(body), err
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		ca = newTestCA()
+		certPEM, keyPEM := ca.issue("server one")
+		tlsSettings = config.Defaults().TLS
+		tlsSettings.Cert = writeFile("server.crt", certPEM)
+		tlsSettings.Key = writeFile("server.key", keyPEM)
+	})
+
+	Specify("Requests are served over TLS", func() {
+		serve()
+		resp, body, err := get(client(""), "/whoami")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(Equal("anonymous"))
+		Expect(resp.TLS.PeerCertificates[0].Subject.CommonName).To(Equal("server one"))
+	})
+
+	Specify("Changed certificates are picked up by new connections", func() {
+		serve()
+		certPEM, keyPEM := ca.issue("server two")
+		// make sure the modification times differ on coarse filesystems
+		later := time.Now().Add(time.Second)
+		writeFile("server.crt", certPEM)
+		writeFile("server.key", keyPEM)
+		Expect(os.Chtimes(tlsSettings.Cert, later, later)).To(Succeed())
+		Expect(os.Chtimes(tlsSettings.Key, later, later)).To(Succeed())
+
+		resp, _, err := get(client(""), "/whoami")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.TLS.PeerCertificates[0].Subject.CommonName).To(Equal("server two"))
+	})
+
+	Specify("A broken certificate is not swapped in", func() {
+		serve()
+		writeFile("server.crt", []byte("not a certificate"))
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(tlsSettings.Cert, later, later)).To(Succeed())
+
+		resp, _, err := get(client(""), "/whoami")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.TLS.PeerCertificates[0].Subject.CommonName).To(Equal("server one"))
+	})
+
+	Context("With client certificates", func() {
+		BeforeEach(func() {
+			tlsSettings.ClientCA = writeFile("clients.crt", ca.pem)
+		})
+
+		Specify("Clients are identified by their certificates", func() {
+			serve()
+			_, body, err := get(client("alice"), "/whoami")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(Equal("alice"))
+		})
+
+		Specify("Clients without certificates are turned away", func() {
+			serve()
+			_, _, err := get(client(""), "/whoami")
+			Expect(err).To(HaveOccurred())
+		})
+
+		Specify("Certificates from other CAs are rejected", func() {
+			serve()
+			other := newTestCA()
+			certPEM, keyPEM := other.issue("mallory")
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			Expect(err).NotTo(HaveOccurred())
+			c := client("")
+			c.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+			_, _, err = get(c, "/whoami")
+			Expect(err).To(HaveOccurred())
+		})
+
+		Specify("Certificates can be made optional", func() {
+			tlsSettings.ClientAuth = "optional"
+			serve()
+			_, body, err := get(client(""), "/whoami")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(Equal("anonymous"))
+			_, body, err = get(client("bob"), "/whoami")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(Equal("bob"))
+		})
+	})
+
+	DescribeTable("Plain HTTP is redirected to HTTPS",
+		func(httpsAddr, host, target string) {
+			req := httptest.NewRequest(http.MethodPost, "http://"+host+"/todolist/?format=yaml", nil)
+			w := httptest.NewRecorder()
+			redirectToHTTPS(httpsAddr).ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusPermanentRedirect))
+			Expect(w.Header().Get("Location")).To(Equal(target))
+		},
+		Entry("to a custom port", "0.0.0.0:8443", "todo.example:8080", "https://todo.example:8443/todolist/?format=yaml"),
+		Entry("to the default port", ":443", "todo.example", "https://todo.example/todolist/?format=yaml"),
+		Entry("for IPv6 hosts", "[::]:8443", "[::1]:8080", "https://[::1]:8443/todolist/?format=yaml"),
+	)
+})
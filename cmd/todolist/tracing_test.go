@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.altair.com/todolist/pkg/client"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var (
+	// spans records every span made in the suite. Tracers taken before the
+	// global provider is first set only follow that first provider, so it
+	// is set once.
+	spans         = tracetest.NewSpanRecorder()
+	setupRecorder sync.Once
+)
+
+// spansOf returns the ended spans in a trace, by name.
+func spansOf(traceId trace.TraceID) map[string]sdktrace.ReadOnlySpan {
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID() == traceId {
+			byName[span.Name()] = span
+		}
+	}
+	return byName
+}
+
+var _ = Describe("Tracing tests", func() {
+	var ts *httptest.Server
+
+	BeforeEach(func() {
+		setupRecorder.Do(func() {
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+		})
+
+		ts = httptest.NewServer(testRouter(todolist.NewItemsService(testStore())))
+		DeferCleanup(ts.Close)
+	})
+
+	Specify("Requests continue the caller's trace through the service and store", func() {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/todolist/missing", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+		traceId, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		byName := spansOf(traceId)
+		Expect(byName).To(HaveKey("GET /todolist/{id}"))
+		request := byName["GET /todolist/{id}"]
+		Expect(request.Parent().SpanID().String()).To(Equal("00f067aa0ba902b7"))
+		Expect(request.SpanKind()).To(Equal(trace.SpanKindServer))
+		Expect(request.Attributes()).To(ContainElement(HaveField("Key", BeEquivalentTo("http.response.status_code"))))
+
+		Expect(byName).To(HaveKey("ItemsService.GetItem"))
+		service := byName["ItemsService.GetItem"]
+		Expect(service.Parent().SpanID()).To(Equal(request.SpanContext().SpanID()))
+		Expect(service.Events()).To(HaveLen(1), "the error is recorded")
+
+		Expect(byName).To(HaveKey("SELECT"))
+		statement := byName["SELECT"]
+		Expect(statement.Parent().SpanID()).To(Equal(service.SpanContext().SpanID()))
+		Expect(statement.Attributes()).To(ContainElement(HaveField("Key", BeEquivalentTo("db.query.text"))))
+	})
+
+	Specify("The client sends its trace to the server", func() {
+		ctx, span := otel.Tracer("test").Start(context.Background(), "caller")
+		c := client.New(ts.URL)
+		Expect(c.AddItem(ctx, &structs.TodoItem{Id: "one", Item: "Wash car", Priority: 1})).To(Succeed())
+		span.End()
+
+		byName := spansOf(span.SpanContext().TraceID())
+		Expect(byName).To(HaveKey("POST /todolist"))
+		Expect(byName["POST /todolist"].Parent().SpanID()).To(Equal(span.SpanContext().SpanID()))
+		Expect(byName).To(HaveKey("ItemsService.AddItem"))
+		Expect(byName).To(HaveKey("INSERT"))
+	})
+
+	Specify("Statements run outside a trace make no spans", func() {
+		todostore := testStore()
+		before := len(spans.Ended())
+		Expect(todostore.View(func(tx store.Txn) error {
+			var items structs.TodoItemList
+			return tx.List(context.Background(), &items)
+		})).To(Succeed())
+		Expect(spans.Ended()).To(HaveLen(before))
+	})
+
+	Specify("Log lines carry the ids of the current span", func() {
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf).Hook(traceHook{})
+		ctx, span := otel.Tracer("test").Start(context.Background(), "logging")
+		defer span.End()
+
+		logger.Info().Ctx(ctx).Msg("traced")
+		logger.Info().Msg("untraced")
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+		Expect(string(lines[0])).To(ContainSubstring(`"trace_id":"` + span.SpanContext().TraceID().String() + `"`))
+		Expect(string(lines[0])).To(ContainSubstring(`"span_id":"` + span.SpanContext().SpanID().String() + `"`))
+		Expect(string(lines[1])).NotTo(ContainSubstring("trace_id"))
+	})
+})
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+const (
+	tuiPollInterval = 2 * time.Second
+	tuiWatchRetry   = 5 * time.Second
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Manages the list in a full-screen terminal interface",
+	Long: `Manages the list in a full-screen terminal interface, either on a running
+server or, with --local, directly in the database.
+
+  up/down, k/j        move the cursor
+  shift+up/shift+down move the selected item
+  a                   add an item at the end of the list
+  e                   edit the selected item
+  space               toggle whether the selected item is done
+  +/-                 raise or lower the selected item's priority
+  d                   delete the selected item
+  r                   refresh
+  q                   quit`,
+	Args: cobra.NoArgs,
+	RunE: doTui,
+}
+
+var tuiLocal bool
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+	addClientFlags(tuiCmd)
+	tuiCmd.Flags().BoolVar(&tuiLocal, "local", false, "use the database directly instead of a server")
+}
+
+func doTui(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	var service todolist.ItemsService
+	var poll time.Duration
+	var events <-chan structs.ItemEvent
+	var watch func(ctx context.Context) (<-chan structs.ItemEvent, error)
+	if tuiLocal {
+		tododb, err := openDb()
+		if err != nil {
+			return err
+		}
+		defer tododb.Close()
+		service = todolist.NewItemsService(store.NewSqlStore(tododb))
+		// other processes may share the database, and there is no feed to follow
+		poll = tuiPollInterval
+	} else {
+		client := newAPIClient()
+		service = client
+		var err error
+		if events, err = client.Watch(ctx); err == nil {
+			watch = client.Watch
+		} else {
+			log.Debug().Err(err).Msg("Event feed not available, polling instead")
+			poll = tuiPollInterval
+		}
+	}
+
+	program := tea.NewProgram(newTuiModel(ctx, service, poll), tea.WithAltScreen(), tea.WithContext(ctx))
+	if watch != nil {
+		go followEvents(ctx, program, events, watch)
+	}
+	_, err := program.Run()
+	if errors.Is(err, tea.ErrProgramKilled) && cmd.Context().Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// followEvents refreshes the list whenever the server reports a change,
+// reconnecting to the feed when it is lost.
+func followEvents(ctx context.Context, program *tea.Program, events <-chan structs.ItemEvent, watch func(ctx context.Context) (<-chan structs.ItemEvent, error)) {
+	for {
+		for range events {
+			program.Send(tuiRefreshMsg{})
+		}
+
+		var err error
+		for events, err = watch(ctx); err != nil; events, err = watch(ctx) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(tuiWatchRetry):
+			}
+		}
+		// catch up on anything missed while disconnected
+		program.Send(tuiRefreshMsg{})
+	}
+}
+
+type tuiMode int
+
+const (
+	tuiBrowsing tuiMode = iota
+	tuiAdding
+	tuiEditing
+)
+
+type tuiItemsMsg struct {
+	items []structs.TodoItem
+	err   error
+}
+
+type tuiRefreshMsg struct{}
+
+type tuiTickMsg struct{}
+
+// tuiModel is the bubbletea model behind the tui command. Every change is
+// made through the ItemsService and followed by a reload, so the screen
+// always shows what is stored.
+type tuiModel struct {
+	ctx     context.Context
+	service todolist.ItemsService
+	poll    time.Duration
+
+	items  []structs.TodoItem
+	cursor int
+	// selected keeps the cursor on the same item across reloads
+	selected string
+
+	mode  tuiMode
+	input []rune
+	err   error
+}
+
+func newTuiModel(ctx context.Context, service todolist.ItemsService, poll time.Duration) tuiModel {
+	return tuiModel{ctx: ctx, service: service, poll: poll}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.load(), m.tick())
+}
+
+func (m tuiModel) load() tea.Cmd {
+	return func() tea.Msg {
+		items, err := m.service.ListItems(m.ctx)
+		return tuiItemsMsg{items: items.Items, err: err}
+	}
+}
+
+func (m tuiModel) tick() tea.Cmd {
+	if m.poll <= 0 {
+		return nil
+	}
+	return tea.Tick(m.poll, func(time.Time) tea.Msg { return tuiTickMsg{} })
+}
+
+// change runs op against the service, then reloads the list.
+func (m tuiModel) change(op func(ctx context.Context) error) tea.Cmd {
+	return func() tea.Msg {
+		if err := op(m.ctx); err != nil {
+			return tuiItemsMsg{err: err}
+		}
+		return m.load()()
+	}
+}
+
+func (m tuiModel) current() (structs.TodoItem, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.items) {
+		return structs.TodoItem{}, false
+	}
+	return m.items[m.cursor], true
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tuiItemsMsg:
+		m.err = msg.err
+		if msg.err != nil {
+			return m, nil
+		}
+		m.items = msg.items
+		m.cursor = 0
+		for i, item := range m.items {
+			if item.Id == m.selected {
+				m.cursor = i
+			}
+		}
+		if item, ok := m.current(); ok {
+			m.selected = item.Id
+		}
+		return m, nil
+
+	case tuiRefreshMsg:
+		return m, m.load()
+
+	case tuiTickMsg:
+		return m, tea.Batch(m.load(), m.tick())
+
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if m.mode != tuiBrowsing {
+			return m.updateInput(msg)
+		}
+		return m.updateBrowsing(msg)
+	}
+	return m, nil
+}
+
+func (m tuiModel) updateBrowsing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	item, ok := m.current()
+
+	switch msg.String() {
+	case "q", "esc":
+		return m, tea.Quit
+
+	case "up", "k":
+		m.moveCursor(-1)
+
+	case "down", "j":
+		m.moveCursor(1)
+
+	case "shift+up", "K":
+		if ok && m.cursor > 0 {
+			// positions count from 1, so the position above is the cursor index
+			position := m.cursor
+			return m, m.change(func(ctx context.Context) error {
+				return m.service.MoveItem(ctx, item.Id, position)
+			})
+		}
+
+	case "shift+down", "J":
+		if ok && m.cursor < len(m.items)-1 {
+			position := m.cursor + 2
+			return m, m.change(func(ctx context.Context) error {
+				return m.service.MoveItem(ctx, item.Id, position)
+			})
+		}
+
+	case "a":
+		m.mode = tuiAdding
+		m.input = nil
+
+	case "e":
+		if ok {
+			m.mode = tuiEditing
+			m.input = []rune(item.Item)
+		}
+
+	case " ", "x":
+		if ok {
+			if item.IsCompleted() {
+				item.Status = structs.StatusNeedsAction
+			} else {
+				item.Status = structs.StatusCompleted
+			}
+			return m, m.change(func(ctx context.Context) error {
+				return m.service.UpdateItem(ctx, &item)
+			})
+		}
+
+	case "+":
+		if ok && item.Priority > 1 {
+			item.Priority--
+			return m, m.change(func(ctx context.Context) error {
+				return m.service.UpdateItem(ctx, &item)
+			})
+		}
+
+	case "-":
+		if ok {
+			item.Priority++
+			return m, m.change(func(ctx context.Context) error {
+				return m.service.UpdateItem(ctx, &item)
+			})
+		}
+
+	case "d", "delete":
+		if ok {
+			if m.cursor+1 < len(m.items) {
+				m.selected = m.items[m.cursor+1].Id
+			} else if m.cursor > 0 {
+				m.selected = m.items[m.cursor-1].Id
+			}
+			return m, m.change(func(ctx context.Context) error {
+				return m.service.DeleteItem(ctx, item.Id)
+			})
+		}
+
+	case "r":
+		return m, m.load()
+	}
+	return m, nil
+}
+
+func (m *tuiModel) moveCursor(delta int) {
+	m.cursor += delta
+	if m.cursor >= len(m.items) {
+		m.cursor = len(m.items) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	if item, ok := m.current(); ok {
+		m.selected = item.Id
+	}
+}
+
+func (m tuiModel) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = tuiBrowsing
+		m.input = nil
+		return m, nil
+
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+		return m, nil
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.input = append(m.input, msg.Runes...)
+		return m, nil
+
+	case tea.KeyEnter:
+	default:
+		return m, nil
+	}
+
+	text := strings.TrimSpace(string(m.input))
+	mode := m.mode
+	m.mode = tuiBrowsing
+	m.input = nil
+	if text == "" {
+		return m, nil
+	}
+
+	if mode == tuiAdding {
+		item := structs.TodoItem{Id: structs.NewItemId(), Item: text, Priority: 1}
+		for _, existing := range m.items {
+			if existing.Priority >= item.Priority {
+				item.Priority = existing.Priority + 1
+			}
+		}
+		m.selected = item.Id
+		return m, m.change(func(ctx context.Context) error {
+			return m.service.AddItem(ctx, &item)
+		})
+	}
+
+	item, ok := m.current()
+	if !ok {
+		return m, nil
+	}
+	item.Item = text
+	return m, m.change(func(ctx context.Context) error {
+		return m.service.UpdateItem(ctx, &item)
+	})
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+	b.WriteString(description + "\n\n")
+
+	if len(m.items) == 0 {
+		b.WriteString("  No items.\n")
+	}
+	for i, item := range m.items {
+		cursor := " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		done := " "
+		if item.IsCompleted() {
+			done = "x"
+		}
+		text := item.Item
+		if i == m.cursor && m.mode == tuiEditing {
+			text = string(m.input) + "_"
+		}
+		for _, project := range item.Projects {
+			text += " +" + project
+		}
+		for _, context := range item.Contexts {
+			text += " @" + context
+		}
+		if item.Due != nil {
+			text += " due:" + formatDate(item.Due)
+		}
+		fmt.Fprintf(&b, "%s [%s] %3d  %s\n", cursor, done, item.Priority, text)
+	}
+
+	b.WriteString("\n")
+	switch m.mode {
+	case tuiAdding:
+		fmt.Fprintf(&b, "New item: %s_\n", string(m.input))
+		b.WriteString("enter save • esc cancel\n")
+	case tuiEditing:
+		b.WriteString("enter save • esc cancel\n")
+	default:
+		b.WriteString("a add • e edit • space done • +/- priority • shift+↑/↓ move • d delete • q quit\n")
+	}
+	if m.err != nil {
+		fmt.Fprintf(&b, "\nError: %v\n", m.err)
+	}
+	return b.String()
+}
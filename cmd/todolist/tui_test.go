@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("Terminal UI tests", func() {
+	var service todolist.ItemsService
+	var model tuiModel
+
+	// send delivers msg to the model, running any command it returns as
+	// bubbletea would and feeding the result back in
+	var send func(msg tea.Msg)
+	send = func(msg tea.Msg) {
+		next, cmd := model.Update(msg)
+		model = next.(tuiModel)
+		if cmd == nil {
+			return
+		}
+		if result := cmd(); result != nil {
+			if _, quit := result.(tea.QuitMsg); !quit {
+				send(result)
+			}
+		}
+	}
+
+	key := func(keys ...string) {
+		for _, k := range keys {
+			switch k {
+			case "enter":
+				send(tea.KeyMsg{Type: tea.KeyEnter})
+			case "esc":
+				send(tea.KeyMsg{Type: tea.KeyEsc})
+			case "backspace":
+				send(tea.KeyMsg{Type: tea.KeyBackspace})
+			case "up":
+				send(tea.KeyMsg{Type: tea.KeyUp})
+			case "down":
+				send(tea.KeyMsg{Type: tea.KeyDown})
+			case "shift+up":
+				send(tea.KeyMsg{Type: tea.KeyShiftUp})
+			case "shift+down":
+				send(tea.KeyMsg{Type: tea.KeyShiftDown})
+			case " ":
+				send(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+			default:
+				send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+			}
+		}
+	}
+
+	texts := func() []string {
+		var texts []string
+		for _, item := range model.items {
+			texts = append(texts, item.Item)
+		}
+		return texts
+	}
+
+	BeforeEach(func() {
+		tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+
+		service = todolist.NewItemsService(store.NewSqlStore(tododb))
+		model = newTuiModel(context.Background(), service, 0)
+		send(model.load()())
+	})
+
+	Specify("Items are added and edited inline", func() {
+		key("a", "Wash car", "enter", "a", "Fix bike", "enter")
+		Expect(texts()).To(Equal([]string{"Wash car", "Fix bike"}))
+		Expect(model.items[1].Priority).To(Equal(2))
+		Expect(model.cursor).To(Equal(1))
+
+		key("up", "e", "backspace", "backspace", "backspace", "bus", "enter")
+		Expect(model.err).NotTo(HaveOccurred())
+		Expect(texts()).To(Equal([]string{"Wash bus", "Fix bike"}))
+
+		// escape abandons the edit
+		key("e", "!!!", "esc")
+		Expect(texts()).To(Equal([]string{"Wash bus", "Fix bike"}))
+
+		items, err := service.ListItems(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items.Items[0].Item).To(Equal("Wash bus"))
+	})
+
+	Specify("Items are reordered with shift and the arrow keys", func() {
+		key("a", "one", "enter", "a", "two", "enter", "a", "three", "enter")
+		Expect(model.cursor).To(Equal(2))
+
+		key("shift+up", "shift+up")
+		Expect(texts()).To(Equal([]string{"three", "one", "two"}))
+		Expect(model.cursor).To(Equal(0))
+
+		key("down", "shift+down")
+		Expect(texts()).To(Equal([]string{"three", "two", "one"}))
+		Expect(model.cursor).To(Equal(2))
+	})
+
+	Specify("Items are completed, reprioritised and deleted", func() {
+		key("a", "one", "enter", "a", "two", "enter")
+
+		key(" ")
+		Expect(model.items[1].IsCompleted()).To(BeTrue())
+		Expect(model.items[1].Completed_at).NotTo(BeNil())
+		Expect(model.View()).To(ContainSubstring("> [x]   2  two"))
+		key(" ")
+		Expect(model.items[1].IsCompleted()).To(BeFalse())
+
+		key("-")
+		Expect(model.items[1].Priority).To(Equal(3))
+		key("+")
+		Expect(model.items[1].Priority).To(Equal(2))
+
+		key("d")
+		Expect(texts()).To(Equal([]string{"one"}))
+		Expect(model.cursor).To(Equal(0))
+		key("d")
+		Expect(model.items).To(BeEmpty())
+		Expect(model.View()).To(ContainSubstring("No items."))
+	})
+
+	Specify("Changes made elsewhere appear on refresh", func() {
+		Expect(service.AddItem(context.Background(), &structs.TodoItem{Id: structs.NewItemId(), Item: "Elsewhere", Priority: 1})).To(Succeed())
+		Expect(model.items).To(BeEmpty())
+
+		send(tuiRefreshMsg{})
+		Expect(texts()).To(Equal([]string{"Elsewhere"}))
+		Expect(strings.Count(model.View(), "Elsewhere")).To(Equal(1))
+	})
+})
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"runtime"
+	buildinfo "runtime/debug"
+)
+
+// version, commit and buildTime are set when building, as the Makefile does
+// with -ldflags "-X main.version=...". Builds without them take the commit
+// and its time from what the go command recorded in the binary.
+var (
+	version   = "dev"
+	commit    string
+	buildTime string
+)
+
+func init() {
+	rootCmd.Version = version
+}
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo describes the running binary.
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	if bi, ok := buildinfo.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
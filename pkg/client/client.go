@@ -0,0 +1,282 @@
+// Package client is a Go client for the todolist REST API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 100 * time.Millisecond
+)
+
+var (
+	ErrBadRequest  = errors.New("bad request")
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrServer      = errors.New("server error")
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// Error is returned for any response with a non-2xx status. It matches the
+// sentinel errors above with errors.Is according to its status code.
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+	// Fields lists the problems the server found with the request, if it
+	// was rejected as invalid.
+	Fields []structs.FieldError
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusBadGateway ||
+			e.StatusCode == http.StatusGatewayTimeout || e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// Client calls a todolist server. Its methods mirror todolist.ItemsService,
+// so it can be used wherever the service is. Idempotent calls are retried
+// on network errors and on responses indicating the server is unavailable.
+type Client struct {
+	BaseURL      string
+	HTTPClient   *http.Client
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		HTTPClient:   &http.Client{Timeout: defaultTimeout},
+		MaxRetries:   defaultMaxRetries,
+		RetryBackoff: defaultRetryBackoff,
+	}
+}
+
+func (c *Client) AddItem(ctx context.Context, item *structs.TodoItem) error {
+	return c.do(ctx, http.MethodPost, "/todolist", item, nil)
+}
+
+func (c *Client) DeleteItem(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, itemPath(id), nil, nil)
+}
+
+func (c *Client) UpdateItem(ctx context.Context, item *structs.TodoItem) error {
+	return c.do(ctx, http.MethodPut, itemPath(item.Id), item, nil)
+}
+
+func (c *Client) GetItem(ctx context.Context, id string) (*structs.TodoItem, error) {
+	var item structs.TodoItem
+	if err := c.do(ctx, http.MethodGet, itemPath(id), nil, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (c *Client) ListItems(ctx context.Context) (structs.TodoItemList, error) {
+	var items structs.TodoItemList
+	err := c.do(ctx, http.MethodGet, "/todolist", nil, &items)
+	return items, err
+}
+
+// ImportItems sends items to the import endpoint as JSON.
+func (c *Client) ImportItems(ctx context.Context, items []structs.TodoItem, opts structs.ImportOptions) (structs.ImportResult, error) {
+	query := url.Values{}
+	query.Set("format", "json")
+	query.Set("dry_run", strconv.FormatBool(opts.DryRun))
+	if opts.Conflict != "" {
+		query.Set("conflict", opts.Conflict)
+	}
+
+	var result structs.ImportResult
+	err := c.do(ctx, http.MethodPost, "/todolist/import?"+query.Encode(), items, &result)
+	return result, err
+}
+
+func (c *Client) MoveItem(ctx context.Context, id string, position int) error {
+	return c.do(ctx, http.MethodPost, itemPath(id)+"/move", structs.MoveRequest{Position: position}, nil)
+}
+
+func itemPath(id string) string {
+	return "/todolist/" + url.PathEscape(id)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// do sends body as JSON, decoding a JSON response into out if it is not nil.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	attempts := 1
+	if idempotent(method) && c.MaxRetries > 0 {
+		attempts += c.MaxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			backoff := c.RetryBackoff << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		var retry bool
+		retry, err = c.attempt(ctx, method, path, data, out)
+		if !retry || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// attempt makes a single request, reporting whether a failure is worth
+// retrying.
+func (c *Client) attempt(ctx context.Context, method, path string, data []byte, out interface{}) (bool, error) {
+	var reqBody io.Reader
+	if data != nil {
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reqBody)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	// continue the caller's trace on the server
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		apiErr := &Error{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+		var invalid structs.ValidationError
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") && json.Unmarshal(msg, &invalid) == nil {
+			apiErr.Fields = invalid.Errors
+			apiErr.Message = invalid.Error()
+		}
+		return errors.Is(apiErr, ErrUnavailable), apiErr
+	}
+
+	if out != nil {
+		return false, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return false, nil
+}
+
+// Watch follows the server's event feed, returning a channel of item events
+// that is closed when ctx is cancelled or the connection is lost. Callers
+// wanting a continuous feed should call Watch again after it closes.
+func (c *Client) Watch(ctx context.Context) (<-chan structs.ItemEvent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/todolist/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// the feed is long-lived, so the client's overall timeout cannot apply
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{Method: http.MethodGet, Path: "/todolist/events", StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	events := make(chan structs.ItemEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		var data strings.Builder
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "data:") {
+				data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+				continue
+			}
+			if line != "" || data.Len() == 0 {
+				continue
+			}
+
+			var event structs.ItemEvent
+			err := json.Unmarshal([]byte(data.String()), &event)
+			data.Reset()
+			if err != nil {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
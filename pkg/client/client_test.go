@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var testingT *testing.T
+
+func TestTodoClient(t *testing.T) {
+	testingT = t
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "client suite")
+}
+
+// the client must be usable wherever the service is
+var _ todolist.ItemsService = (*Client)(nil)
+
+var _ = Describe("Client tests", func() {
+	var ts *httptest.Server
+	var client *Client
+	var ctx context.Context
+	var requests atomic.Int32
+	var failures atomic.Int32
+	var relay *store.Relay
+
+	BeforeEach(func() {
+		tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+
+		todostore := store.NewSqlStore(tododb)
+		broker := todolist.NewBroker()
+		relay = store.NewRelay(todostore, broker)
+		handler := &todolist.ItemsHandlers{
+			ItemsService: todolist.NewItemsService(todostore),
+			Events:       broker,
+		}
+		router := chi.NewRouter()
+		// fail the next few requests to exercise retries
+		router.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				if failures.Add(-1) >= 0 {
+					http.Error(w, "try again", http.StatusServiceUnavailable)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		})
+		handler.ConfigureRoutes(router)
+		ts = httptest.NewServer(router)
+		DeferCleanup(ts.Close)
+
+		requests.Store(0)
+		failures.Store(0)
+		client = New(ts.URL)
+		client.RetryBackoff = time.Millisecond
+		ctx = context.Background()
+	})
+
+	Specify("Items can be managed through the client", func() {
+		item := structs.TodoItem{Id: structs.NewItemId(), Item: "Wash car", Priority: 1}
+		Expect(client.AddItem(ctx, &item)).To(Succeed())
+		second := structs.TodoItem{Id: structs.NewItemId(), Item: "Fix bike", Priority: 2}
+		Expect(client.AddItem(ctx, &second)).To(Succeed())
+
+		got, err := client.GetItem(ctx, item.Id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Item).To(Equal("Wash car"))
+
+		got.Status = structs.StatusCompleted
+		Expect(client.UpdateItem(ctx, got)).To(Succeed())
+		Expect(client.MoveItem(ctx, second.Id, 1)).To(Succeed())
+
+		items, err := client.ListItems(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items.Count).To(Equal(2))
+		Expect(items.Items[0].Id).To(Equal(second.Id))
+		Expect(items.Items[1].IsCompleted()).To(BeTrue())
+
+		result, err := client.ImportItems(ctx, []structs.TodoItem{{Item: "Imported"}}, structs.ImportOptions{DryRun: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.DryRun).To(BeTrue())
+		Expect(result.Created).To(Equal(1))
+
+		Expect(client.DeleteItem(ctx, item.Id)).To(Succeed())
+		Expect(client.DeleteItem(ctx, second.Id)).To(Succeed())
+	})
+
+	Specify("HTTP statuses are mapped to typed errors", func() {
+		_, err := client.GetItem(ctx, "missing")
+		Expect(err).To(MatchError(ErrNotFound))
+		var apiErr *Error
+		Expect(err).To(BeAssignableToTypeOf(apiErr))
+
+		item := structs.TodoItem{Id: "duplicate", Item: "Once", Priority: 1}
+		Expect(client.AddItem(ctx, &item)).To(Succeed())
+		Expect(client.AddItem(ctx, &item)).To(MatchError(ErrConflict))
+
+		err = client.AddItem(ctx, &structs.TodoItem{Id: "invalid"})
+		Expect(err).To(MatchError(ErrBadRequest))
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Fields).To(HaveLen(2))
+		Expect(apiErr.Fields[0]).To(HaveField("Field", "item"))
+		Expect(apiErr.Fields[1]).To(HaveField("Code", structs.CodeOutOfRange))
+		Expect(apiErr.Message).To(Equal("item is required; priority must be at least 1"))
+		Expect(client.DeleteItem(ctx, "missing")).To(MatchError(ErrNotFound))
+	})
+
+	Specify("Idempotent calls are retried and others are not", func() {
+		failures.Store(2)
+		_, err := client.ListItems(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests.Load()).To(Equal(int32(3)))
+
+		requests.Store(0)
+		failures.Store(1)
+		err = client.AddItem(ctx, &structs.TodoItem{Id: "once", Item: "Once", Priority: 1})
+		Expect(err).To(MatchError(ErrUnavailable))
+		Expect(requests.Load()).To(Equal(int32(1)))
+
+		requests.Store(0)
+		failures.Store(10)
+		_, err = client.ListItems(ctx)
+		Expect(err).To(MatchError(ErrUnavailable))
+		Expect(requests.Load()).To(Equal(int32(1 + defaultMaxRetries)))
+	})
+
+	Specify("Retries stop when the context is cancelled", func() {
+		failures.Store(10)
+		client.RetryBackoff = time.Hour
+		cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		_, err := client.ListItems(cancelCtx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(requests.Load()).To(Equal(int32(1)))
+	})
+
+	Specify("Item events are followed from the server's feed", func() {
+		watchCtx, cancel := context.WithCancel(ctx)
+		events, err := client.Watch(watchCtx)
+		Expect(err).NotTo(HaveOccurred())
+
+		item := structs.TodoItem{Id: structs.NewItemId(), Item: "Wash car", Priority: 1}
+		Expect(client.AddItem(ctx, &item)).To(Succeed())
+		Expect(client.DeleteItem(ctx, item.Id)).To(Succeed())
+		Expect(relay.Flush(ctx)).To(Equal(2))
+
+		var event structs.ItemEvent
+		Eventually(events).Should(Receive(&event))
+		Expect(event.Topic).To(Equal(todolist.EventItemCreated))
+		Expect(event.Item_id).To(Equal(item.Id))
+		Expect(event.Item.Item).To(Equal("Wash car"))
+		Eventually(events).Should(Receive(&event))
+		Expect(event.Topic).To(Equal(todolist.EventItemDeleted))
+
+		cancel()
+		Eventually(events).Should(BeClosed())
+	})
+})
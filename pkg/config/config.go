@@ -0,0 +1,498 @@
+// Package config holds the server's settings, which are layered: defaults,
+// then a YAML or TOML file, then environment variables, then command-line
+// flags, each overriding the last.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"go.altair.com/todolist/pkg/logging"
+)
+
+// EnvPrefix starts the environment variable for each key, which is the key
+// in upper case with dots replaced by underscores, such as TODOLIST_DB_PATH
+// for db.path.
+const EnvPrefix = "TODOLIST_"
+
+type Config struct {
+	DB       DB       `yaml:"db" toml:"db" json:"db"`
+	Backup   Backup   `yaml:"backup" toml:"backup" json:"backup"`
+	Server   Server   `yaml:"server" toml:"server" json:"server"`
+	TLS      TLS      `yaml:"tls" toml:"tls" json:"tls"`
+	CORS     CORS     `yaml:"cors" toml:"cors" json:"cors"`
+	Limits   Limits   `yaml:"limits" toml:"limits" json:"limits"`
+	Log      Log      `yaml:"log" toml:"log" json:"log"`
+	Tracing  Tracing  `yaml:"tracing" toml:"tracing" json:"tracing"`
+	Features Features `yaml:"features" toml:"features" json:"features"`
+}
+
+type DB struct {
+	// Driver is the database/sql driver. Only sqlite3 is supported.
+	Driver string `yaml:"driver" toml:"driver" json:"driver"`
+	// DSN, if set, is used as is in place of Path.
+	DSN string `yaml:"dsn" toml:"dsn" json:"dsn"`
+	// Path is the SQLite database file, by default todolist.db next to the
+	// executable.
+	Path string `yaml:"path" toml:"path" json:"path"`
+}
+
+// Backup schedules backups of the database while the server runs.
+type Backup struct {
+	// Dir is where backups are written, empty for no scheduled backups.
+	Dir      string        `yaml:"dir" toml:"dir" json:"dir"`
+	Interval time.Duration `yaml:"interval" toml:"interval" json:"interval"`
+	// Keep is how many of the most recent backups are kept, zero for all
+	// of them.
+	Keep int `yaml:"keep" toml:"keep" json:"keep"`
+}
+
+type Server struct {
+	Bind string `yaml:"bind" toml:"bind" json:"bind"`
+	// GRPCBind is the gRPC listen address, empty to disable gRPC. It
+	// defaults to the loopback interface, so gRPC is only exposed when asked.
+	GRPCBind string `yaml:"grpc_bind" toml:"grpc_bind" json:"grpc_bind"`
+	// AdminBind, if set, is a separate plain HTTP listen address for
+	// operational endpoints such as /metrics and /readyz, which are then not
+	// served on Bind. Diagnostics under /debug and database snapshots at
+	// /backup are only served here.
+	AdminBind string `yaml:"admin_bind" toml:"admin_bind" json:"admin_bind"`
+	// RequestTimeout cancels handlers that run too long. Event streams are
+	// not limited.
+	RequestTimeout time.Duration `yaml:"request_timeout" toml:"request_timeout" json:"request_timeout"`
+	// ReadTimeout, ReadHeaderTimeout, WriteTimeout and IdleTimeout limit
+	// connections as in http.Server. Zero means no limit.
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" json:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" json:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" json:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" json:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes" json:"max_header_bytes"`
+	// ShutdownTimeout is how long in-flight requests have to finish once
+	// the server is asked to stop.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" json:"shutdown_timeout"`
+	// IdempotencyKeyTTL is how long the response to a change made with an
+	// Idempotency-Key is kept for retries of the request.
+	IdempotencyKeyTTL time.Duration `yaml:"idempotency_key_ttl" toml:"idempotency_key_ttl" json:"idempotency_key_ttl"`
+	// EventRetention is how long delivered events are kept as the items'
+	// history, zero to keep them for good.
+	EventRetention time.Duration `yaml:"event_retention" toml:"event_retention" json:"event_retention"`
+}
+
+// TLS serves HTTPS and gRPC over TLS when a certificate and key are given.
+// Both files are reloaded when they change.
+type TLS struct {
+	Cert string `yaml:"cert" toml:"cert" json:"cert"`
+	Key  string `yaml:"key" toml:"key" json:"key"`
+	// ClientCA, if set, is a PEM bundle that client certificates are
+	// verified against.
+	ClientCA string `yaml:"client_ca" toml:"client_ca" json:"client_ca"`
+	// ClientAuth is require, to turn away clients without a certificate, or
+	// optional.
+	ClientAuth string `yaml:"client_auth" toml:"client_auth" json:"client_auth"`
+	// RedirectBind, if set, is an address that redirects HTTP requests to
+	// HTTPS.
+	RedirectBind string `yaml:"redirect_bind" toml:"redirect_bind" json:"redirect_bind"`
+}
+
+// Enabled reports whether the server uses TLS.
+func (t TLS) Enabled() bool {
+	return t.Cert != ""
+}
+
+// CORS is the cross-origin policy for browsers.
+type CORS struct {
+	// AllowedOrigins are origins such as https://todo.example, which may
+	// use a wildcard for subdomains as in https://*.todo.example, or *
+	// to allow any origin.
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" json:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods" toml:"allowed_methods" json:"allowed_methods"`
+	// AllowedHeaders may include * to allow any request header.
+	AllowedHeaders []string `yaml:"allowed_headers" toml:"allowed_headers" json:"allowed_headers"`
+	// ExposedHeaders are response headers that scripts may read.
+	ExposedHeaders []string `yaml:"exposed_headers" toml:"exposed_headers" json:"exposed_headers"`
+	// AllowCredentials lets requests carry cookies and client
+	// certificates. It cannot be used with an origin of *.
+	AllowCredentials bool `yaml:"allow_credentials" toml:"allow_credentials" json:"allow_credentials"`
+	// MaxAge is how long browsers may cache the answer to a preflight.
+	MaxAge time.Duration `yaml:"max_age" toml:"max_age" json:"max_age"`
+}
+
+// Limits throttle each client, identified by its client certificate or
+// else its IP address, with token buckets that refill at a steady rate and
+// hold up to a burst of requests. Reads and writes have separate buckets.
+// A rate of zero means no limit.
+type Limits struct {
+	ReadsPerMinute  int `yaml:"reads_per_minute" toml:"reads_per_minute" json:"reads_per_minute"`
+	ReadBurst       int `yaml:"read_burst" toml:"read_burst" json:"read_burst"`
+	WritesPerMinute int `yaml:"writes_per_minute" toml:"writes_per_minute" json:"writes_per_minute"`
+	WriteBurst      int `yaml:"write_burst" toml:"write_burst" json:"write_burst"`
+	// ItemsPerUser caps the items each client with a certificate may
+	// create, zero for no cap. Clients without certificates own their items
+	// together, so are not held to it: it only applies with tls.client_ca.
+	ItemsPerUser int `yaml:"items_per_user" toml:"items_per_user" json:"items_per_user"`
+}
+
+// Tracing exports OpenTelemetry spans for HTTP requests, service calls and
+// SQL statements.
+type Tracing struct {
+	// Exporter is none, otlp to send spans to a collector over OTLP/HTTP,
+	// or stdout to print them, for local use.
+	Exporter string `yaml:"exporter" toml:"exporter" json:"exporter"`
+	// Endpoint is the collector's host:port, by default localhost:4318 or
+	// as set by OTEL_EXPORTER_OTLP_ENDPOINT.
+	Endpoint string `yaml:"endpoint" toml:"endpoint" json:"endpoint"`
+	// Insecure sends spans to the collector over plain HTTP.
+	Insecure    bool   `yaml:"insecure" toml:"insecure" json:"insecure"`
+	ServiceName string `yaml:"service_name" toml:"service_name" json:"service_name"`
+}
+
+type Log struct {
+	// Level is one of trace, debug, info, warn or error.
+	Level string `yaml:"level" toml:"level" json:"level"`
+	// Format is json or console.
+	Format string `yaml:"format" toml:"format" json:"format"`
+	// Levels override Level for some packages, as in store=debug. The
+	// packages are http, todolist and store.
+	Levels []string `yaml:"levels" toml:"levels" json:"levels"`
+}
+
+// Features switch the optional APIs on and off.
+type Features struct {
+	CalDAV  bool `yaml:"caldav" toml:"caldav" json:"caldav"`
+	GraphQL bool `yaml:"graphql" toml:"graphql" json:"graphql"`
+	JSONRPC bool `yaml:"jsonrpc" toml:"jsonrpc" json:"jsonrpc"`
+	Events  bool `yaml:"events" toml:"events" json:"events"`
+	// Metrics serves Prometheus metrics at /metrics. It is off by default,
+	// as the metrics describe every client's items and requests.
+	Metrics bool `yaml:"metrics" toml:"metrics" json:"metrics"`
+	// Pprof serves the runtime's profiles under /debug/pprof/, on the admin
+	// listener, so needs Server.AdminBind.
+	Pprof bool `yaml:"pprof" toml:"pprof" json:"pprof"`
+}
+
+// Defaults returns the configuration used when nothing else is set.
+func Defaults() Config {
+	return Config{
+		DB:     DB{Driver: "sqlite3"},
+		Backup: Backup{Interval: 24 * time.Hour, Keep: 7},
+		Server: Server{
+			Bind:              "0.0.0.0:8080",
+			GRPCBind:          "127.0.0.1:9090",
+			RequestTimeout:    60 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			// the event feed and subscriptions are long-lived responses, so
+			// writes are not limited unless asked
+			WriteTimeout:      0,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+			IdempotencyKeyTTL: 24 * time.Hour,
+			EventRetention:    30 * 24 * time.Hour,
+		},
+		TLS: TLS{ClientAuth: "require"},
+		CORS: CORS{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "Authorization"},
+			ExposedHeaders: []string{"ETag"},
+			MaxAge:         10 * time.Minute,
+		},
+		Limits: Limits{
+			ReadsPerMinute:  1200,
+			ReadBurst:       200,
+			WritesPerMinute: 300,
+			WriteBurst:      60,
+		},
+		Log:      Log{Level: "info", Format: "json", Levels: []string{}},
+		Tracing:  Tracing{Exporter: "none", ServiceName: "todolist"},
+		Features: Features{CalDAV: true, GraphQL: true, JSONRPC: true, Events: true},
+	}
+}
+
+// LoadFile reads a YAML or TOML file, chosen by its extension, over c.
+// Keys the configuration does not have are rejected.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		// an empty file decodes as io.EOF
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: configuration files must be .yaml, .yml or .toml", path)
+	}
+	return c.Validate()
+}
+
+// LoadEnv sets every key that has an environment variable, as returned by
+// lookup, which is usually os.LookupEnv.
+func (c *Config) LoadEnv(lookup func(string) (string, bool)) error {
+	for _, key := range Keys() {
+		if value, ok := lookup(EnvVar(key)); ok {
+			if err := c.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %w", EnvVar(key), err)
+			}
+		}
+	}
+	return c.Validate()
+}
+
+// EnvVar returns the environment variable for a key.
+func EnvVar(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Keys lists the dotted keys of every setting, in the order they are
+// declared.
+func Keys() []string {
+	var keys []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(field.Type, key+".")
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	return keys
+}
+
+// Set parses value into the setting named by a dotted key. Lists are
+// comma-separated.
+func (c *Config) Set(key, value string) error {
+	field, err := c.field(key)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration such as 30s", key)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer", key)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Slice:
+		values := []string{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("%s cannot be set", key)
+	}
+	return nil
+}
+
+func (c *Config) field(key string) (reflect.Value, error) {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown key %s", key)
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Tag.Get("yaml") == name {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown key %s", key)
+		}
+	}
+	if v.Kind() == reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("unknown key %s", key)
+	}
+	return v, nil
+}
+
+var (
+	logLevels  = []string{"trace", "debug", "info", "warn", "error"}
+	logFormats = []string{"json", "console"}
+	clientAuth = []string{"require", "optional"}
+
+	tracingExporters = []string{"none", "otlp", "stdout"}
+)
+
+// Validate checks settings that only take certain values.
+func (c *Config) Validate() error {
+	if c.DB.Driver != "sqlite3" {
+		return fmt.Errorf("db.driver %q is not supported, only sqlite3 is", c.DB.Driver)
+	}
+	if !contains(logLevels, c.Log.Level) {
+		return fmt.Errorf("log.level must be one of %s", strings.Join(logLevels, ", "))
+	}
+	if !contains(logFormats, c.Log.Format) {
+		return fmt.Errorf("log.format must be one of %s", strings.Join(logFormats, ", "))
+	}
+	if _, err := logging.ParseLevels(c.Log.Levels); err != nil {
+		return fmt.Errorf("log.levels: %w", err)
+	}
+	if !contains(tracingExporters, c.Tracing.Exporter) {
+		return fmt.Errorf("tracing.exporter must be one of %s", strings.Join(tracingExporters, ", "))
+	}
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"server.request_timeout", c.Server.RequestTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"server.event_retention", c.Server.EventRetention},
+		{"cors.max_age", c.CORS.MaxAge},
+		{"backup.interval", c.Backup.Interval},
+	} {
+		if d.value < 0 {
+			return fmt.Errorf("%s must not be negative", d.key)
+		}
+	}
+	for _, n := range []struct {
+		key   string
+		value int
+	}{
+		{"server.max_header_bytes", c.Server.MaxHeaderBytes},
+		{"limits.reads_per_minute", c.Limits.ReadsPerMinute},
+		{"limits.writes_per_minute", c.Limits.WritesPerMinute},
+		{"limits.items_per_user", c.Limits.ItemsPerUser},
+		{"backup.keep", c.Backup.Keep},
+	} {
+		if n.value < 0 {
+			return fmt.Errorf("%s must not be negative", n.key)
+		}
+	}
+	if c.Server.IdempotencyKeyTTL <= 0 {
+		return fmt.Errorf("server.idempotency_key_ttl must be positive")
+	}
+	if c.Backup.Dir != "" && c.Backup.Interval == 0 {
+		return fmt.Errorf("backup.interval must be positive to back up to backup.dir")
+	}
+	if c.Limits.ReadsPerMinute > 0 && c.Limits.ReadBurst < 1 {
+		return fmt.Errorf("limits.read_burst must be at least 1")
+	}
+	if c.Limits.WritesPerMinute > 0 && c.Limits.WriteBurst < 1 {
+		return fmt.Errorf("limits.write_burst must be at least 1")
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		return fmt.Errorf("tls.cert and tls.key must be given together")
+	}
+	if c.Features.Pprof && c.Server.AdminBind == "" {
+		return fmt.Errorf("features.pprof needs server.admin_bind, as profiles are only served there")
+	}
+	if !c.TLS.Enabled() && (c.TLS.ClientCA != "" || c.TLS.RedirectBind != "") {
+		return fmt.Errorf("tls.client_ca and tls.redirect_bind need tls.cert and tls.key")
+	}
+	if c.CORS.AllowCredentials && contains(c.CORS.AllowedOrigins, "*") {
+		return fmt.Errorf("cors.allow_credentials cannot be used with an allowed origin of *")
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin != "*" && (strings.Count(origin, "*") > 1 || strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+			return fmt.Errorf("cors.allowed_origins: %q may only use * for subdomains, as in https://*.todo.example", origin)
+		}
+	}
+	if !contains(clientAuth, c.TLS.ClientAuth) {
+		return fmt.Errorf("tls.client_auth must be one of %s", strings.Join(clientAuth, ", "))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the configuration as YAML or TOML.
+func (c *Config) Print(w io.Writer, format string) error {
+	switch format {
+	case "yaml", "":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(c.printable()); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(c.printable())
+	default:
+		return fmt.Errorf("unknown format %q, expected yaml or toml", format)
+	}
+}
+
+// printable spells durations out, as they are written in files, rather than
+// as nanoseconds.
+func (c *Config) printable() map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, key := range Keys() {
+		field, _ := c.field(key)
+		var value interface{} = field.Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+
+		parts := strings.Split(key, ".")
+		section := out
+		for _, part := range parts[:len(parts)-1] {
+			if _, ok := section[part]; !ok {
+				section[part] = map[string]interface{}{}
+			}
+			section = section[part].(map[string]interface{})
+		}
+		section[parts[len(parts)-1]] = value
+	}
+	return out
+}
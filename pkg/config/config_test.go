@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var testingT *testing.T
+
+func TestConfig(t *testing.T) {
+	testingT = t
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "config suite")
+}
+
+var _ = Describe("Config tests", func() {
+	writeFile := func(name, content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), name)
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		return path
+	}
+
+	env := func(vars map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			value, ok := vars[name]
+			return value, ok
+		}
+	}
+
+	Specify("Every key has an environment variable", func() {
+		Expect(Keys()).To(ContainElements("db.path", "server.request_timeout", "cors.allowed_origins", "features.graphql"))
+		Expect(EnvVar("server.grpc_bind")).To(Equal("TODOLIST_SERVER_GRPC_BIND"))
+	})
+
+	Specify("Files, then the environment, override the defaults", func() {
+		c := Defaults()
+		Expect(c.LoadFile(writeFile("todolist.yaml", `
+db:
+  path: /var/lib/todolist.db
+server:
+  bind: 127.0.0.1:8000
+  request_timeout: 10s
+cors:
+  allowed_origins: [https://app.example]
+`))).To(Succeed())
+		Expect(c.LoadEnv(env(map[string]string{
+			"TODOLIST_SERVER_BIND":          "127.0.0.1:9000",
+			"TODOLIST_CORS_ALLOWED_ORIGINS": "https://a.example, https://b.example",
+			"TODOLIST_FEATURES_GRAPHQL":     "false",
+		}))).To(Succeed())
+
+		Expect(c.DB.Path).To(Equal("/var/lib/todolist.db"))
+		Expect(c.Server.Bind).To(Equal("127.0.0.1:9000"))
+		Expect(c.Server.RequestTimeout).To(Equal(10 * time.Second))
+		Expect(c.Server.GRPCBind).To(Equal(Defaults().Server.GRPCBind))
+		Expect(c.CORS.AllowedOrigins).To(Equal([]string{"https://a.example", "https://b.example"}))
+		Expect(c.Features.GraphQL).To(BeFalse())
+		Expect(c.Features.JSONRPC).To(BeTrue())
+		Expect(c.Features.Metrics).To(BeFalse())
+	})
+
+	Specify("TOML files are read too", func() {
+		c := Defaults()
+		Expect(c.LoadFile(writeFile("todolist.toml", `
+[log]
+level = "debug"
+format = "console"
+
+[server]
+request_timeout = "2m"
+`))).To(Succeed())
+		Expect(c.Log).To(Equal(Log{Level: "debug", Format: "console", Levels: []string{}}))
+		Expect(c.Server.RequestTimeout).To(Equal(2 * time.Minute))
+	})
+
+	Specify("An empty file changes nothing", func() {
+		c := Defaults()
+		Expect(c.LoadFile(writeFile("todolist.yaml", ""))).To(Succeed())
+		Expect(c).To(Equal(Defaults()))
+	})
+
+	Specify("Printed configuration reads back the same", func() {
+		c := Defaults()
+		c.Server.RequestTimeout = 90 * time.Second
+		c.CORS.AllowedOrigins = []string{"https://app.example"}
+
+		for _, format := range []string{"yaml", "toml"} {
+			var out bytes.Buffer
+			Expect(c.Print(&out, format)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("1m30s"))
+
+			read := Defaults()
+			Expect(read.LoadFile(writeFile("todolist."+format, out.String()))).To(Succeed())
+			Expect(read).To(Equal(c))
+		}
+	})
+
+	DescribeTable("Bad settings are rejected",
+		func(load func(c *Config) error, message string) {
+			c := Defaults()
+			Expect(load(&c)).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("unknown YAML keys", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "server:\n  port: 80\n"))
+		}, "field port not found"),
+		Entry("unknown TOML keys", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.toml", "[server]\nport = 80\n"))
+		}, "unknown key server.port"),
+		Entry("other file types", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.ini", ""))
+		}, "must be .yaml, .yml or .toml"),
+		Entry("bad durations", func(c *Config) error {
+			return c.LoadEnv(env(map[string]string{"TODOLIST_SERVER_REQUEST_TIMEOUT": "soon"}))
+		}, "TODOLIST_SERVER_REQUEST_TIMEOUT: server.request_timeout must be a duration"),
+		Entry("bad booleans", func(c *Config) error {
+			return c.Set("features.caldav", "maybe")
+		}, "features.caldav must be true or false"),
+		Entry("unknown keys", func(c *Config) error {
+			return c.Set("server", "x")
+		}, "unknown key server"),
+		Entry("other drivers", func(c *Config) error {
+			return c.LoadEnv(env(map[string]string{"TODOLIST_DB_DRIVER": "postgres"}))
+		}, `db.driver "postgres" is not supported`),
+		Entry("unknown log levels", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "log:\n  level: loud\n"))
+		}, "log.level must be one of"),
+		Entry("credentials for any origin", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "cors:\n  allow_credentials: true\n"))
+		}, "cors.allow_credentials cannot be used"),
+		Entry("wildcards other than for subdomains", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "cors:\n  allowed_origins: [\"https://todo*.example\"]\n"))
+		}, "may only use * for subdomains"),
+		Entry("unknown trace exporters", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "tracing:\n  exporter: jaeger\n"))
+		}, "tracing.exporter must be one of"),
+		Entry("levels for unknown packages", func(c *Config) error {
+			return c.LoadEnv(env(map[string]string{"TODOLIST_LOG_LEVELS": "store=debug, web=trace"}))
+		}, `log.levels: "web" is not one of http, todolist, store`),
+		Entry("unknown levels for packages", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "log:\n  levels: [store=loud]\n"))
+		}, `log.levels: "loud" is not a log level`),
+		Entry("backups without an interval", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "backup:\n  dir: backups\n  interval: 0s\n"))
+		}, "backup.interval must be positive"),
+		Entry("profiles without an admin listener", func(c *Config) error {
+			return c.LoadFile(writeFile("todolist.yaml", "features:\n  pprof: true\n"))
+		}, "features.pprof needs server.admin_bind"),
+	)
+})
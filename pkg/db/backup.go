@@ -0,0 +1,295 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrDatabaseInUse is returned by Restore when something else has the
+// database locked.
+var ErrDatabaseInUse = errors.New("database is in use")
+
+// restoreLockTimeout is how long Restore waits for others to finish with
+// the database.
+const restoreLockTimeout = time.Second
+
+// Backups are named for the time they were taken, so that sorting their
+// names sorts them by age.
+const (
+	backupPrefix = "todolist-"
+	backupSuffix = ".db"
+	backupTime   = "20060102T150405Z"
+)
+
+// BackupName is the file name for a backup taken at t.
+func BackupName(t time.Time) string {
+	return backupPrefix + t.UTC().Format(backupTime) + backupSuffix
+}
+
+// Backup writes a consistent copy of db to dest with VACUUM INTO, which
+// reads the database in a single transaction and so can run alongside
+// other connections, including a running server's. The copy is written
+// next to dest and renamed into place, so dest is never left half written.
+func Backup(ctx context.Context, db *sqlx.DB, dest string) error {
+	tmp, err := tempPath(dest)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", tmp); err != nil {
+		return fmt.Errorf("backing up database: %w", err)
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Snapshot writes a consistent copy of db to w.
+func Snapshot(ctx context.Context, db *sqlx.DB, w io.Writer) error {
+	dir, err := os.MkdirTemp("", "todolist-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "todolist.db")
+	if err := Backup(ctx, db, path); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// CheckBackup returns the schema version of the backup at path, failing if
+// it is not an intact todolist database or is newer than this build.
+func CheckBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sqlx.Connect("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.Get(&result, "PRAGMA quick_check"); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%s is damaged: %s", path, result)
+	}
+	version, err := Version(db)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	switch {
+	case version == 0:
+		return 0, fmt.Errorf("%s is not a todolist database", path)
+	case version > SchemaVersion():
+		return 0, fmt.Errorf("%s has schema version %d, newer than supported version %d", path, version, SchemaVersion())
+	}
+	return version, nil
+}
+
+// Restore replaces the database at dest with the backup at src, once
+// CheckBackup accepts it, and returns the backup's schema version. Older
+// schemas are migrated when the database is next opened. dest is locked
+// while it is replaced, and ErrDatabaseInUse returned if it cannot be, but
+// connections that are open and idle are not noticed, and would go on using
+// the replaced file, so nothing should have dest open.
+func Restore(src, dest string) (int, error) {
+	version, err := CheckBackup(src)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := tempPath(dest)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	if err := copyFile(src, tmp); err != nil {
+		return 0, err
+	}
+
+	unlock, err := lockExclusive(dest)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	// a journal left by the replaced database would be applied to the
+	// restored one
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(dest + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+	}
+	return version, os.Rename(tmp, dest)
+}
+
+// lockExclusive takes an exclusive lock on the database at path, if there is
+// one, so that nothing else can read or write it until the returned function
+// is called. It fails with ErrDatabaseInUse if others still hold a lock after
+// restoreLockTimeout.
+func lockExclusive(path string) (func(), error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return func() {}, nil
+	}
+	db, err := sqlx.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=%d", path, restoreLockTimeout.Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN EXCLUSIVE"); err != nil {
+		_ = conn.Close()
+		_ = db.Close()
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrBusy {
+			return nil, fmt.Errorf("%s: %w", path, ErrDatabaseInUse)
+		}
+		return nil, err
+	}
+	return func() {
+		_, _ = conn.ExecContext(ctx, "ROLLBACK")
+		_ = conn.Close()
+		_ = db.Close()
+	}, nil
+}
+
+// tempPath reserves a name in the directory of path for a file that is to
+// be renamed to path, and so must be on the same file system.
+func tempPath(path string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_ = f.Close()
+	// VACUUM INTO refuses to write over a file
+	return f.Name(), os.Remove(f.Name())
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Backups backs a database up to Dir every Interval, keeping the Keep most
+// recent backups, or all of them if Keep is zero.
+type Backups struct {
+	DB       *sqlx.DB
+	Dir      string
+	Interval time.Duration
+	Keep     int
+}
+
+// Run backs up every Interval until ctx is cancelled.
+func (b *Backups) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		path, err := b.Backup(ctx, time.Now())
+		switch {
+		case err == nil:
+			log.Info().Str("path", path).Msg("Database backed up")
+		case ctx.Err() == nil:
+			log.Error().Err(err).Str("dir", b.Dir).Msg("Scheduled backup failed")
+		}
+	}
+}
+
+// Backup writes a backup named for the time now and then removes the
+// oldest backups beyond Keep, returning the new backup's path.
+func (b *Backups) Backup(ctx context.Context, now time.Time) (string, error) {
+	if err := os.MkdirAll(b.Dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(b.Dir, BackupName(now))
+	if err := Backup(ctx, b.DB, path); err != nil {
+		return "", err
+	}
+	return path, b.prune()
+}
+
+// List returns the paths of the scheduled backups in Dir, oldest first.
+func (b *Backups) List() ([]string, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix)
+		if _, err := time.Parse(backupTime, stamp); err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(b.Dir, name))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (b *Backups) prune() error {
+	if b.Keep == 0 {
+		return nil
+	}
+	paths, err := b.List()
+	if err != nil {
+		return err
+	}
+	for len(paths) > b.Keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
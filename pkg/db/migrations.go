@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+// migrations are applied in order, each exactly once. The index of the last
+// applied migration plus one is kept in the database's user_version, so
+// entries must only ever be appended.
+var migrations = []string{
+	`
+CREATE TABLE IF NOT EXISTS todolist (
+	id    CHAR(40) NOT NULL,
+	item   VARCHAR(250) NOT NULL,
+	priority INT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT rid_pkey PRIMARY KEY (id)
+);
+`,
+	`
+CREATE TABLE IF NOT EXISTS outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic VARCHAR(100) NOT NULL,
+	aggregate_id CHAR(40) NOT NULL,
+	payload TEXT NOT NULL,
+	attempts INT DEFAULT 0 NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	delivered_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (delivered_at, id);
+`,
+	`
+ALTER TABLE todolist ADD COLUMN status VARCHAR(20) DEFAULT '' NOT NULL;
+ALTER TABLE todolist ADD COLUMN due DATETIME;
+ALTER TABLE todolist ADD COLUMN completed_at DATETIME;
+`,
+	`
+ALTER TABLE todolist ADD COLUMN projects TEXT DEFAULT '' NOT NULL;
+ALTER TABLE todolist ADD COLUMN contexts TEXT DEFAULT '' NOT NULL;
+ALTER TABLE todolist ADD COLUMN attributes TEXT DEFAULT '' NOT NULL;
+`,
+	`
+ALTER TABLE todolist ADD COLUMN owner VARCHAR(250) DEFAULT '' NOT NULL;
+CREATE INDEX IF NOT EXISTS todolist_owner_idx ON todolist (owner);
+`,
+	`
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	owner VARCHAR(250) NOT NULL,
+	key VARCHAR(250) NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	status INT NOT NULL,
+	header TEXT NOT NULL,
+	body BLOB NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at DATETIME NOT NULL,
+	CONSTRAINT idempotency_keys_pkey PRIMARY KEY (owner, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys (expires_at);
+`,
+}
+
+// SchemaVersion is the schema version this build migrates databases to.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// Version returns the schema version recorded in db.
+func Version(db *sqlx.DB) (int, error) {
+	var version int
+	err := db.Get(&version, "PRAGMA user_version")
+	return version, err
+}
+
+// Migrate applies any migrations db has not yet seen.
+func Migrate(db *sqlx.DB) error {
+	version, err := Version(db)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		log.Debug().Int("version", version+1).Msg("Applying migration")
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		// PRAGMA does not accept bind parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -10,31 +11,50 @@ import (
 )
 
 func CreateDb() (*sqlx.DB, error) {
-	log.Debug().Msg("Creating Db")
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
 
+	return OpenDb(path)
+}
+
+// DefaultPath is where the database is kept unless configured otherwise:
+// todolist.db next to the executable.
+func DefaultPath() (string, error) {
 	ex, err := os.Executable()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return filepath.Join(filepath.Dir(ex), "todolist.db"), nil
+}
 
-	db, err := sqlx.Connect("sqlite3", filepath.Join(filepath.Dir(ex), "todolist.db"))
+// OpenDb connects to the SQLite database at path, creating it if needed, and
+// brings its schema up to date.
+func OpenDb(path string) (*sqlx.DB, error) {
+	log.Debug().Str("path", path).Msg("Creating Db")
+
+	// wait on locks rather than failing straight away, and take the write lock
+	// up front so concurrent transactions cannot deadlock on upgrade
+	return Connect("sqlite3", "file:"+path+"?_busy_timeout=5000&_txlock=immediate")
+}
+
+// Connect opens a database with a driver and data source name as given, and
+// brings its schema up to date. The migrations are written for SQLite.
+func Connect(driver, dsn string) (*sqlx.DB, error) {
+	if driver != "sqlite3" {
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	db, err := sqlx.Connect(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Debug().Msg("Creating Table")
-	var schema = `
-DROP TABLE IF EXISTS todolist;
-CREATE TABLE todolist (
-	id    CHAR(40) NOT NULL,
-	item   VARCHAR(250) NOT NULL,
-	priority INT NOT NULL,
-	created_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL,
-    CONSTRAINT rid_pkey PRIMARY KEY (id)
-);
-`
-	db.MustExec(schema)
+	log.Debug().Msg("Migrating schema")
+	if err := Migrate(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	log.Debug().Msg("DB Init Completed")
 	return db, nil
 }
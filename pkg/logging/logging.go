@@ -0,0 +1,80 @@
+// Package logging hands out the loggers used while serving requests. A
+// request's logger, which carries its id, travels in the request's context,
+// and each package can log at its own level.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Packages are the names that levels can be set for: http for access logs of
+// requests and gRPC calls, todolist for the handlers and service, and store
+// for the database.
+var Packages = []string{"http", "todolist", "store"}
+
+var (
+	mu     sync.RWMutex
+	levels = map[string]zerolog.Level{}
+)
+
+func init() {
+	// contexts without a request's logger fall back to the global one,
+	// even once it has been replaced
+	zerolog.DefaultContextLogger = &log.Logger
+}
+
+// ParseLevels parses settings such as store=debug into levels by package.
+func ParseLevels(settings []string) (map[string]zerolog.Level, error) {
+	parsed := map[string]zerolog.Level{}
+	for _, setting := range settings {
+		pkg, name, ok := strings.Cut(setting, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be a package and level, as in store=debug", setting)
+		}
+		if !known(pkg) {
+			return nil, fmt.Errorf("%q is not one of %s", pkg, strings.Join(Packages, ", "))
+		}
+		level, err := zerolog.ParseLevel(name)
+		if err != nil || level == zerolog.NoLevel {
+			return nil, fmt.Errorf("%q is not a log level", name)
+		}
+		parsed[pkg] = level
+	}
+	return parsed, nil
+}
+
+func known(pkg string) bool {
+	for _, p := range Packages {
+		if p == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLevels sets the level each package logs at. Packages without one log
+// at the level of the logger they are given.
+func SetLevels(byPackage map[string]zerolog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	levels = byPackage
+}
+
+// For returns the logger pkg should use: the request's logger from ctx, or
+// else the global logger, naming the package and at its level.
+func For(ctx context.Context, pkg string) *zerolog.Logger {
+	logger := zerolog.Ctx(ctx).With().Str("package", pkg).Logger()
+	mu.RLock()
+	level, ok := levels[pkg]
+	mu.RUnlock()
+	if ok {
+		logger = logger.Level(level)
+	}
+	return &logger
+}
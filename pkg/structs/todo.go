@@ -1,14 +1,36 @@
 package structs
 
 import (
-	"errors"
+	"crypto/rand"
+	"fmt"
 	"time"
+	"unicode/utf8"
+)
+
+// Item statuses follow the VTODO STATUS values of RFC 5545. An empty status
+// is equivalent to StatusNeedsAction.
+const (
+	StatusNeedsAction = "needs-action"
+	StatusInProcess   = "in-process"
+	StatusCompleted   = "completed"
+	StatusCancelled   = "cancelled"
 )
 
 type TodoItem struct {
-	Id         string `json:"id"`
-	Item       string `json:"item"`
-	Priority   int `json:"priority"`
+	Id           string     `json:"id"`
+	Item         string     `json:"item"`
+	Priority     int        `json:"priority"`
+	Status       string     `json:"status,omitempty"`
+	Due          *time.Time `json:"due,omitempty"`
+	Completed_at *time.Time `json:"completed_at,omitempty"`
+	// Projects, Contexts and Attributes carry todo.txt style +project,
+	// @context and key:value tags.
+	Projects   []string          `json:"projects,omitempty"`
+	Contexts   []string          `json:"contexts,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Owner names the client that created the item, if it was identified.
+	// It is set by the service and cannot be changed.
+	Owner      string    `json:"owner,omitempty"`
 	Updated_at time.Time `json:"created_at"`
 	Created_at time.Time `json:"updated_at"`
 }
@@ -18,16 +40,62 @@ type TodoItemList struct {
 	Count int
 }
 
+// MoveRequest asks for an item to be placed at a 1-based position in the list.
+type MoveRequest struct {
+	Position int `json:"position"`
+}
+
+func (m *MoveRequest) Validate() error {
+	errs := &ValidationError{}
+	if m.Position < 1 {
+		errs.Add("position", CodeOutOfRange, "position must be at least 1")
+	}
+	return errs.Err()
+}
+
+// NewItemId returns a random (version 4) UUID for a new item.
+func NewItemId() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// IsCompleted reports whether the item has been done.
+func (t *TodoItem) IsCompleted() bool {
+	return t.Status == StatusCompleted
+}
+
+// Validate reports every problem with the item as a *ValidationError.
 func (t *TodoItem) Validate() error {
-	
+	errs := &ValidationError{}
 
 	if t.Item == "" {
-		return errors.New("item is required")
+		errs.Add("item", CodeRequired, "item is required")
+	} else if utf8.RuneCountInString(t.Item) > MaxItemLength {
+		errs.Add("item", CodeTooLong, fmt.Sprintf("item must be at most %d characters", MaxItemLength))
+	}
+
+	if t.Priority < 1 {
+		errs.Add("priority", CodeOutOfRange, "priority must be at least 1")
 	}
 
-	if t.Priority <= 0 {
-		return errors.New("priority cannot be less than 0")
+	switch t.Status {
+	case "", StatusNeedsAction, StatusInProcess, StatusCompleted, StatusCancelled:
+	default:
+		errs.Add("status", CodeInvalidValue, "status must be one of needs-action, in-process, completed or cancelled")
 	}
 
-	return nil
-}
\ No newline at end of file
+	return errs.Err()
+}
+
+// ItemEvent describes a change to an item, as sent on the event feed. Item
+// is the item as it was after the change.
+type ItemEvent struct {
+	Id         int64     `json:"id"`
+	Topic      string    `json:"topic"`
+	Item_id    string    `json:"item_id"`
+	Item       TodoItem  `json:"item"`
+	Created_at time.Time `json:"created_at"`
+}
@@ -0,0 +1,30 @@
+package structs
+
+const (
+	// ConflictSkip leaves an existing item untouched when an imported item has the same id.
+	ConflictSkip = "skip"
+	// ConflictOverwrite replaces an existing item with the imported one.
+	ConflictOverwrite = "overwrite"
+	// ConflictRename imports the item under a newly generated id.
+	ConflictRename = "rename"
+)
+
+type ImportOptions struct {
+	DryRun   bool   `json:"dry_run"`
+	Conflict string `json:"conflict"`
+}
+
+type ImportedItem struct {
+	Id          string `json:"id"`
+	Original_id string `json:"original_id,omitempty"`
+	Action      string `json:"action"`
+}
+
+type ImportResult struct {
+	DryRun      bool           `json:"dry_run"`
+	Created     int            `json:"created"`
+	Overwritten int            `json:"overwritten"`
+	Renamed     int            `json:"renamed"`
+	Skipped     int            `json:"skipped"`
+	Items       []ImportedItem `json:"items"`
+}
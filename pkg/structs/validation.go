@@ -0,0 +1,73 @@
+package structs
+
+import (
+	"strings"
+)
+
+// MaxItemLength is the longest item text the database column holds, in
+// characters.
+const MaxItemLength = 250
+
+// Codes identifying why a field was rejected, for clients to act on.
+const (
+	CodeRequired     = "required"
+	CodeTooLong      = "too_long"
+	CodeOutOfRange   = "out_of_range"
+	CodeInvalidValue = "invalid_value"
+	CodeInvalidType  = "invalid_type"
+	CodeUnknownField = "unknown_field"
+	CodeInvalidJSON  = "invalid_json"
+	CodeMalformed    = "malformed"
+	CodeTrailingData = "trailing_data"
+)
+
+// FieldError describes one problem with a request. Field is the JSON name of
+// the field, empty when the problem is with the request as a whole, and
+// Message is meant for people and names the field itself.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every problem found with a request, rather than
+// just the first.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add records a problem with a field.
+func (e *ValidationError) Add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Err returns e if any problems were recorded, and nil otherwise.
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Within qualifies every field with a prefix, such as the position of an
+// item within a list.
+func (e *ValidationError) Within(prefix string) *ValidationError {
+	within := &ValidationError{}
+	for _, fe := range e.Errors {
+		if fe.Field == "" {
+			fe.Field = prefix
+		} else {
+			fe.Field = prefix + "." + fe.Field
+		}
+		within.Errors = append(within.Errors, fe)
+	}
+	return within
+}
@@ -0,0 +1,573 @@
+package todolist
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.altair.com/todolist/pkg/logging"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// A minimal CalDAV (RFC 4791) server exposing the list as a single calendar
+// collection of VTODO resources, enough for task apps to discover the
+// collection and synchronise with it in both directions.
+
+const (
+	CalDAVPrefix         = "/caldav"
+	calDAVCollectionPath = CalDAVPrefix + "/todolist/"
+
+	nsDAV          = "DAV:"
+	nsCalDAV       = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarSrv  = "http://calendarserver.org/ns/"
+	mediaTypeXML   = "application/xml; charset=utf-8"
+	mediaTypeVTODO = "text/calendar; charset=utf-8; component=vtodo"
+)
+
+func init() {
+	chi.RegisterMethod("PROPFIND")
+	chi.RegisterMethod("REPORT")
+}
+
+type CalDAVHandlers struct {
+	ItemsService ItemsService
+}
+
+func (h *CalDAVHandlers) ConfigureRoutes(r chi.Router) {
+	r.Get("/.well-known/caldav", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, CalDAVPrefix+"/", http.StatusMovedPermanently)
+	})
+
+	r.Route(CalDAVPrefix, func(r chi.Router) {
+		r.Options("/*", h.options)
+		r.MethodFunc("PROPFIND", "/", h.propfindPrincipal)
+		for _, collection := range []string{"/todolist", "/todolist/"} {
+			r.MethodFunc("PROPFIND", collection, h.propfindCollection)
+			r.MethodFunc("REPORT", collection, h.report)
+		}
+
+		r.Route("/todolist/{resource}", func(r chi.Router) {
+			r.MethodFunc("PROPFIND", "/", h.propfindResource)
+			r.Get("/", h.getResource)
+			r.Put("/", h.putResource)
+			r.Delete("/", h.deleteResource)
+		})
+	})
+}
+
+func (h *CalDAVHandlers) options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+// itemETag derives a strong entity tag from the item's modification time.
+func itemETag(item *structs.TodoItem) string {
+	return fmt.Sprintf(`"%d"`, item.Updated_at.UnixNano())
+}
+
+func itemHref(id string) string {
+	return calDAVCollectionPath + url.PathEscape(id) + ".ics"
+}
+
+// resourceId maps a resource name such as "<uid>.ics" to an item id.
+func resourceId(r *http.Request) string {
+	return strings.TrimSuffix(chi.URLParam(r, "resource"), ".ics")
+}
+
+func itemCalendarData(item *structs.TodoItem) ([]byte, error) {
+	var buf bytes.Buffer
+	err := encodeICal(&buf, []structs.TodoItem{*item})
+	return buf.Bytes(), err
+}
+
+// davProps holds the inner XML of the properties a resource can report,
+// keyed by property name.
+type davProps map[xml.Name]string
+
+func (h *CalDAVHandlers) principalProps() davProps {
+	return davProps{
+		{Space: nsDAV, Local: "resourcetype"}:                 "<d:collection/><d:principal/>",
+		{Space: nsDAV, Local: "displayname"}:                  "todolist",
+		{Space: nsDAV, Local: "current-user-principal"}:       "<d:href>" + CalDAVPrefix + "/</d:href>",
+		{Space: nsDAV, Local: "principal-URL"}:                "<d:href>" + CalDAVPrefix + "/</d:href>",
+		{Space: nsCalDAV, Local: "calendar-home-set"}:         "<d:href>" + CalDAVPrefix + "/</d:href>",
+		{Space: nsCalDAV, Local: "calendar-user-address-set"}: "",
+	}
+}
+
+func (h *CalDAVHandlers) collectionProps(items []structs.TodoItem) davProps {
+	// the collection tag changes whenever any item is added, changed or removed
+	tag := sha1.New()
+	for _, item := range items {
+		fmt.Fprintf(tag, "%s:%s\n", item.Id, itemETag(&item))
+	}
+	ctag := `"` + hex.EncodeToString(tag.Sum(nil)) + `"`
+
+	return davProps{
+		{Space: nsDAV, Local: "resourcetype"}:           "<d:collection/><c:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:            "Todo list",
+		{Space: nsDAV, Local: "current-user-principal"}: "<d:href>" + CalDAVPrefix + "/</d:href>",
+		{Space: nsDAV, Local: "getetag"}:                xmlEscape(ctag),
+		{Space: nsDAV, Local: "supported-report-set"}: "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>",
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<c:comp name="VTODO"/>`,
+		{Space: nsCalendarSrv, Local: "getctag"}:                     xmlEscape(ctag),
+	}
+}
+
+// itemProps returns the properties of an item resource. calendar-data is
+// only included when explicitly requested, as it is not part of allprop.
+func (h *CalDAVHandlers) itemProps(item *structs.TodoItem, withData bool) (davProps, error) {
+	props := davProps{
+		{Space: nsDAV, Local: "resourcetype"}:    "",
+		{Space: nsDAV, Local: "getetag"}:         xmlEscape(itemETag(item)),
+		{Space: nsDAV, Local: "getcontenttype"}:  mediaTypeVTODO,
+		{Space: nsDAV, Local: "getlastmodified"}: item.Updated_at.UTC().Format(http.TimeFormat),
+		{Space: nsDAV, Local: "displayname"}:     xmlEscape(item.Item),
+	}
+	if withData {
+		data, err := itemCalendarData(item)
+		if err != nil {
+			return nil, err
+		}
+		props[calendarData] = xmlEscape(string(data))
+	}
+	return props, nil
+}
+
+// davRequest is the body of a PROPFIND or REPORT request. Only the parts
+// this server acts on are decoded.
+type davRequest struct {
+	XMLName xml.Name
+	AllProp *struct{} `xml:"DAV: allprop"`
+	Prop    *struct {
+		Names []struct {
+			XMLName xml.Name
+		} `xml:",any"`
+	} `xml:"DAV: prop"`
+	Hrefs  []string `xml:"DAV: href"`
+	Filter *struct {
+		CompFilter struct {
+			Name       string `xml:"name,attr"`
+			CompFilter *struct {
+				Name string `xml:"name,attr"`
+			} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// requested returns the property names asked for, or nil for allprop.
+func (req *davRequest) requested() []xml.Name {
+	if req.Prop == nil || req.AllProp != nil {
+		return nil
+	}
+	names := make([]xml.Name, 0, len(req.Prop.Names))
+	for _, n := range req.Prop.Names {
+		names = append(names, n.XMLName)
+	}
+	return names
+}
+
+func (req *davRequest) wants(name xml.Name) bool {
+	for _, n := range req.requested() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readDAVRequest(w http.ResponseWriter, r *http.Request) (*davRequest, error) {
+	var req davRequest
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBody))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		// an empty PROPFIND body means allprop
+		return &req, nil
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// depth returns the Depth header, treating infinity as 1 since the
+// collection hierarchy is never deeper than that.
+func depth(r *http.Request) int {
+	if r.Header.Get("Depth") == "0" {
+		return 0
+	}
+	return 1
+}
+
+var calendarData = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+
+func (h *CalDAVHandlers) propfindPrincipal(w http.ResponseWriter, r *http.Request) {
+	req, err := readDAVRequest(w, r)
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	ms := newMultistatus()
+	ms.response(CalDAVPrefix+"/", h.principalProps(), req.requested())
+	if depth(r) > 0 {
+		items, err := h.ItemsService.ListItems(r.Context())
+		if err != nil {
+			http.Error(w, "Failed", http.StatusInternalServerError)
+			return
+		}
+		ms.response(calDAVCollectionPath, h.collectionProps(items.Items), req.requested())
+	}
+	ms.write(w)
+}
+
+func (h *CalDAVHandlers) propfindCollection(w http.ResponseWriter, r *http.Request) {
+	req, err := readDAVRequest(w, r)
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	items, err := h.ItemsService.ListItems(r.Context())
+	if err != nil {
+		http.Error(w, "Failed", http.StatusInternalServerError)
+		return
+	}
+
+	ms := newMultistatus()
+	ms.response(calDAVCollectionPath, h.collectionProps(items.Items), req.requested())
+	if depth(r) > 0 {
+		for i := range items.Items {
+			props, err := h.itemProps(&items.Items[i], req.wants(calendarData))
+			if err != nil {
+				http.Error(w, "Failed", http.StatusInternalServerError)
+				return
+			}
+			ms.response(itemHref(items.Items[i].Id), props, req.requested())
+		}
+	}
+	ms.write(w)
+}
+
+func (h *CalDAVHandlers) propfindResource(w http.ResponseWriter, r *http.Request) {
+	req, err := readDAVRequest(w, r)
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	item, err := h.ItemsService.GetItem(r.Context(), resourceId(r))
+	if err != nil {
+		calDAVError(w, r, err)
+		return
+	}
+	props, err := h.itemProps(item, req.wants(calendarData))
+	if err != nil {
+		http.Error(w, "Failed", http.StatusInternalServerError)
+		return
+	}
+
+	ms := newMultistatus()
+	ms.response(itemHref(item.Id), props, req.requested())
+	ms.write(w)
+}
+
+// report answers calendar-query, returning every item unless the filter asks
+// for a component other than VTODO, and calendar-multiget.
+func (h *CalDAVHandlers) report(w http.ResponseWriter, r *http.Request) {
+	req, err := readDAVRequest(w, r)
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	ms := newMultistatus()
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		if req.Filter != nil && req.Filter.CompFilter.CompFilter != nil &&
+			!strings.EqualFold(req.Filter.CompFilter.CompFilter.Name, "VTODO") {
+			break
+		}
+		items, err := h.ItemsService.ListItems(r.Context())
+		if err != nil {
+			http.Error(w, "Failed", http.StatusInternalServerError)
+			return
+		}
+		for i := range items.Items {
+			props, err := h.itemProps(&items.Items[i], req.wants(calendarData))
+			if err != nil {
+				http.Error(w, "Failed", http.StatusInternalServerError)
+				return
+			}
+			ms.response(itemHref(items.Items[i].Id), props, req.requested())
+		}
+
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			href = strings.TrimSpace(href)
+			id, err := url.PathUnescape(strings.TrimSuffix(path.Base(href), ".ics"))
+			if err != nil {
+				ms.missing(href)
+				continue
+			}
+			item, err := h.ItemsService.GetItem(r.Context(), id)
+			if err != nil {
+				ms.missing(href)
+				continue
+			}
+			props, err := h.itemProps(item, req.wants(calendarData))
+			if err != nil {
+				http.Error(w, "Failed", http.StatusInternalServerError)
+				return
+			}
+			ms.response(href, props, req.requested())
+		}
+
+	default:
+		http.Error(w, "unsupported report", http.StatusForbidden)
+		return
+	}
+	ms.write(w)
+}
+
+func (h *CalDAVHandlers) getResource(w http.ResponseWriter, r *http.Request) {
+	item, err := h.ItemsService.GetItem(r.Context(), resourceId(r))
+	if err != nil {
+		calDAVError(w, r, err)
+		return
+	}
+
+	etag := itemETag(item)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := itemCalendarData(item)
+	if err != nil {
+		http.Error(w, "Failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeVTODO)
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// preconditionFailed checks If-Match and If-None-Match against the current
+// state of the resource, existing being nil if it does not exist.
+func preconditionFailed(r *http.Request, existing *structs.TodoItem) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if existing == nil || (match != "*" && match != itemETag(existing)) {
+			return true
+		}
+	}
+	if r.Header.Get("If-None-Match") == "*" && existing != nil {
+		return true
+	}
+	return false
+}
+
+func (h *CalDAVHandlers) putResource(w http.ResponseWriter, r *http.Request) {
+	id := resourceId(r)
+
+	parsed, err := decodeICal(http.MaxBytesReader(w, r.Body, MaxRequestBody))
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+	if len(parsed) != 1 {
+		http.Error(w, "resource must contain exactly one VTODO", http.StatusUnsupportedMediaType)
+		return
+	}
+	item := parsed[0]
+	item.Id = id
+
+	// the preconditions are checked again in the transaction making the
+	// change, in case the resource changes in the meantime
+	ctx := withPrecondition(r.Context(), func(existing *structs.TodoItem) bool {
+		return !preconditionFailed(r, existing)
+	})
+	existing, err := h.ItemsService.GetItem(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		existing = nil
+	} else if err != nil {
+		calDAVError(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if existing != nil {
+		// clients that drop our extension property send back the clamped
+		// PRIORITY; keep the exact position unless it was really changed
+		if item.Priority == 0 || item.Priority == icalPriority(existing.Priority) {
+			item.Priority = existing.Priority
+		}
+		err = h.ItemsService.UpdateItem(ctx, &item)
+		status = http.StatusNoContent
+	} else {
+		if item.Priority == 0 {
+			if item.Priority, err = h.lastPriority(ctx); err != nil {
+				calDAVError(w, r, err)
+				return
+			}
+		}
+		err = h.ItemsService.AddItem(ctx, &item)
+	}
+	if err != nil {
+		calDAVError(w, r, err)
+		return
+	}
+
+	if stored, err := h.ItemsService.GetItem(r.Context(), id); err == nil {
+		w.Header().Set("ETag", itemETag(stored))
+	}
+	w.WriteHeader(status)
+}
+
+// lastPriority is the priority that places a new item at the end of the
+// list.
+func (h *CalDAVHandlers) lastPriority(ctx context.Context) (int, error) {
+	list, err := h.ItemsService.ListItems(ctx)
+	if err != nil {
+		return 0, err
+	}
+	priority := 1
+	for _, item := range list.Items {
+		if item.Priority >= priority {
+			priority = item.Priority + 1
+		}
+	}
+	return priority, nil
+}
+
+func (h *CalDAVHandlers) deleteResource(w http.ResponseWriter, r *http.Request) {
+	ctx := withPrecondition(r.Context(), func(existing *structs.TodoItem) bool {
+		return !preconditionFailed(r, existing)
+	})
+	if err := h.ItemsService.DeleteItem(ctx, resourceId(r)); err != nil {
+		calDAVError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// calDAVError reports a failed ItemsService call with the status CalDAV
+// clients expect. A resource created by another request counts as a failed
+// precondition. Unexpected failures are logged.
+func calDAVError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *structs.ValidationError
+	switch {
+	case errors.Is(err, ErrPreconditionFailed), errors.Is(err, store.ErrConflict):
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, ErrQuotaExceeded):
+		// RFC 4331 reports exceeded quotas as Insufficient Storage
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	case errors.As(err, &invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logging.For(r.Context(), "todolist").Error().Ctx(r.Context()).Err(err).Str("path", r.URL.Path).Msg("Items service failed")
+		http.Error(w, "Failed", http.StatusInternalServerError)
+	}
+}
+
+// multistatus builds a 207 Multi-Status response body.
+type multistatus struct {
+	buf bytes.Buffer
+}
+
+var davPrefixes = map[string]string{
+	nsDAV:         "d",
+	nsCalDAV:      "c",
+	nsCalendarSrv: "cs",
+}
+
+func newMultistatus() *multistatus {
+	ms := &multistatus{}
+	ms.buf.WriteString(xml.Header)
+	ms.buf.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	return ms
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// element renders an empty or populated property element, declaring a
+// namespace inline for properties outside the well-known ones.
+func element(name xml.Name, inner string) string {
+	tag, decl := name.Local, ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		tag = "x:" + name.Local
+		decl = ` xmlns:x="` + xmlEscape(name.Space) + `"`
+	}
+	if inner == "" {
+		return "<" + tag + decl + "/>"
+	}
+	return "<" + tag + decl + ">" + inner + "</" + tag + ">"
+}
+
+// response adds a resource with the requested properties, or all of them
+// when requested is nil. Unknown properties are reported as 404 Not Found.
+func (ms *multistatus) response(href string, props davProps, requested []xml.Name) {
+	var found, missing []string
+	if requested == nil {
+		names := make([]xml.Name, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return names[i].Space+names[i].Local < names[j].Space+names[j].Local
+		})
+		requested = names
+	}
+	for _, name := range requested {
+		if value, ok := props[name]; ok {
+			found = append(found, element(name, value))
+		} else {
+			missing = append(missing, element(name, ""))
+		}
+	}
+
+	ms.buf.WriteString("<d:response><d:href>" + xmlEscape(href) + "</d:href>")
+	if len(found) > 0 {
+		ms.buf.WriteString("<d:propstat><d:prop>" + strings.Join(found, "") + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+	}
+	if len(missing) > 0 {
+		ms.buf.WriteString("<d:propstat><d:prop>" + strings.Join(missing, "") + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+	}
+	ms.buf.WriteString("</d:response>")
+}
+
+func (ms *multistatus) missing(href string) {
+	ms.buf.WriteString("<d:response><d:href>" + xmlEscape(href) + "</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>")
+}
+
+func (ms *multistatus) write(w http.ResponseWriter) {
+	ms.buf.WriteString("</d:multistatus>")
+	w.Header().Set("Content-Type", mediaTypeXML)
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = w.Write(ms.buf.Bytes())
+}
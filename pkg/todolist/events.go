@@ -0,0 +1,112 @@
+package todolist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+const subscriberBuffer = 64
+
+// IsEventStream reports whether r asks for server-sent events, from the
+// event feed or a GraphQL subscription. These responses stay open for as
+// long as the client listens, so are not subject to request timeouts.
+func IsEventStream(r *http.Request) bool {
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/todolist/events"):
+		return true
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/graphql"):
+		return acceptsEventStream(r)
+	}
+	return false
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// Broker fans item events relayed from the outbox out to live subscribers,
+// such as clients following the event feed. It is a store.Sink.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan structs.ItemEvent]struct{}
+	closed      bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan structs.ItemEvent]struct{}),
+	}
+}
+
+// Publish delivers an outbox event to every subscriber. Subscribers that
+// are not keeping up miss events rather than holding up the relay.
+func (b *Broker) Publish(ctx context.Context, event store.Event) error {
+	itemEvent, err := itemEventFrom(event)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- itemEvent:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel of events and a function that cancels the
+// subscription and closes the channel. The channel is also closed when the
+// broker is.
+func (b *Broker) Subscribe() (<-chan structs.ItemEvent, func()) {
+	ch := make(chan structs.ItemEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every subscription, so that streams to clients finish, and
+// drops events published afterwards.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// itemEventFrom decodes the item carried by an outbox event.
+func itemEventFrom(event store.Event) (structs.ItemEvent, error) {
+	itemEvent := structs.ItemEvent{
+		Id:         event.Id,
+		Topic:      event.Topic,
+		Item_id:    event.Aggregate_id,
+		Created_at: event.Created_at,
+	}
+	err := json.Unmarshal(event.Payload, &itemEvent.Item)
+	return itemEvent, err
+}
@@ -0,0 +1,245 @@
+package todolist
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+	FormatICal     = "ics"
+	FormatYAML     = "yaml"
+
+	MediaTypeCSV      = "text/csv"
+	MediaTypeMarkdown = "text/markdown"
+	MediaTypeCalendar = "text/calendar"
+)
+
+// ItemsFormat converts between a list of items and one of the supported
+// interchange formats.
+type ItemsFormat struct {
+	Name      string
+	MediaType string
+	Extension string
+	Encode    func(w io.Writer, items []structs.TodoItem) error
+	Decode    func(r io.Reader) ([]structs.TodoItem, error)
+}
+
+var formats = map[string]*ItemsFormat{
+	FormatJSON:     {Name: FormatJSON, MediaType: MediaTypeJSON, Extension: ".json", Encode: encodeJSON, Decode: decodeJSON},
+	FormatCSV:      {Name: FormatCSV, MediaType: MediaTypeCSV, Extension: ".csv", Encode: encodeCSV, Decode: decodeCSV},
+	FormatMarkdown: {Name: FormatMarkdown, MediaType: MediaTypeMarkdown, Extension: ".md", Encode: encodeMarkdown, Decode: decodeMarkdown},
+	FormatICal:     {Name: FormatICal, MediaType: MediaTypeCalendar, Extension: ".ics", Encode: encodeICal, Decode: decodeICal},
+	FormatTodoTxt:  {Name: FormatTodoTxt, MediaType: MediaTypeTodoTxt, Extension: ".txt", Encode: encodeTodoTxt, Decode: decodeTodoTxt},
+	FormatYAML:     {Name: FormatYAML, MediaType: MediaTypeYAML, Extension: ".yaml", Encode: encodeYAML, Decode: decodeYAML},
+}
+
+// LookupFormat returns the format with the given name.
+func LookupFormat(name string) (*ItemsFormat, error) {
+	if f, ok := formats[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", name)
+}
+
+// FormatForMediaType returns the format for a Content-Type header value, if any.
+func FormatForMediaType(mediaType string) (*ItemsFormat, bool) {
+	mediaType = strings.ToLower(strings.TrimSpace(strings.Split(mediaType, ";")[0]))
+	for _, f := range formats {
+		if f.MediaType == mediaType {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// FormatForFile returns the format matching the extension of path, if any.
+func FormatForFile(path string) (*ItemsFormat, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		if f.Extension == ext {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func encodeJSON(w io.Writer, items []structs.TodoItem) error {
+	return json.NewEncoder(w).Encode(structs.TodoItemList{Items: items, Count: len(items)})
+}
+
+// decodeJSON accepts either a TodoItemList, as served by the API, or a bare
+// array of items.
+func decodeJSON(r io.Reader) ([]structs.TodoItem, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var items []structs.TodoItem
+	if err := json.Unmarshal(raw, &items); err == nil {
+		return items, nil
+	}
+
+	var list structs.TodoItemList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+var csvHeader = []string{"id", "item", "priority", "status", "due", "completed_at", "created_at", "updated_at"}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func encodeCSV(w io.Writer, items []structs.TodoItem) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, item := range items {
+		err := cw.Write([]string{
+			item.Id,
+			item.Item,
+			strconv.Itoa(item.Priority),
+			item.Status,
+			formatOptionalTime(item.Due),
+			formatOptionalTime(item.Completed_at),
+			item.Created_at.UTC().Format(time.RFC3339),
+			item.Updated_at.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// decodeCSV maps columns by header name so that hand-edited files may omit
+// or reorder them; only the item column is required.
+func decodeCSV(r io.Reader) ([]structs.TodoItem, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["item"]; !ok {
+		return nil, fmt.Errorf("csv: missing item column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	items := make([]structs.TodoItem, 0)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		item := structs.TodoItem{
+			Id:     field(record, "id"),
+			Item:   field(record, "item"),
+			Status: strings.ToLower(field(record, "status")),
+		}
+		if v := field(record, "priority"); v != "" {
+			if item.Priority, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("csv line %d: invalid priority %q", len(items)+2, v)
+			}
+		}
+		for name, dest := range map[string]**time.Time{"due": &item.Due, "completed_at": &item.Completed_at} {
+			if v := field(record, name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return nil, fmt.Errorf("csv line %d: invalid %s %q", len(items)+2, name, v)
+				}
+				*dest = &t
+			}
+		}
+		if v := field(record, "created_at"); v != "" {
+			if item.Created_at, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, fmt.Errorf("csv line %d: invalid created_at %q", len(items)+2, v)
+			}
+		}
+		if v := field(record, "updated_at"); v != "" {
+			if item.Updated_at, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, fmt.Errorf("csv line %d: invalid updated_at %q", len(items)+2, v)
+			}
+		}
+		items = append(items, item)
+	}
+}
+
+// Markdown checklists carry the item id in an HTML comment, which renders
+// invisibly but lets an exported list be imported again without duplicates.
+// Priority is left unset so that the import appends items in line order.
+var markdownItem = regexp.MustCompile(`^\s*[-*+]\s+(?:\[([ xX])\]\s+)?(.*?)\s*(?:<!--\s*id:\s*(\S+)\s*-->)?\s*$`)
+
+func encodeMarkdown(w io.Writer, items []structs.TodoItem) error {
+	bw := bufio.NewWriter(w)
+	for _, item := range items {
+		text := strings.ReplaceAll(item.Item, "\n", " ")
+		check := " "
+		if item.IsCompleted() {
+			check = "x"
+		}
+		if _, err := fmt.Fprintf(bw, "- [%s] %s <!-- id:%s -->\n", check, text, item.Id); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func decodeMarkdown(r io.Reader) ([]structs.TodoItem, error) {
+	items := make([]structs.TodoItem, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := markdownItem.FindStringSubmatch(scanner.Text())
+		if match == nil || match[2] == "" {
+			continue
+		}
+		item := structs.TodoItem{
+			Id:   match[3],
+			Item: match[2],
+		}
+		if strings.EqualFold(match[1], "x") {
+			item.Status = structs.StatusCompleted
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
@@ -0,0 +1,742 @@
+package todolist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// AttributeParent is the attribute naming an item's parent, which makes the
+// item one of the parent's subtasks.
+const AttributeParent = "parent"
+
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+	subscription: Subscription
+}
+
+scalar Time
+
+type Query {
+	"Items in priority order, optionally filtered."
+	items(status: String, project: String, context: String, first: Int): [Item!]!
+	item(id: ID!): Item
+	list: ItemList!
+}
+
+type Mutation {
+	"Adds an item, generating its id if none is given and appending it to the list if it has no priority."
+	addItem(input: ItemInput!): Item!
+	"Changes the given fields of an item."
+	updateItem(id: ID!, input: ItemInput!): Item!
+	deleteItem(id: ID!): ID!
+	"Moves an item to a 1-based position, returning the reordered list."
+	moveItem(id: ID!, position: Int!): [Item!]!
+	importItems(items: [ItemInput!]!, dryRun: Boolean, conflict: String): ImportResult!
+}
+
+type Subscription {
+	itemChanged: ItemEvent!
+}
+
+type ItemList {
+	items: [Item!]!
+	count: Int!
+}
+
+type Item {
+	id: ID!
+	item: String!
+	priority: Int!
+	"One of needs-action, in-process, completed or cancelled."
+	status: String!
+	due: Time
+	completedAt: Time
+	createdAt: Time!
+	updatedAt: Time!
+	projects: [String!]!
+	contexts: [String!]!
+	attributes: [Attribute!]!
+	"The item named by the parent attribute."
+	parent: Item
+	"Items whose parent attribute names this item."
+	subtasks: [Item!]!
+	"Recorded changes to the item, oldest first."
+	history: [ItemEvent!]!
+}
+
+type Attribute {
+	key: String!
+	value: String!
+}
+
+type ItemEvent {
+	id: ID!
+	"One of item.created, item.updated or item.deleted."
+	topic: String!
+	itemId: ID!
+	"The item as it was after the change."
+	item: Item!
+	createdAt: Time!
+}
+
+type ImportResult {
+	dryRun: Boolean!
+	created: Int!
+	overwritten: Int!
+	renamed: Int!
+	skipped: Int!
+	items: [ImportedItem!]!
+}
+
+type ImportedItem {
+	id: ID!
+	originalId: ID
+	action: String!
+}
+
+input ItemInput {
+	id: ID
+	item: String
+	priority: Int
+	status: String
+	due: Time
+	projects: [String!]
+	contexts: [String!]
+	attributes: [AttributeInput!]
+}
+
+input AttributeInput {
+	key: String!
+	value: String!
+}
+`
+
+const graphqlMaxDepth = 10
+
+// GraphQLHandlers serves the ItemsService as a GraphQL API. If the service
+// is also an ItemsReader, nested fields are loaded in batches.
+type GraphQLHandlers struct {
+	ItemsService ItemsService
+	// Events, if set, serves subscriptions.
+	Events *Broker
+
+	schema *graphql.Schema
+}
+
+func (h *GraphQLHandlers) ConfigureRoutes(r chi.Router) {
+	h.schema = graphql.MustParseSchema(graphqlSchema, &graphqlRoot{h: h}, graphql.MaxDepth(graphqlMaxDepth))
+	r.Post("/graphql", h.serveGraphQL)
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// serveGraphQL runs a query or mutation, or, for clients accepting
+// text/event-stream, streams the results of a subscription as server-sent
+// events following the GraphQL over SSE protocol.
+func (h *GraphQLHandlers) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if err := requestAs(w, r, &req); err != nil {
+		requestError(w, err)
+		return
+	}
+	ctx := withLoaders(r.Context(), h.ItemsService)
+
+	if !acceptsEventStream(r) {
+		resp := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+		w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusNotAcceptable)
+		return
+	}
+	responses, err := h.schema.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for resp := range responses {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	_, _ = fmt.Fprint(w, "event: complete\ndata:\n\n")
+	flusher.Flush()
+}
+
+// graphqlError carries a machine-readable code, and the field errors of a
+// failed validation, in the extensions of a GraphQL error.
+type graphqlError struct {
+	err        error
+	code       string
+	extensions map[string]interface{}
+}
+
+func (e *graphqlError) Error() string { return e.err.Error() }
+
+func (e *graphqlError) Unwrap() error { return e.err }
+
+func (e *graphqlError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	for k, v := range e.extensions {
+		extensions[k] = v
+	}
+	return extensions
+}
+
+func toGraphQLError(err error) error {
+	var invalid *structs.ValidationError
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return &graphqlError{err: err, code: "NOT_FOUND"}
+	case errors.Is(err, store.ErrConflict):
+		return &graphqlError{err: err, code: "CONFLICT"}
+	case errors.Is(err, ErrQuotaExceeded):
+		return &graphqlError{err: err, code: "QUOTA_EXCEEDED"}
+	case errors.As(err, &invalid):
+		return &graphqlError{err: err, code: "BAD_USER_INPUT", extensions: map[string]interface{}{"errors": invalid.Errors}}
+	default:
+		return &graphqlError{err: errors.New("Failed"), code: "INTERNAL"}
+	}
+}
+
+type graphqlLoadersKey struct{}
+
+// graphqlLoaders holds the loaders for one request.
+type graphqlLoaders struct {
+	items    *loader[structs.TodoItem]
+	subtasks *loader[[]structs.TodoItem]
+	history  *loader[[]structs.ItemEvent]
+}
+
+func withLoaders(ctx context.Context, service ItemsService) context.Context {
+	reader, ok := service.(ItemsReader)
+	if !ok {
+		reader = unbatchedReader{service}
+	}
+
+	loaders := &graphqlLoaders{
+		items: newLoader(func(ctx context.Context, ids []string) (map[string]structs.TodoItem, error) {
+			items, err := reader.GetItems(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byId := make(map[string]structs.TodoItem, len(items))
+			for _, item := range items {
+				byId[item.Id] = item
+			}
+			return byId, nil
+		}),
+		// attributes are stored encoded, so subtasks are found by reading
+		// the whole list once, which finds the subtasks of every item,
+		// including those of subtasks further down
+		subtasks: newLoader(func(ctx context.Context, ids []string) (map[string][]structs.TodoItem, error) {
+			list, err := service.ListItems(ctx)
+			if err != nil {
+				return nil, err
+			}
+			byParent := make(map[string][]structs.TodoItem, list.Count)
+			for _, item := range list.Items {
+				if _, ok := byParent[item.Id]; !ok {
+					byParent[item.Id] = nil
+				}
+				if parent, ok := item.Attributes[AttributeParent]; ok {
+					byParent[parent] = append(byParent[parent], item)
+				}
+			}
+			return byParent, nil
+		}),
+		history: newLoader(func(ctx context.Context, ids []string) (map[string][]structs.ItemEvent, error) {
+			events, err := reader.ItemHistory(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byItem := make(map[string][]structs.ItemEvent)
+			for _, event := range events {
+				byItem[event.Item_id] = append(byItem[event.Item_id], event)
+			}
+			return byItem, nil
+		}),
+	}
+	return context.WithValue(ctx, graphqlLoadersKey{}, loaders)
+}
+
+func loadersFrom(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+}
+
+// prime readies the loaders for fields of every item in a list, including
+// parents that are not in the list.
+func (l *graphqlLoaders) prime(items []structs.TodoItem) []*itemResolver {
+	resolvers := make([]*itemResolver, len(items))
+	ids := make([]string, len(items))
+	var parents []string
+	for i, item := range items {
+		l.items.Set(item.Id, item)
+		ids[i] = item.Id
+		if parent, ok := item.Attributes[AttributeParent]; ok {
+			parents = append(parents, parent)
+		}
+		resolvers[i] = &itemResolver{item: item}
+	}
+	l.items.Prime(parents...)
+	l.subtasks.Prime(ids...)
+	l.history.Prime(ids...)
+	return resolvers
+}
+
+// unbatchedReader looks items up one at a time for services, such as the
+// API client, that are not ItemsReaders. They have no history.
+type unbatchedReader struct {
+	service ItemsService
+}
+
+func (u unbatchedReader) GetItems(ctx context.Context, ids []string) ([]structs.TodoItem, error) {
+	var items []structs.TodoItem
+	for _, id := range ids {
+		item, err := u.service.GetItem(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+func (u unbatchedReader) ItemHistory(ctx context.Context, ids []string) ([]structs.ItemEvent, error) {
+	return nil, nil
+}
+
+type graphqlRoot struct {
+	h *GraphQLHandlers
+}
+
+func (q *graphqlRoot) Items(ctx context.Context, args struct {
+	Status  *string
+	Project *string
+	Context *string
+	First   *int32
+}) ([]*itemResolver, error) {
+	list, err := q.h.ItemsService.ListItems(ctx)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	contains := func(values []string, value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	var items []structs.TodoItem
+	for _, item := range list.Items {
+		if args.Status != nil && (&itemResolver{item: item}).Status() != *args.Status {
+			continue
+		}
+		if args.Project != nil && !contains(item.Projects, *args.Project) {
+			continue
+		}
+		if args.Context != nil && !contains(item.Contexts, *args.Context) {
+			continue
+		}
+		if args.First != nil && len(items) >= int(*args.First) {
+			break
+		}
+		items = append(items, item)
+	}
+	return loadersFrom(ctx).prime(items), nil
+}
+
+func (q *graphqlRoot) Item(ctx context.Context, args struct{ Id graphql.ID }) (*itemResolver, error) {
+	item, ok, err := loadersFrom(ctx).items.Load(ctx, string(args.Id))
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &itemResolver{item: item}, nil
+}
+
+func (q *graphqlRoot) List(ctx context.Context) (*itemListResolver, error) {
+	list, err := q.h.ItemsService.ListItems(ctx)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &itemListResolver{items: loadersFrom(ctx).prime(list.Items), count: int32(list.Count)}, nil
+}
+
+type itemInput struct {
+	Id         *graphql.ID
+	Item       *string
+	Priority   *int32
+	Status     *string
+	Due        *graphql.Time
+	Projects   *[]string
+	Contexts   *[]string
+	Attributes *[]struct {
+		Key   string
+		Value string
+	}
+}
+
+// apply sets the fields given in the input.
+func (in itemInput) apply(item *structs.TodoItem) {
+	if in.Id != nil {
+		item.Id = string(*in.Id)
+	}
+	if in.Item != nil {
+		item.Item = *in.Item
+	}
+	if in.Priority != nil {
+		item.Priority = int(*in.Priority)
+	}
+	if in.Status != nil {
+		item.Status = *in.Status
+	}
+	if in.Due != nil {
+		due := in.Due.Time
+		item.Due = &due
+	}
+	if in.Projects != nil {
+		item.Projects = *in.Projects
+	}
+	if in.Contexts != nil {
+		item.Contexts = *in.Contexts
+	}
+	if in.Attributes != nil {
+		item.Attributes = make(map[string]string, len(*in.Attributes))
+		for _, attr := range *in.Attributes {
+			item.Attributes[attr.Key] = attr.Value
+		}
+	}
+}
+
+func (q *graphqlRoot) AddItem(ctx context.Context, args struct{ Input itemInput }) (*itemResolver, error) {
+	var item structs.TodoItem
+	args.Input.apply(&item)
+	if item.Id == "" {
+		item.Id = structs.NewItemId()
+	}
+	if item.Priority == 0 {
+		list, err := q.h.ItemsService.ListItems(ctx)
+		if err != nil {
+			return nil, toGraphQLError(err)
+		}
+		item.Priority = 1
+		for _, existing := range list.Items {
+			if existing.Priority >= item.Priority {
+				item.Priority = existing.Priority + 1
+			}
+		}
+	}
+
+	if err := q.h.ItemsService.AddItem(ctx, &item); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return q.reload(ctx, item.Id)
+}
+
+func (q *graphqlRoot) UpdateItem(ctx context.Context, args struct {
+	Id    graphql.ID
+	Input itemInput
+}) (*itemResolver, error) {
+	item, err := q.h.ItemsService.GetItem(ctx, string(args.Id))
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	args.Input.apply(item)
+	item.Id = string(args.Id)
+
+	if err := q.h.ItemsService.UpdateItem(ctx, item); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return q.reload(ctx, item.Id)
+}
+
+func (q *graphqlRoot) DeleteItem(ctx context.Context, args struct{ Id graphql.ID }) (graphql.ID, error) {
+	if err := q.h.ItemsService.DeleteItem(ctx, string(args.Id)); err != nil {
+		return "", toGraphQLError(err)
+	}
+	return args.Id, nil
+}
+
+func (q *graphqlRoot) MoveItem(ctx context.Context, args struct {
+	Id       graphql.ID
+	Position int32
+}) ([]*itemResolver, error) {
+	if err := q.h.ItemsService.MoveItem(ctx, string(args.Id), int(args.Position)); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	list, err := q.h.ItemsService.ListItems(ctx)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return loadersFrom(ctx).prime(list.Items), nil
+}
+
+func (q *graphqlRoot) ImportItems(ctx context.Context, args struct {
+	Items    []itemInput
+	DryRun   *bool
+	Conflict *string
+}) (*importResultResolver, error) {
+	items := make([]structs.TodoItem, len(args.Items))
+	for i, in := range args.Items {
+		in.apply(&items[i])
+	}
+	var opts structs.ImportOptions
+	if args.DryRun != nil {
+		opts.DryRun = *args.DryRun
+	}
+	if args.Conflict != nil {
+		opts.Conflict = *args.Conflict
+	}
+
+	result, err := q.h.ItemsService.ImportItems(ctx, items, opts)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &importResultResolver{result}, nil
+}
+
+// reload reads an item back after a change, so that the stored timestamps
+// are returned.
+func (q *graphqlRoot) reload(ctx context.Context, id string) (*itemResolver, error) {
+	item, err := q.h.ItemsService.GetItem(ctx, id)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &itemResolver{item: *item}, nil
+}
+
+func (q *graphqlRoot) ItemChanged(ctx context.Context) (<-chan *itemEventResolver, error) {
+	if q.h.Events == nil {
+		return nil, errors.New("subscriptions not available")
+	}
+
+	events, cancel := q.h.Events.Subscribe()
+	c := make(chan *itemEventResolver)
+	go func() {
+		defer close(c)
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				select {
+				case c <- &itemEventResolver{event}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return c, nil
+}
+
+type itemListResolver struct {
+	items []*itemResolver
+	count int32
+}
+
+func (l *itemListResolver) Items() []*itemResolver { return l.items }
+
+func (l *itemListResolver) Count() int32 { return l.count }
+
+type itemResolver struct {
+	item structs.TodoItem
+}
+
+func (r *itemResolver) Id() graphql.ID { return graphql.ID(r.item.Id) }
+
+func (r *itemResolver) Item() string { return r.item.Item }
+
+func (r *itemResolver) Priority() int32 { return int32(r.item.Priority) }
+
+func (r *itemResolver) Status() string {
+	if r.item.Status == "" {
+		return structs.StatusNeedsAction
+	}
+	return r.item.Status
+}
+
+func (r *itemResolver) Due() *graphql.Time {
+	if r.item.Due == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.item.Due}
+}
+
+func (r *itemResolver) CompletedAt() *graphql.Time {
+	if r.item.Completed_at == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.item.Completed_at}
+}
+
+func (r *itemResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.item.Created_at} }
+
+func (r *itemResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.item.Updated_at} }
+
+func (r *itemResolver) Projects() []string {
+	if r.item.Projects == nil {
+		return []string{}
+	}
+	return r.item.Projects
+}
+
+func (r *itemResolver) Contexts() []string {
+	if r.item.Contexts == nil {
+		return []string{}
+	}
+	return r.item.Contexts
+}
+
+func (r *itemResolver) Attributes() []*attributeResolver {
+	keys := make([]string, 0, len(r.item.Attributes))
+	for key := range r.item.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]*attributeResolver, len(keys))
+	for i, key := range keys {
+		attributes[i] = &attributeResolver{key: key, value: r.item.Attributes[key]}
+	}
+	return attributes
+}
+
+func (r *itemResolver) Parent(ctx context.Context) (*itemResolver, error) {
+	parent, ok := r.item.Attributes[AttributeParent]
+	if !ok {
+		return nil, nil
+	}
+	item, ok, err := loadersFrom(ctx).items.Load(ctx, parent)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &itemResolver{item: item}, nil
+}
+
+func (r *itemResolver) Subtasks(ctx context.Context) ([]*itemResolver, error) {
+	loaders := loadersFrom(ctx)
+	subtasks, _, err := loaders.subtasks.Load(ctx, r.item.Id)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return loaders.prime(subtasks), nil
+}
+
+func (r *itemResolver) History(ctx context.Context) ([]*itemEventResolver, error) {
+	events, _, err := loadersFrom(ctx).history.Load(ctx, r.item.Id)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	resolvers := make([]*itemEventResolver, len(events))
+	for i, event := range events {
+		resolvers[i] = &itemEventResolver{event}
+	}
+	return resolvers, nil
+}
+
+type attributeResolver struct {
+	key, value string
+}
+
+func (a *attributeResolver) Key() string { return a.key }
+
+func (a *attributeResolver) Value() string { return a.value }
+
+type itemEventResolver struct {
+	event structs.ItemEvent
+}
+
+func (e *itemEventResolver) Id() graphql.ID { return graphql.ID(strconv.FormatInt(e.event.Id, 10)) }
+
+func (e *itemEventResolver) Topic() string { return e.event.Topic }
+
+func (e *itemEventResolver) ItemId() graphql.ID { return graphql.ID(e.event.Item_id) }
+
+func (e *itemEventResolver) Item() *itemResolver { return &itemResolver{item: e.event.Item} }
+
+func (e *itemEventResolver) CreatedAt() graphql.Time { return graphql.Time{Time: e.event.Created_at} }
+
+type importResultResolver struct {
+	result structs.ImportResult
+}
+
+func (i *importResultResolver) DryRun() bool { return i.result.DryRun }
+
+func (i *importResultResolver) Created() int32 { return int32(i.result.Created) }
+
+func (i *importResultResolver) Overwritten() int32 { return int32(i.result.Overwritten) }
+
+func (i *importResultResolver) Renamed() int32 { return int32(i.result.Renamed) }
+
+func (i *importResultResolver) Skipped() int32 { return int32(i.result.Skipped) }
+
+func (i *importResultResolver) Items() []*importedItemResolver {
+	items := make([]*importedItemResolver, len(i.result.Items))
+	for n, item := range i.result.Items {
+		items[n] = &importedItemResolver{item}
+	}
+	return items
+}
+
+type importedItemResolver struct {
+	item structs.ImportedItem
+}
+
+func (i *importedItemResolver) Id() graphql.ID { return graphql.ID(i.item.Id) }
+
+func (i *importedItemResolver) OriginalId() *graphql.ID {
+	if i.item.Original_id == "" {
+		return nil
+	}
+	id := graphql.ID(i.item.Original_id)
+	return &id
+}
+
+func (i *importedItemResolver) Action() string { return i.item.Action }
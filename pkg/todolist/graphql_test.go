@@ -0,0 +1,264 @@
+package todolist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// countingService counts the batched lookups made through it.
+type countingService struct {
+	ItemsService
+	reader ItemsReader
+
+	mu      sync.Mutex
+	lists   int
+	gets    [][]string
+	history [][]string
+}
+
+func (c *countingService) ListItems(ctx context.Context) (structs.TodoItemList, error) {
+	c.mu.Lock()
+	c.lists++
+	c.mu.Unlock()
+	return c.ItemsService.ListItems(ctx)
+}
+
+func (c *countingService) GetItems(ctx context.Context, ids []string) ([]structs.TodoItem, error) {
+	c.mu.Lock()
+	c.gets = append(c.gets, ids)
+	c.mu.Unlock()
+	return c.reader.GetItems(ctx, ids)
+}
+
+func (c *countingService) ItemHistory(ctx context.Context, ids []string) ([]structs.ItemEvent, error) {
+	c.mu.Lock()
+	c.history = append(c.history, ids)
+	c.mu.Unlock()
+	return c.reader.ItemHistory(ctx, ids)
+}
+
+var _ = Describe("GraphQL tests", func() {
+	var service *countingService
+	var relay *store.Relay
+	var server *httptest.Server
+
+	type response struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors []struct {
+			Message    string                 `json:"message"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+
+	graphql := func(query string, variables map[string]interface{}) response {
+		body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := http.Post(server.URL+"/graphql", MediaTypeJSON, bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var result response
+		Expect(json.NewDecoder(resp.Body).Decode(&result)).To(Succeed())
+		return result
+	}
+
+	BeforeEach(func() {
+		tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+
+		todostore := store.NewSqlStore(tododb)
+		broker := NewBroker()
+		relay = store.NewRelay(todostore, broker)
+		itemsService := NewItemsService(todostore)
+		service = &countingService{ItemsService: itemsService, reader: itemsService.(ItemsReader)}
+
+		router := chi.NewRouter()
+		(&GraphQLHandlers{ItemsService: service, Events: broker}).ConfigureRoutes(router)
+		server = httptest.NewServer(router)
+		DeferCleanup(server.Close)
+	})
+
+	Specify("Nested fields are loaded in batches", func() {
+		ctx := context.Background()
+		Expect(service.AddItem(ctx, &structs.TodoItem{Id: "a", Item: "Move house", Priority: 1, Projects: []string{"home"}})).To(Succeed())
+		Expect(service.AddItem(ctx, &structs.TodoItem{Id: "b", Item: "Pack boxes", Priority: 2, Attributes: map[string]string{"parent": "a"}})).To(Succeed())
+		Expect(service.AddItem(ctx, &structs.TodoItem{Id: "c", Item: "Book van", Priority: 3, Attributes: map[string]string{"parent": "a"}})).To(Succeed())
+		Expect(service.UpdateItem(ctx, &structs.TodoItem{Id: "c", Item: "Book van", Priority: 3, Status: "completed", Attributes: map[string]string{"parent": "a"}})).To(Succeed())
+		service.lists = 0
+
+		result := graphql(`{
+			items {
+				id
+				projects
+				parent { id }
+				subtasks { id }
+				history { topic itemId }
+			}
+		}`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["items"]).To(MatchJSON(`[
+			{"id": "a", "projects": ["home"], "parent": null, "subtasks": [{"id": "b"}, {"id": "c"}], "history": [{"topic": "item.created", "itemId": "a"}]},
+			{"id": "b", "projects": [], "parent": {"id": "a"}, "subtasks": [], "history": [{"topic": "item.created", "itemId": "b"}]},
+			{"id": "c", "projects": [], "parent": {"id": "a"}, "subtasks": [], "history": [{"topic": "item.created", "itemId": "c"}, {"topic": "item.updated", "itemId": "c"}]}
+		]`))
+
+		// one list for the items and one for all their subtasks, one history
+		// lookup for all three items and no lookups for parents, which were
+		// already listed
+		Expect(service.lists).To(Equal(2))
+		Expect(service.history).To(HaveLen(1))
+		Expect(service.history[0]).To(ConsistOf("a", "b", "c"))
+		Expect(service.gets).To(BeEmpty())
+	})
+
+	Specify("Parents outside the list and nested subtasks are loaded in one batch", func() {
+		ctx := context.Background()
+		for _, item := range []structs.TodoItem{
+			{Id: "a", Item: "Move house", Priority: 1},
+			{Id: "b", Item: "Plan holiday", Priority: 2},
+			{Id: "c", Item: "Pack boxes", Priority: 3, Projects: []string{"packing"}, Attributes: map[string]string{"parent": "a"}},
+			{Id: "d", Item: "Pack suitcase", Priority: 4, Projects: []string{"packing"}, Attributes: map[string]string{"parent": "b"}},
+			{Id: "e", Item: "Buy tape", Priority: 5, Attributes: map[string]string{"parent": "c"}},
+		} {
+			item := item
+			Expect(service.AddItem(ctx, &item)).To(Succeed())
+		}
+		service.lists = 0
+
+		result := graphql(`{
+			items(project: "packing") {
+				id
+				parent { id }
+				subtasks { id subtasks { id } }
+			}
+		}`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["items"]).To(MatchJSON(`[
+			{"id": "c", "parent": {"id": "a"}, "subtasks": [{"id": "e", "subtasks": []}]},
+			{"id": "d", "parent": {"id": "b"}, "subtasks": []}
+		]`))
+
+		// one list for the items and one for the subtasks at every depth,
+		// and one lookup for both parents
+		Expect(service.lists).To(Equal(2))
+		Expect(service.gets).To(HaveLen(1))
+		Expect(service.gets[0]).To(ConsistOf("a", "b"))
+	})
+
+	Specify("Items can be filtered", func() {
+		ctx := context.Background()
+		Expect(service.AddItem(ctx, &structs.TodoItem{Id: "a", Item: "Wash car", Priority: 1, Contexts: []string{"car"}})).To(Succeed())
+		Expect(service.AddItem(ctx, &structs.TodoItem{Id: "b", Item: "Fix bike", Priority: 2, Status: "completed"})).To(Succeed())
+		Expect(service.AddItem(ctx, &structs.TodoItem{Id: "c", Item: "Sell car", Priority: 3, Contexts: []string{"car"}})).To(Succeed())
+
+		result := graphql(`{ car: items(context: "car", first: 1) { id } done: items(status: "completed") { id } list { count } }`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["car"]).To(MatchJSON(`[{"id": "a"}]`))
+		Expect(result.Data["done"]).To(MatchJSON(`[{"id": "b"}]`))
+		Expect(result.Data["list"]).To(MatchJSON(`{"count": 3}`))
+	})
+
+	Specify("Items can be changed with mutations", func() {
+		result := graphql(`mutation($input: ItemInput!) { addItem(input: $input) { id item priority attributes { key value } } }`,
+			map[string]interface{}{"input": map[string]interface{}{"item": "Wash car", "attributes": []map[string]string{{"key": "due", "value": "soon"}}}})
+		Expect(result.Errors).To(BeEmpty())
+		var added struct {
+			Id       string
+			Priority int
+		}
+		Expect(json.Unmarshal(result.Data["addItem"], &added)).To(Succeed())
+		Expect(added.Id).NotTo(BeEmpty())
+		Expect(added.Priority).To(Equal(1))
+		Expect(result.Data["addItem"]).To(MatchJSON(`{"id": "` + added.Id + `", "item": "Wash car", "priority": 1, "attributes": [{"key": "due", "value": "soon"}]}`))
+
+		result = graphql(`mutation { addItem(input: {id: "b", item: "Fix bike"}) { priority } }`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["addItem"]).To(MatchJSON(`{"priority": 2}`))
+
+		result = graphql(`mutation { updateItem(id: "b", input: {status: "completed"}) { item status completedAt } }`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		var updated struct {
+			Item        string
+			Status      string
+			CompletedAt *string
+		}
+		Expect(json.Unmarshal(result.Data["updateItem"], &updated)).To(Succeed())
+		Expect(updated.Item).To(Equal("Fix bike"))
+		Expect(updated.Status).To(Equal("completed"))
+		Expect(updated.CompletedAt).NotTo(BeNil())
+
+		result = graphql(`mutation { moveItem(id: "b", position: 1) { id } }`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["moveItem"]).To(MatchJSON(`[{"id": "b"}, {"id": "` + added.Id + `"}]`))
+
+		result = graphql(`mutation { importItems(items: [{id: "b", item: "Fix bike again", priority: 3}], conflict: "rename") { created renamed items { originalId action } } }`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["importItems"]).To(MatchJSON(`{"created": 0, "renamed": 1, "items": [{"originalId": "b", "action": "renamed"}]}`))
+
+		result = graphql(`mutation { deleteItem(id: "b") }`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["deleteItem"]).To(MatchJSON(`"b"`))
+
+		result = graphql(`{ item(id: "b") { id } }`, nil)
+		Expect(result.Errors).To(BeEmpty())
+		Expect(result.Data["item"]).To(MatchJSON(`null`))
+	})
+
+	Specify("Errors carry codes and field errors", func() {
+		result := graphql(`mutation { addItem(input: {item: "", status: "done"}) { id } }`, nil)
+		Expect(result.Errors).To(HaveLen(1))
+		Expect(result.Errors[0].Extensions).To(HaveKeyWithValue("code", "BAD_USER_INPUT"))
+		Expect(result.Errors[0].Extensions["errors"]).To(ConsistOf(
+			HaveKeyWithValue("field", "item"),
+			HaveKeyWithValue("field", "status"),
+		))
+
+		result = graphql(`mutation { deleteItem(id: "missing") }`, nil)
+		Expect(result.Errors).To(HaveLen(1))
+		Expect(result.Errors[0].Extensions).To(HaveKeyWithValue("code", "NOT_FOUND"))
+	})
+
+	Specify("Changes are streamed to subscriptions", func() {
+		body := strings.NewReader(`{"query": "subscription { itemChanged { topic itemId item { item } } }"}`)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/graphql", body)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", MediaTypeJSON)
+		req.Header.Set("Accept", "text/event-stream")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		// the subscription is made before the headers are written
+		Expect(service.AddItem(context.Background(), &structs.TodoItem{Id: "a", Item: "Wash car", Priority: 1})).To(Succeed())
+		Expect(relay.Flush(context.Background())).Error().NotTo(HaveOccurred())
+
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("event: next\n"))
+		line, err = reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimPrefix(line, "data: ")).To(MatchJSON(`{"data": {"itemChanged": {"topic": "item.created", "itemId": "a", "item": {"item": "Wash car"}}}}`))
+	})
+})
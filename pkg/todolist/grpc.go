@@ -0,0 +1,223 @@
+package todolist
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+	"go.altair.com/todolist/pkg/todolistpb"
+)
+
+// GRPCServer serves the ItemsService over gRPC, as ItemsHandlers does over
+// REST.
+type GRPCServer struct {
+	todolistpb.UnimplementedTodolistServer
+
+	ItemsService ItemsService
+	// Events, if set, serves WatchItems.
+	Events *Broker
+}
+
+func (s *GRPCServer) Register(server *grpc.Server) {
+	todolistpb.RegisterTodolistServer(server, s)
+}
+
+func (s *GRPCServer) AddItem(ctx context.Context, req *todolistpb.AddItemRequest) (*emptypb.Empty, error) {
+	item := itemFromProto(req.GetItem())
+	if err := s.ItemsService.AddItem(ctx, &item); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GRPCServer) DeleteItem(ctx context.Context, req *todolistpb.DeleteItemRequest) (*emptypb.Empty, error) {
+	if err := s.ItemsService.DeleteItem(ctx, req.GetId()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GRPCServer) UpdateItem(ctx context.Context, req *todolistpb.UpdateItemRequest) (*emptypb.Empty, error) {
+	item := itemFromProto(req.GetItem())
+	if err := s.ItemsService.UpdateItem(ctx, &item); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GRPCServer) GetItem(ctx context.Context, req *todolistpb.GetItemRequest) (*todolistpb.TodoItem, error) {
+	item, err := s.ItemsService.GetItem(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return itemToProto(item), nil
+}
+
+func (s *GRPCServer) ListItems(ctx context.Context, req *todolistpb.ListItemsRequest) (*todolistpb.ListItemsResponse, error) {
+	items, err := s.ItemsService.ListItems(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &todolistpb.ListItemsResponse{Count: int32(items.Count)}
+	for i := range items.Items {
+		resp.Items = append(resp.Items, itemToProto(&items.Items[i]))
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) ImportItems(ctx context.Context, req *todolistpb.ImportItemsRequest) (*todolistpb.ImportItemsResponse, error) {
+	items := make([]structs.TodoItem, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		items = append(items, itemFromProto(item))
+	}
+	result, err := s.ItemsService.ImportItems(ctx, items, structs.ImportOptions{DryRun: req.GetDryRun(), Conflict: req.GetConflict()})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &todolistpb.ImportItemsResponse{
+		DryRun:      result.DryRun,
+		Created:     int32(result.Created),
+		Overwritten: int32(result.Overwritten),
+		Renamed:     int32(result.Renamed),
+		Skipped:     int32(result.Skipped),
+	}
+	for _, imported := range result.Items {
+		resp.Items = append(resp.Items, &todolistpb.ImportedItem{Id: imported.Id, OriginalId: imported.Original_id, Action: imported.Action})
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) MoveItem(ctx context.Context, req *todolistpb.MoveItemRequest) (*emptypb.Empty, error) {
+	if err := s.ItemsService.MoveItem(ctx, req.GetId(), int(req.GetPosition())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GRPCServer) WatchItems(req *todolistpb.WatchItemsRequest, stream todolistpb.Todolist_WatchItemsServer) error {
+	if s.Events == nil {
+		return status.Error(codes.Unimplemented, "event feed not available")
+	}
+
+	events, cancel := s.Events.Subscribe()
+	defer cancel()
+	// let the client know it is subscribed before any events arrive
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+			err := stream.Send(&todolistpb.ItemEvent{
+				Id:     event.Id,
+				Topic:  event.Topic,
+				ItemId: event.Item_id,
+				Item:   itemToProto(&event.Item),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcError maps ItemsService errors to gRPC statuses, as serviceError does
+// to HTTP ones. Validation errors carry their field violations.
+func grpcError(err error) error {
+	var invalid *structs.ValidationError
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.As(err, &invalid):
+		st := status.New(codes.InvalidArgument, invalid.Error())
+		details := &errdetails.BadRequest{}
+		for _, fe := range invalid.Errors {
+			details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fe.Field,
+				Description: fe.Code + ": " + fe.Message,
+			})
+		}
+		if withDetails, err := st.WithDetails(details); err == nil {
+			st = withDetails
+		}
+		return st.Err()
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, "Failed")
+	}
+}
+
+func timeToProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func timeFromProto(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func itemToProto(item *structs.TodoItem) *todolistpb.TodoItem {
+	return &todolistpb.TodoItem{
+		Id:          item.Id,
+		Item:        item.Item,
+		Priority:    int32(item.Priority),
+		Status:      item.Status,
+		Due:         timeToProto(item.Due),
+		CompletedAt: timeToProto(item.Completed_at),
+		Projects:    item.Projects,
+		Contexts:    item.Contexts,
+		Attributes:  item.Attributes,
+		CreatedAt:   timeToProto(&item.Created_at),
+		UpdatedAt:   timeToProto(&item.Updated_at),
+	}
+}
+
+func itemFromProto(pb *todolistpb.TodoItem) structs.TodoItem {
+	item := structs.TodoItem{
+		Id:           pb.GetId(),
+		Item:         pb.GetItem(),
+		Priority:     int(pb.GetPriority()),
+		Status:       pb.GetStatus(),
+		Due:          timeFromProto(pb.GetDue()),
+		Completed_at: timeFromProto(pb.GetCompletedAt()),
+		Projects:     pb.GetProjects(),
+		Contexts:     pb.GetContexts(),
+		Attributes:   pb.GetAttributes(),
+	}
+	if pb.GetCreatedAt() != nil {
+		item.Created_at = pb.GetCreatedAt().AsTime()
+	}
+	if pb.GetUpdatedAt() != nil {
+		item.Updated_at = pb.GetUpdatedAt().AsTime()
+	}
+	return item
+}
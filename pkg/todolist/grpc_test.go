@@ -0,0 +1,150 @@
+package todolist
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/todolist/store"
+	"go.altair.com/todolist/pkg/todolistpb"
+)
+
+var _ = Describe("gRPC tests", func() {
+	var client todolistpb.TodolistClient
+	var relay *store.Relay
+	var ctx context.Context
+
+	BeforeEach(func() {
+		tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+
+		todostore := store.NewSqlStore(tododb)
+		broker := NewBroker()
+		relay = store.NewRelay(todostore, broker)
+
+		listener := bufconn.Listen(1 << 20)
+		server := grpc.NewServer()
+		(&GRPCServer{ItemsService: NewItemsService(todostore), Events: broker}).Register(server)
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		DeferCleanup(server.Stop)
+
+		conn, err := grpc.NewClient("passthrough:///bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+
+		client = todolistpb.NewTodolistClient(conn)
+		ctx = context.Background()
+	})
+
+	Specify("Items can be managed over gRPC", func() {
+		due := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		_, err := client.AddItem(ctx, &todolistpb.AddItemRequest{Item: &todolistpb.TodoItem{
+			Id: "grpc-1", Item: "Wash car", Priority: 1, Due: timestamppb.New(due), Projects: []string{"chores"},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.AddItem(ctx, &todolistpb.AddItemRequest{Item: &todolistpb.TodoItem{Id: "grpc-2", Item: "Fix bike", Priority: 2}})
+		Expect(err).NotTo(HaveOccurred())
+
+		item, err := client.GetItem(ctx, &todolistpb.GetItemRequest{Id: "grpc-1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(item.Item).To(Equal("Wash car"))
+		Expect(item.Due.AsTime()).To(Equal(due))
+		Expect(item.Projects).To(Equal([]string{"chores"}))
+		Expect(item.CreatedAt.AsTime()).NotTo(BeZero())
+
+		item.Status = "completed"
+		_, err = client.UpdateItem(ctx, &todolistpb.UpdateItemRequest{Item: item})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.MoveItem(ctx, &todolistpb.MoveItemRequest{Id: "grpc-2", Position: 1})
+		Expect(err).NotTo(HaveOccurred())
+
+		list, err := client.ListItems(ctx, &todolistpb.ListItemsRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.Count).To(Equal(int32(2)))
+		Expect(list.Items[0].Id).To(Equal("grpc-2"))
+		Expect(list.Items[1].CompletedAt).NotTo(BeNil())
+
+		result, err := client.ImportItems(ctx, &todolistpb.ImportItemsRequest{
+			Items:    []*todolistpb.TodoItem{{Id: "grpc-1", Item: "Duplicate"}},
+			Conflict: "rename",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Renamed).To(Equal(int32(1)))
+		Expect(result.Items[0].OriginalId).To(Equal("grpc-1"))
+
+		_, err = client.DeleteItem(ctx, &todolistpb.DeleteItemRequest{Id: "grpc-1"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Specify("Errors are mapped to status codes", func() {
+		_, err := client.GetItem(ctx, &todolistpb.GetItemRequest{Id: "missing"})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+
+		item := &todolistpb.TodoItem{Id: "grpc-1", Item: "Once", Priority: 1}
+		_, err = client.AddItem(ctx, &todolistpb.AddItemRequest{Item: item})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.AddItem(ctx, &todolistpb.AddItemRequest{Item: item})
+		Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+
+		_, err = client.AddItem(ctx, &todolistpb.AddItemRequest{Item: &todolistpb.TodoItem{Id: "grpc-2", Status: "doing"}})
+		st := status.Convert(err)
+		Expect(st.Code()).To(Equal(codes.InvalidArgument))
+		Expect(st.Details()).To(HaveLen(1))
+		violations := st.Details()[0].(*errdetails.BadRequest).FieldViolations
+		Expect(violations).To(HaveLen(3))
+		Expect(violations[0].Field).To(Equal("item"))
+		Expect(violations[2].Description).To(HavePrefix("invalid_value: "))
+
+		_, err = client.MoveItem(ctx, &todolistpb.MoveItemRequest{Id: "grpc-1"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	Specify("Changes are streamed to watchers", func() {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, err := client.WatchItems(watchCtx, &todolistpb.WatchItemsRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		// the header arrives once the server has subscribed
+		_, err = stream.Header()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.AddItem(ctx, &todolistpb.AddItemRequest{Item: &todolistpb.TodoItem{Id: "grpc-1", Item: "Wash car", Priority: 1}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.DeleteItem(ctx, &todolistpb.DeleteItemRequest{Id: "grpc-1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relay.Flush(ctx)).To(Equal(2))
+
+		event, err := stream.Recv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Topic).To(Equal(EventItemCreated))
+		Expect(event.ItemId).To(Equal("grpc-1"))
+		Expect(event.Item.Item).To(Equal("Wash car"))
+
+		event, err = stream.Recv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Topic).To(Equal(EventItemDeleted))
+
+		cancel()
+		_, err = stream.Recv()
+		Expect(status.Code(err)).To(Equal(codes.Canceled))
+	})
+})
@@ -1,12 +1,22 @@
 package todolist
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"go.altair.com/todolist/pkg/logging"
 	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
 )
 
 const (
@@ -15,60 +25,176 @@ const (
 
 type ItemsHandlers struct {
 	ItemsService ItemsService
+	// Events, if set, serves the live event feed.
+	Events *Broker
 }
 
 func (h *ItemsHandlers) ConfigureRoutes(r chi.Router) {
+	r.Get("/openapi.json", h.openAPI)
+	r.Get("/todolist.ics", h.calendarFeed)
 	r.Route("/todolist", func(r chi.Router) {
-		r.Post("/", h.createItem)
+		r.With(h.idempotent).Post("/", h.createItem)
 		r.Get("/", h.listItems)
+		r.Get("/export", h.exportItems)
+		r.With(h.idempotent).Post("/import", h.importItems)
+		r.Get("/events", h.streamEvents)
 
 		r.Route("/{id}", func(r chi.Router) {
 			r.Get("/", h.getItem)
-			r.Put("/", h.updateItem)
-			r.Delete("/", h.deleteItem)
+			r.With(h.idempotent).Put("/", h.updateItem)
+			r.With(h.idempotent).Delete("/", h.deleteItem)
+			r.With(h.idempotent).Post("/move", h.moveItem)
 		})
 	})
 }
 
-func requestAs(r *http.Request, v interface{}) error {
-	if r.ContentLength == 0 {
-		return nil
-	} else { // assume JSON by default
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(v); err != nil {
-			return err
-		}
+// MaxRequestBody caps the size of request bodies, including imports.
+const MaxRequestBody = 1 << 20
+
+// validator is implemented by request types that check their own fields.
+type validator interface {
+	Validate() error
+}
+
+// requestAs decodes a single value from the request body into v, in the
+// media type given by its Content-Type, rejecting empty bodies, unknown
+// fields and trailing data, and then validates it. Problems with the body
+// are reported as a *structs.ValidationError.
+func requestAs(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	c, err := requestCodec(r)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBody))
+	if err != nil {
+		return err
+	}
+
+	errs := &structs.ValidationError{}
+	var invalid *structs.ValidationError
+	var malformed *syntaxError
+	data, err := c.ToJSON(body, reflect.TypeOf(v))
+	switch {
+	case errors.As(err, &invalid):
+		return err
+	case errors.As(err, &malformed):
+		errs.Add("", structs.CodeMalformed, "request body is not valid "+c.Name)
+		return errs
+	case errors.Is(err, errTrailingData):
+		errs.Add("", structs.CodeTrailingData, "request body must contain a single value")
+		return errs
+	case err != nil:
+		return err
 	}
 
-	// Perform custom validation if the struct has a custom validation method
-	if todoItem, ok := v.(*structs.TodoItem); ok {
-		if err := todoItem.Validate(); err != nil {
-			return err
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, io.EOF):
+			errs.Add("", structs.CodeRequired, "request body is required")
+		case errors.As(err, &typeErr):
+			errs.Add(typeErr.Field, structs.CodeInvalidType, fmt.Sprintf("%s must be a JSON %s", typeErr.Field, jsonTypeName(typeErr.Type)))
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			errs.Add(field, structs.CodeUnknownField, fmt.Sprintf("unknown field %q", field))
+		default:
+			errs.Add("", structs.CodeInvalidJSON, "request body is not valid JSON")
 		}
+		return errs
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		errs.Add("", structs.CodeTrailingData, "request body must contain a single value")
+		return errs
 	}
 
+	if v, ok := v.(validator); ok {
+		return v.Validate()
+	}
 	return nil
 }
 
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+	return "object"
+}
+
+// requestError reports a request that could not be decoded or validated,
+// listing every problem as JSON.
+func requestError(w http.ResponseWriter, err error) {
+	var invalid *structs.ValidationError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(invalid)
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrUnsupportedMediaType), errors.Is(err, ErrNotAcceptable):
+		negotiationError(w, err)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// serviceError reports a failed ItemsService call, distinguishing missing
+// and duplicate items, exceeded quotas, retries still in progress and
+// invalid requests from other failures, which are logged.
+func serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *structs.ValidationError
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, store.ErrConflict), errors.Is(err, ErrRequestInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, &invalid):
+		requestError(w, err)
+	default:
+		logging.For(r.Context(), "todolist").Error().Ctx(r.Context()).Err(err).Str("path", r.URL.Path).Msg("Items service failed")
+		http.Error(w, "Failed", http.StatusBadRequest)
+	}
+}
+
 func (h *ItemsHandlers) createItem(w http.ResponseWriter, r *http.Request) {
 	var item structs.TodoItem
 	
-	err := requestAs(r, &item)
+	err := requestAs(w, r, &item)
 	
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		requestError(w, err)
 		return
 	}
 	
+	respond := respondWith(r, respondStatus(http.StatusAccepted))
 	err = h.ItemsService.AddItem(r.Context(), &item)
 
 	if err != nil {
 		
-		http.Error(w, "Failed", http.StatusBadRequest)
+		serviceError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	respond(w, nil)
 }
 
 func (h *ItemsHandlers) listItems(w http.ResponseWriter, r *http.Request) {
@@ -78,40 +204,60 @@ func (h *ItemsHandlers) listItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(items)
+	writeValue(w, r, http.StatusOK, items)
 }
 
 func (h *ItemsHandlers) deleteItem(w http.ResponseWriter, r *http.Request) {
 	deploymentId := chi.URLParam(r, "id")
+	respond := respondWith(r, respondStatus(http.StatusNoContent))
 	err := h.ItemsService.DeleteItem(r.Context(), deploymentId)
 	if err != nil {
-		http.Error(w, "Failed", http.StatusBadRequest)
+		serviceError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+	respond(w, nil)
 }
 
 func (h *ItemsHandlers) updateItem(w http.ResponseWriter, r *http.Request) {
 	deploymentId := chi.URLParam(r, "id")
 
 	var item structs.TodoItem
-	err := requestAs(r, &item)
+	err := requestAs(w, r, &item)
 	if err != nil {
-		http.Error(w, "Failed", http.StatusBadRequest)
+		requestError(w, err)
 		return
 	}
 
 	item.Id = deploymentId
 	
+	respond := respondWith(r, respondStatus(http.StatusAccepted))
 	err = h.ItemsService.UpdateItem(r.Context(), &item)
 	if err != nil {
-		http.Error(w, "Failed", http.StatusBadRequest)
+		serviceError(w, r, err)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *ItemsHandlers) moveItem(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var move structs.MoveRequest
+	err := requestAs(w, r, &move)
+	if err != nil {
+		requestError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	respond := respondWith(r, respondStatus(http.StatusAccepted))
+	err = h.ItemsService.MoveItem(r.Context(), id, move.Position)
+	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+
+	respond(w, nil)
 }
 
 func (h *ItemsHandlers) getItem(w http.ResponseWriter, r *http.Request) {
@@ -119,11 +265,140 @@ func (h *ItemsHandlers) getItem(w http.ResponseWriter, r *http.Request) {
 
 	deployment, err := h.ItemsService.GetItem(r.Context(), deploymentId)
 	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+
+	writeValue(w, r, http.StatusOK, deployment)
+}
+
+// requestFormat picks the interchange format from the format query
+// parameter, falling back to the given media type and then, if there is
+// none, to JSON.
+func requestFormat(r *http.Request, mediaType string) (*ItemsFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		return LookupFormat(name)
+	}
+	if f, ok := FormatForMediaType(mediaType); ok {
+		return f, nil
+	}
+	if mediaType != "" {
+		return nil, ErrUnsupportedMediaType
+	}
+	return LookupFormat(FormatJSON)
+}
+
+func (h *ItemsHandlers) exportItems(w http.ResponseWriter, r *http.Request) {
+	format, err := requestFormat(r, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Add("Content-Disposition", `attachment; filename="todolist`+format.Extension+`"`)
+	h.writeItems(w, r, format)
+}
+
+// calendarFeed serves the list as an iCalendar feed that calendar apps can
+// subscribe to.
+func (h *ItemsHandlers) calendarFeed(w http.ResponseWriter, r *http.Request) {
+	format, _ := LookupFormat(FormatICal)
+	h.writeItems(w, r, format)
+}
+
+func (h *ItemsHandlers) writeItems(w http.ResponseWriter, r *http.Request, format *ItemsFormat) {
+	items, err := h.ItemsService.ListItems(r.Context())
+	if err != nil {
+		w.Header().Del("Content-Disposition")
 		http.Error(w, "Failed", http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Add("Content-Type", format.MediaType+"; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(deployment)
+	_ = format.Encode(w, items.Items)
+}
+
+func (h *ItemsHandlers) importItems(w http.ResponseWriter, r *http.Request) {
+	// refuse before importing anything if the result cannot be sent
+	if _, err := responseCodec(r); err != nil {
+		negotiationError(w, err)
+		return
+	}
+
+	format, err := requestFormat(r, r.Header.Get("Content-Type"))
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	opts := structs.ImportOptions{Conflict: r.URL.Query().Get("conflict")}
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid dry_run", http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, err := format.Decode(http.MaxBytesReader(w, r.Body, MaxRequestBody))
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	respond := respondWith(r, func(w http.ResponseWriter, result interface{}) {
+		writeValue(w, r, http.StatusOK, result)
+	})
+	result, err := h.ItemsService.ImportItems(r.Context(), items, opts)
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrRequestInProgress) {
+		serviceError(w, r, err)
+		return
+	}
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	respond(w, result)
+}
+
+const eventKeepAlive = 30 * time.Second
+
+// streamEvents sends item changes as server-sent events until the client
+// goes away.
+func (h *ItemsHandlers) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if h.Events == nil || !ok {
+		http.Error(w, "event feed not available", http.StatusNotFound)
+		return
+	}
+
+	events, cancel := h.Events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Topic, data)
+		}
+		flusher.Flush()
+	}
 }
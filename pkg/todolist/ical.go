@@ -0,0 +1,298 @@
+package todolist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// iCalendar (RFC 5545) serialisation of items as VTODO components. Item ids
+// become UIDs so that a calendar exported from one server and imported into
+// another keeps its identity, making re-imports idempotent.
+
+const (
+	icalProdId       = "-//altair//todolist//EN"
+	icalDateTime     = "20060102T150405Z"
+	icalLocalTime    = "20060102T150405"
+	icalDate         = "20060102"
+	icalMaxLineBytes = 75
+
+	// icalOrderProperty carries the item's exact priority, which the standard
+	// PRIORITY property can only express in the range 1-9.
+	icalOrderProperty = "X-TODOLIST-PRIORITY"
+)
+
+// icalPriority maps an item priority onto the RFC 5545 scale, where 1 is the
+// highest and 9 the lowest priority.
+func icalPriority(priority int) int {
+	if priority < 1 {
+		return 0
+	}
+	if priority > 9 {
+		return 9
+	}
+	return priority
+}
+
+func encodeICal(w io.Writer, items []structs.TodoItem) error {
+	cw := &icalWriter{w: bufio.NewWriter(w)}
+	now := time.Now()
+
+	cw.property("BEGIN", "VCALENDAR")
+	cw.property("VERSION", "2.0")
+	cw.property("PRODID", icalProdId)
+	for _, item := range items {
+		cw.property("BEGIN", "VTODO")
+		cw.property("UID", icalEscape(item.Id))
+		cw.property("DTSTAMP", now.UTC().Format(icalDateTime))
+		if !item.Created_at.IsZero() {
+			cw.property("CREATED", item.Created_at.UTC().Format(icalDateTime))
+		}
+		if !item.Updated_at.IsZero() {
+			cw.property("LAST-MODIFIED", item.Updated_at.UTC().Format(icalDateTime))
+		}
+		cw.property("SUMMARY", icalEscape(item.Item))
+		cw.property("PRIORITY", strconv.Itoa(icalPriority(item.Priority)))
+		cw.property(icalOrderProperty, strconv.Itoa(item.Priority))
+		status := item.Status
+		if status == "" {
+			status = structs.StatusNeedsAction
+		}
+		cw.property("STATUS", strings.ToUpper(status))
+		if item.Due != nil && icalIsDate(*item.Due) {
+			cw.property("DUE;VALUE=DATE", item.Due.UTC().Format(icalDate))
+		} else if item.Due != nil {
+			cw.property("DUE", item.Due.UTC().Format(icalDateTime))
+		}
+		if item.Completed_at != nil {
+			cw.property("COMPLETED", item.Completed_at.UTC().Format(icalDateTime))
+		}
+		cw.property("END", "VTODO")
+	}
+	cw.property("END", "VCALENDAR")
+
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+// icalIsDate reports whether t is a date without a time of day. Dates are
+// kept as midnight UTC, as they are when imported from DATE values or
+// todo.txt, so that they are exported as DATE values again.
+func icalIsDate(t time.Time) bool {
+	t = t.UTC()
+	return t.Equal(t.Truncate(24 * time.Hour))
+}
+
+// icalWriter writes content lines, folding them at 75 octets as required by
+// RFC 5545 section 3.1, and remembers the first error.
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (cw *icalWriter) property(name, value string) {
+	if cw.err != nil {
+		return
+	}
+	line := name + ":" + value
+	for len(line) > icalMaxLineBytes {
+		cut := icalMaxLineBytes
+		// do not split a multi-byte UTF-8 sequence
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		if _, cw.err = cw.w.WriteString(line[:cut] + "\r\n"); cw.err != nil {
+			return
+		}
+		line = " " + line[cut:]
+	}
+	_, cw.err = cw.w.WriteString(line + "\r\n")
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icalEscape(s string) string {
+	return icalEscaper.Replace(s)
+}
+
+func icalUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// icalProperty is a single unfolded content line.
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func parseICalLine(line string) (icalProperty, error) {
+	// the value starts at the first colon outside a quoted parameter value
+	colon := -1
+	quoted := false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icalProperty{}, fmt.Errorf("ics: malformed line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := icalProperty{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			prop.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return prop, nil
+}
+
+func (p icalProperty) time() (time.Time, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len(icalDate) {
+		return time.Parse(icalDate, p.value)
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		return time.Parse(icalDateTime, p.value)
+	}
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	return time.ParseInLocation(icalLocalTime, p.value, loc)
+}
+
+// unfoldICal splits r into logical content lines, joining continuation lines
+// that begin with a space or tab.
+func unfoldICal(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func decodeICal(r io.Reader) ([]structs.TodoItem, error) {
+	lines, err := unfoldICal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]structs.TodoItem, 0)
+	var item *structs.TodoItem
+	var order, nested int
+	for _, line := range lines {
+		prop, err := parseICalLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case item != nil && prop.name == "BEGIN":
+			// the properties of components within the VTODO, such as
+			// VALARM, are not the item's
+			nested++
+		case nested > 0:
+			if prop.name == "END" {
+				nested--
+			}
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VTODO"):
+			item = &structs.TodoItem{}
+			order = 0
+		case prop.name == "END" && strings.EqualFold(prop.value, "VTODO"):
+			if item == nil {
+				return nil, fmt.Errorf("ics: END:VTODO without BEGIN")
+			}
+			if order > 0 {
+				item.Priority = order
+			}
+			items = append(items, *item)
+			item = nil
+		case item != nil:
+			if err := applyICalProperty(item, &order, prop); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if item != nil {
+		return nil, fmt.Errorf("ics: unterminated VTODO")
+	}
+	return items, nil
+}
+
+func applyICalProperty(item *structs.TodoItem, order *int, prop icalProperty) error {
+	var err error
+	switch prop.name {
+	case "UID":
+		item.Id = icalUnescape(prop.value)
+	case "SUMMARY":
+		item.Item = icalUnescape(prop.value)
+	case "PRIORITY":
+		// 0 means undefined, leaving the item to be appended to the list
+		if item.Priority, err = strconv.Atoi(prop.value); err != nil {
+			return fmt.Errorf("ics: invalid PRIORITY %q", prop.value)
+		}
+	case icalOrderProperty:
+		if *order, err = strconv.Atoi(prop.value); err != nil {
+			return fmt.Errorf("ics: invalid %s %q", icalOrderProperty, prop.value)
+		}
+	case "STATUS":
+		item.Status = strings.ToLower(prop.value)
+	case "DUE", "COMPLETED", "CREATED", "LAST-MODIFIED":
+		t, err := prop.time()
+		if err != nil {
+			return fmt.Errorf("ics: invalid %s %q", prop.name, prop.value)
+		}
+		switch prop.name {
+		case "DUE":
+			item.Due = &t
+		case "COMPLETED":
+			item.Completed_at = &t
+		case "CREATED":
+			item.Created_at = t
+		case "LAST-MODIFIED":
+			item.Updated_at = t
+		}
+	}
+	return nil
+}
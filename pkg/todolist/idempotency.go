@@ -0,0 +1,242 @@
+package todolist
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// IdempotencyKeyHeader is sent by clients with a change they may need to
+// retry. The first successful response to a key is saved with the change,
+// and retries with the same key get that response without the change being
+// made again. Failed requests change nothing, so are not saved.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayHeader marks responses that were saved for an earlier
+// request with the same key.
+const idempotentReplayHeader = "Idempotent-Replayed"
+
+const (
+	maxIdempotencyKey        = 250
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+)
+
+var (
+	// ErrRequestInProgress is returned for a change whose idempotency key
+	// was saved by another request while it was being made.
+	ErrRequestInProgress = errors.New("a request with this Idempotency-Key is already in progress")
+	// ErrKeyReused is returned when an idempotency key is sent with a
+	// different request than the one it was first used for.
+	ErrKeyReused = errors.New("the Idempotency-Key was used for a different request")
+)
+
+// WithIdempotencyKeyTTL sets how long responses to changes made with an
+// idempotency key are kept, by default a day.
+func WithIdempotencyKeyTTL(ttl time.Duration) ServiceOption {
+	return func(s *itemsServiceImpl) {
+		s.idempotencyKeyTTL = ttl
+	}
+}
+
+// IdempotentResponses finds the responses saved for changes made with an
+// idempotency key. The service returned by NewItemsService implements it;
+// the REST API ignores the Idempotency-Key header of services that do not.
+type IdempotentResponses interface {
+	// SavedResponse returns the response saved for the calling client's
+	// key, or store.ErrNotFound.
+	SavedResponse(ctx context.Context, key string) (*store.SavedResponse, error)
+}
+
+func (s *itemsServiceImpl) SavedResponse(ctx context.Context, key string) (*store.SavedResponse, error) {
+	var response store.SavedResponse
+	err := s.store.View(func(tx store.Txn) error {
+		return tx.GetResponse(ctx, responseOwnerFrom(ctx), key, &response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// idempotentRequest is a change requested with an idempotency key. The
+// handler sets respond, which writes its response given the result of the
+// service call, and the service saves that response in the transaction
+// making the change.
+type idempotentRequest struct {
+	owner       string
+	key         string
+	fingerprint string
+	respond     func(w http.ResponseWriter, result interface{})
+}
+
+type idempotentRequestKey struct{}
+
+// responseOwner names the client whose keys a request's key is among: the
+// owner of the items it creates, or, for clients without a certificate,
+// which all own items together, its address, as the rate limiter tells
+// them apart.
+func responseOwner(r *http.Request) string {
+	if owner := ownerOf(r.Context()); owner != "" {
+		return owner
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// responseOwnerFrom returns the owner of the key of the request made with
+// ctx, or that of the items the client creates for calls from elsewhere.
+func responseOwnerFrom(ctx context.Context) string {
+	if req, ok := ctx.Value(idempotentRequestKey{}).(*idempotentRequest); ok {
+		return req.owner
+	}
+	return ownerOf(ctx)
+}
+
+func idempotentRequestFrom(ctx context.Context) (*idempotentRequest, bool) {
+	req, ok := ctx.Value(idempotentRequestKey{}).(*idempotentRequest)
+	return req, ok && req.respond != nil
+}
+
+// respondWith sets how a change requested with r is answered once made, so
+// that the answer can be saved with the change, and returns respond.
+func respondWith(r *http.Request, respond func(w http.ResponseWriter, result interface{})) func(w http.ResponseWriter, result interface{}) {
+	if req, ok := r.Context().Value(idempotentRequestKey{}).(*idempotentRequest); ok {
+		req.respond = respond
+	}
+	return respond
+}
+
+// respondStatus answers a change with just a status code.
+func respondStatus(code int) func(w http.ResponseWriter, result interface{}) {
+	return func(w http.ResponseWriter, _ interface{}) {
+		w.WriteHeader(code)
+	}
+}
+
+// saveResponse saves the response to the change being made in tx, if it
+// was requested with an idempotency key.
+func (s *itemsServiceImpl) saveResponse(ctx context.Context, tx store.Txn, result interface{}) error {
+	req, ok := idempotentRequestFrom(ctx)
+	if !ok {
+		return nil
+	}
+
+	recorder := &responseRecorder{header: http.Header{}}
+	req.respond(recorder, result)
+	header, err := json.Marshal(recorder.header)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = tx.SaveResponse(ctx, &store.SavedResponse{
+		Owner:       req.owner,
+		Key:         req.key,
+		Fingerprint: req.fingerprint,
+		Status:      recorder.status,
+		Header:      string(header),
+		Body:        recorder.body.Bytes(),
+		Created_at:  now,
+		Expires_at:  now.Add(s.idempotencyKeyTTL),
+	})
+	if errors.Is(err, store.ErrConflict) {
+		return ErrRequestInProgress
+	}
+	return err
+}
+
+// responseRecorder keeps a response so that it can be saved.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(data)
+}
+
+// fingerprint identifies a request by its method, target, media type and
+// body, so that a key sent again with a different request is noticed.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	for _, part := range []string{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type")} {
+		_, _ = io.WriteString(h, part)
+		_, _ = h.Write([]byte{0})
+	}
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotent is middleware for changes that clients may retry with an
+// Idempotency-Key. Requests whose key has a saved response get it again,
+// unless they differ from the request it was saved for.
+func (h *ItemsHandlers) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		responses, ok := h.ItemsService.(IdempotentResponses)
+		if key == "" || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			http.Error(w, "Idempotency-Key must be at most 250 bytes", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBody))
+		if err != nil {
+			requestError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		req := &idempotentRequest{owner: responseOwner(r), key: key, fingerprint: fingerprint(r, body)}
+		ctx := context.WithValue(r.Context(), idempotentRequestKey{}, req)
+
+		saved, err := responses.SavedResponse(ctx, key)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			next.ServeHTTP(w, r.WithContext(ctx))
+		case err != nil:
+			serviceError(w, r, err)
+		case saved.Fingerprint != req.fingerprint:
+			http.Error(w, ErrKeyReused.Error(), http.StatusUnprocessableEntity)
+		default:
+			replay(w, saved)
+		}
+	})
+}
+
+// replay writes a saved response.
+func replay(w http.ResponseWriter, saved *store.SavedResponse) {
+	var header http.Header
+	_ = json.Unmarshal([]byte(saved.Header), &header)
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayHeader, "true")
+	w.WriteHeader(saved.Status)
+	_, _ = w.Write(saved.Body)
+}
@@ -0,0 +1,167 @@
+package todolist
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("Idempotency-Key tests", func() {
+	var server *httptest.Server
+	var service ItemsService
+	var tododb *sqlx.DB
+
+	// send makes a request as the client named in owner, as if it had
+	// presented a certificate for it, or, if owner is an address, as a
+	// client without one connecting from there
+	send := func(owner, method, path, key, body string) (*http.Response, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		if body != "" {
+			req.Header.Set("Content-Type", MediaTypeJSON)
+		}
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req.Header.Set("X-Test-Owner", owner)
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, string(data)
+	}
+
+	count := func() int {
+		items, err := service.ListItems(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		return items.Count
+	}
+
+	BeforeEach(func() {
+		var err error
+		tododb, err = sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+
+		service = NewItemsService(store.NewSqlStore(tododb))
+		router := chi.NewRouter()
+		router.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				owner := r.Header.Get("X-Test-Owner")
+				if _, _, err := net.SplitHostPort(owner); err == nil {
+					r.RemoteAddr = owner
+					next.ServeHTTP(w, r)
+					return
+				}
+				identity := ClientIdentity{CommonName: owner}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, identity)))
+			})
+		})
+		(&ItemsHandlers{ItemsService: service}).ConfigureRoutes(router)
+		server = httptest.NewServer(router)
+		DeferCleanup(server.Close)
+	})
+
+	Specify("Retried changes get the first response without being made again", func() {
+		resp, _ := send("alice", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resp.Header.Get(idempotentReplayHeader)).To(BeEmpty())
+
+		resp, _ = send("alice", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resp.Header.Get(idempotentReplayHeader)).To(Equal("true"))
+		Expect(count()).To(Equal(1))
+
+		// without a key every request makes its change
+		send("alice", http.MethodPost, "/todolist/", "", `{"id": "b", "item": "Wash car", "priority": 2}`)
+		resp, _ = send("alice", http.MethodPost, "/todolist/", "", `{"id": "b", "item": "Wash car", "priority": 2}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+		Expect(count()).To(Equal(2))
+	})
+
+	Specify("Responses with a body are replayed as they were", func() {
+		resp, first := send("alice", http.MethodPost, "/todolist/import", "k1", `[{"item": "Wash car"}, {"item": "Fix bike"}]`)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		resp, second := send("alice", http.MethodPost, "/todolist/import", "k1", `[{"item": "Wash car"}, {"item": "Fix bike"}]`)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(idempotentReplayHeader)).To(Equal("true"))
+		Expect(resp.Header.Get("Content-Type")).To(HavePrefix(MediaTypeJSON))
+		Expect(second).To(Equal(first))
+		Expect(count()).To(Equal(2))
+	})
+
+	Specify("Keys cannot be reused for other requests", func() {
+		send("alice", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		resp, body := send("alice", http.MethodPost, "/todolist/", "k1", `{"id": "b", "item": "Fix bike", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusUnprocessableEntity))
+		Expect(body).To(ContainSubstring(ErrKeyReused.Error()))
+		Expect(count()).To(Equal(1))
+
+		resp, _ = send("alice", http.MethodPost, "/todolist/", strings.Repeat("k", maxIdempotencyKey+1), `{"id": "b", "item": "Fix bike", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	Specify("Keys belong to the client that sent them", func() {
+		send("alice", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		resp, _ := send("bob", http.MethodPost, "/todolist/", "k1", `{"id": "b", "item": "Fix bike", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resp.Header.Get(idempotentReplayHeader)).To(BeEmpty())
+		Expect(count()).To(Equal(2))
+	})
+
+	Specify("Clients without certificates have keys of their own", func() {
+		send("192.0.2.1:1234", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		resp, _ := send("192.0.2.2:1234", http.MethodPost, "/todolist/", "k1", `{"id": "b", "item": "Fix bike", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resp.Header.Get(idempotentReplayHeader)).To(BeEmpty())
+		resp, _ = send("192.0.2.3:1234", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+		Expect(count()).To(Equal(2))
+
+		// but share them across connections from the same address
+		resp, _ = send("192.0.2.1:5678", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resp.Header.Get(idempotentReplayHeader)).To(Equal("true"))
+	})
+
+	Specify("Failed changes are not saved", func() {
+		resp, _ := send("alice", http.MethodDelete, "/todolist/missing", "k1", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		resp, _ = send("alice", http.MethodDelete, "/todolist/missing", "k1", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(resp.Header.Get(idempotentReplayHeader)).To(BeEmpty())
+	})
+
+	Specify("Items are read, and keys looked up, without waiting for writes", func() {
+		send("alice", http.MethodPost, "/todolist/", "k1", `{"id": "a", "item": "Wash car", "priority": 1}`)
+		// holds the write lock until rolled back
+		tx, err := tododb.Beginx()
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback()
+
+		ctx := context.WithValue(context.Background(), clientIdentityKey{}, ClientIdentity{CommonName: "alice"})
+		start := time.Now()
+		_, err = service.GetItem(ctx, "a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.ListItems(ctx)).To(HaveField("Count", 1))
+		Expect(service.(ItemsReader).GetItems(ctx, []string{"a"})).To(HaveLen(1))
+		Expect(service.(ItemsReader).ItemHistory(ctx, []string{"a"})).To(HaveLen(1))
+		Expect(service.(IdempotentResponses).SavedResponse(ctx, "k1")).NotTo(BeNil())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+})
@@ -0,0 +1,78 @@
+package todolist
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIdentity identifies a client by the certificate it presented over
+// mutual TLS, once verified.
+type ClientIdentity struct {
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+}
+
+// Name is the most specific name for the client: its common name, or else
+// its first email address, DNS name or URI.
+func (c ClientIdentity) Name() string {
+	for _, names := range [][]string{{c.CommonName}, c.EmailAddresses, c.DNSNames, c.URIs} {
+		if len(names) > 0 && names[0] != "" {
+			return names[0]
+		}
+	}
+	return ""
+}
+
+type clientIdentityKey struct{}
+
+// ClientIdentityFrom returns the identity IdentifyClient or WithPeerIdentity
+// found for the request, if any.
+func ClientIdentityFrom(ctx context.Context) (ClientIdentity, bool) {
+	identity, ok := ctx.Value(clientIdentityKey{}).(ClientIdentity)
+	return identity, ok
+}
+
+// IdentifyClient is middleware that makes the identity in a verified client
+// certificate available to handlers through ClientIdentityFrom.
+func IdentifyClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			identity := identityFromCertificate(r.TLS.VerifiedChains[0][0])
+			r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, identity))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithPeerIdentity does for gRPC calls what IdentifyClient does for HTTP
+// requests, returning ctx with the identity in the verified certificate of
+// the call's peer, if it presented one.
+func WithPeerIdentity(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, clientIdentityKey{}, identityFromCertificate(info.State.VerifiedChains[0][0]))
+}
+
+func identityFromCertificate(cert *x509.Certificate) ClientIdentity {
+	identity := ClientIdentity{
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	return identity
+}
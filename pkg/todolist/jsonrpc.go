@@ -0,0 +1,312 @@
+package todolist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// JSON-RPC 2.0 error codes. Codes from -32000 to -32099 are ours to define.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCItemNotFound   = -32001
+	RPCItemConflict   = -32002
+	RPCQuotaExceeded  = -32003
+)
+
+// MaxRPCBatch caps the number of requests in a JSON-RPC batch, which are
+// run one after another and count as a single request against rate limits.
+const MaxRPCBatch = 50
+
+// RPCHandlers serves the ItemsService over JSON-RPC 2.0, for scripting. The
+// items.add and items.update methods take an item, by name or as the only
+// positional parameter, and return it as stored; items.get and items.delete
+// take its id.
+type RPCHandlers struct {
+	ItemsService ItemsService
+}
+
+func (h *RPCHandlers) ConfigureRoutes(r chi.Router) {
+	r.Post("/rpc", h.serveRPC)
+}
+
+type rpcRequest struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// Id is nil for notifications, and the JSON null for requests with a
+	// null id.
+	Id json.RawMessage `json:"id,omitempty"`
+}
+
+type rpcResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+// RPCError is the error object of a JSON-RPC response. Invalid params carry
+// a *structs.ValidationError as their data.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string { return e.Message }
+
+type rpcMethod func(h *RPCHandlers, ctx context.Context, params json.RawMessage) (interface{}, error)
+
+var rpcMethods = map[string]rpcMethod{
+	"items.add": func(h *RPCHandlers, ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var item structs.TodoItem
+		if err := rpcParams(params, &item); err != nil {
+			return nil, err
+		}
+		if err := h.ItemsService.AddItem(ctx, &item); err != nil {
+			return nil, err
+		}
+		return h.ItemsService.GetItem(ctx, item.Id)
+	},
+	"items.list": func(h *RPCHandlers, ctx context.Context, params json.RawMessage) (interface{}, error) {
+		if err := rpcNoParams(params); err != nil {
+			return nil, err
+		}
+		return h.ItemsService.ListItems(ctx)
+	},
+	"items.get": func(h *RPCHandlers, ctx context.Context, params json.RawMessage) (interface{}, error) {
+		id, err := rpcItemId(params)
+		if err != nil {
+			return nil, err
+		}
+		return h.ItemsService.GetItem(ctx, id)
+	},
+	"items.update": func(h *RPCHandlers, ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var item structs.TodoItem
+		if err := rpcParams(params, &item); err != nil {
+			return nil, err
+		}
+		if err := h.ItemsService.UpdateItem(ctx, &item); err != nil {
+			return nil, err
+		}
+		return h.ItemsService.GetItem(ctx, item.Id)
+	},
+	"items.delete": func(h *RPCHandlers, ctx context.Context, params json.RawMessage) (interface{}, error) {
+		id, err := rpcItemId(params)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.ItemsService.DeleteItem(ctx, id); err != nil {
+			return nil, err
+		}
+		return id, nil
+	},
+}
+
+// serveRPC answers a request or a batch of up to MaxRPCBatch of them, in
+// order. Notifications get no response, so a request made only of
+// notifications gets an empty 204 response.
+func (h *RPCHandlers) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != MediaTypeJSON {
+			w.Header().Set("Accept", MediaTypeJSON)
+			http.Error(w, "supported media types are "+MediaTypeJSON, http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBody))
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	var result interface{}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(trimmed, &batch); err != nil {
+			result = rpcErrorResponse(nil, &RPCError{Code: RPCParseError, Message: "Parse error"})
+		} else if len(batch) == 0 {
+			result = rpcErrorResponse(nil, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request", Data: "batch is empty"})
+		} else if len(batch) > MaxRPCBatch {
+			result = rpcErrorResponse(nil, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request", Data: fmt.Sprintf("batch has more than %d requests", MaxRPCBatch)})
+		} else {
+			var responses []*rpcResponse
+			for _, raw := range batch {
+				if resp := h.call(r.Context(), raw); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if responses != nil {
+				result = responses
+			}
+		}
+	} else if resp := h.call(r.Context(), trimmed); resp != nil {
+		result = resp
+	}
+
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// call runs one request, returning nil for a notification.
+func (h *RPCHandlers) call(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	if !json.Valid(raw) {
+		return rpcErrorResponse(nil, &RPCError{Code: RPCParseError, Message: "Parse error"})
+	}
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpcErrorResponse(nil, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"})
+	}
+	if !validRPCId(req.Id) {
+		return rpcErrorResponse(nil, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request", Data: "id must be a string, number or null"})
+	}
+	if req.Jsonrpc != "2.0" || req.Method == "" {
+		return rpcErrorResponse(req.Id, &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"})
+	}
+
+	method, ok := rpcMethods[req.Method]
+	var result interface{}
+	var err error
+	if !ok {
+		err = &RPCError{Code: RPCMethodNotFound, Message: "Method not found", Data: req.Method}
+	} else {
+		result, err = method(h, ctx, req.Params)
+	}
+	if req.Id == nil {
+		return nil
+	}
+	if err != nil {
+		return rpcErrorResponse(req.Id, rpcError(err))
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	return &rpcResponse{Jsonrpc: "2.0", Result: result, Id: req.Id}
+}
+
+func validRPCId(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
+
+func rpcErrorResponse(id json.RawMessage, err *RPCError) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{Jsonrpc: "2.0", Error: err, Id: id}
+}
+
+// rpcError maps ItemsService errors to JSON-RPC errors, as serviceError does
+// to HTTP ones.
+func rpcError(err error) *RPCError {
+	var rpcErr *RPCError
+	var invalid *structs.ValidationError
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, store.ErrNotFound):
+		return &RPCError{Code: RPCItemNotFound, Message: err.Error()}
+	case errors.Is(err, store.ErrConflict):
+		return &RPCError{Code: RPCItemConflict, Message: err.Error()}
+	case errors.Is(err, ErrQuotaExceeded):
+		return &RPCError{Code: RPCQuotaExceeded, Message: err.Error()}
+	case errors.As(err, &invalid):
+		return &RPCError{Code: RPCInvalidParams, Message: "Invalid params", Data: invalid}
+	default:
+		return &RPCError{Code: RPCInternalError, Message: "Internal error"}
+	}
+}
+
+// rpcParams decodes params given by name, or as a single positional
+// parameter, into v.
+func rpcParams(params json.RawMessage, v interface{}) error {
+	params = bytes.TrimSpace(params)
+	if len(params) > 0 && params[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); err != nil || len(positional) != 1 {
+			return invalidParams("", structs.CodeInvalidValue, "params must be an object or an array of one value")
+		}
+		params = positional[0]
+	}
+	if len(params) == 0 {
+		return invalidParams("", structs.CodeRequired, "params are required")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			if typeErr.Field == "" {
+				return invalidParams("", structs.CodeInvalidType, "params must be a JSON "+jsonTypeName(typeErr.Type))
+			}
+			return invalidParams(typeErr.Field, structs.CodeInvalidType, fmt.Sprintf("%s must be a JSON %s", typeErr.Field, jsonTypeName(typeErr.Type)))
+		}
+		return invalidParams("", structs.CodeInvalidValue, err.Error())
+	}
+	return nil
+}
+
+func rpcItemId(params json.RawMessage) (string, error) {
+	var byName struct {
+		Id string `json:"id"`
+	}
+	var id string
+	if err := rpcParams(params, &id); err == nil {
+		byName.Id = id
+	} else if err := rpcParams(params, &byName); err != nil {
+		return "", err
+	}
+	if byName.Id == "" {
+		return "", invalidParams("id", structs.CodeRequired, "id is required")
+	}
+	return byName.Id, nil
+}
+
+func rpcNoParams(params json.RawMessage) error {
+	var none []json.RawMessage
+	switch p := bytes.TrimSpace(params); {
+	case len(p) == 0, bytes.Equal(p, []byte("{}")):
+		return nil
+	case json.Unmarshal(p, &none) == nil && len(none) == 0:
+		return nil
+	}
+	return invalidParams("", structs.CodeInvalidValue, "method takes no params")
+}
+
+func invalidParams(field, code, message string) error {
+	errs := &structs.ValidationError{}
+	errs.Add(field, code, message)
+	return errs
+}
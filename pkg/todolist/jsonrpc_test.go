@@ -0,0 +1,113 @@
+package todolist
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var _ = Describe("JSON-RPC tests", func() {
+	var server *httptest.Server
+
+	rpc := func(body string) (int, string) {
+		resp, err := http.Post(server.URL+"/rpc", MediaTypeJSON, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, string(data)
+	}
+
+	BeforeEach(func() {
+		tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+
+		router := chi.NewRouter()
+		(&RPCHandlers{ItemsService: NewItemsService(store.NewSqlStore(tododb))}).ConfigureRoutes(router)
+		server = httptest.NewServer(router)
+		DeferCleanup(server.Close)
+	})
+
+	Specify("Items can be managed with method calls", func() {
+		status, body := rpc(`{"jsonrpc": "2.0", "method": "items.add", "params": {"id": "a", "item": "Wash car", "priority": 1}, "id": 1}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(ContainSubstring(`"result":{"id":"a","item":"Wash car","priority":1`))
+		Expect(body).To(ContainSubstring(`"id":1}`))
+
+		status, body = rpc(`{"jsonrpc": "2.0", "method": "items.update", "params": [{"id": "a", "item": "Wash van", "priority": 1}], "id": "two"}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(ContainSubstring(`"item":"Wash van"`))
+		Expect(body).To(ContainSubstring(`"id":"two"}`))
+
+		_, body = rpc(`{"jsonrpc": "2.0", "method": "items.get", "params": ["a"], "id": 3}`)
+		Expect(body).To(ContainSubstring(`"item":"Wash van"`))
+		_, body = rpc(`{"jsonrpc": "2.0", "method": "items.list", "id": 4}`)
+		Expect(body).To(ContainSubstring(`"Count":1`))
+
+		_, body = rpc(`{"jsonrpc": "2.0", "method": "items.delete", "params": {"id": "a"}, "id": 5}`)
+		Expect(body).To(MatchJSON(`{"jsonrpc": "2.0", "result": "a", "id": 5}`))
+		_, body = rpc(`{"jsonrpc": "2.0", "method": "items.get", "params": {"id": "a"}, "id": 6}`)
+		Expect(body).To(ContainSubstring(`"code":-32001`))
+	})
+
+	Specify("Batches are answered in order, leaving out notifications", func() {
+		status, body := rpc(`[
+			{"jsonrpc": "2.0", "method": "items.add", "params": {"id": "a", "item": "Wash car", "priority": 1}},
+			{"jsonrpc": "2.0", "method": "items.add", "params": {"id": "b", "item": "Fix bike", "priority": 2}, "id": 1},
+			{"jsonrpc": "2.0", "method": "items.list", "id": 2},
+			{"jsonrpc": "2.0", "method": "items.nope", "id": 3},
+			1
+		]`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(HavePrefix(`[{"jsonrpc":"2.0","result":{"id":"b"`))
+		Expect(body).To(ContainSubstring(`"Count":2},"id":2}`))
+		Expect(body).To(ContainSubstring(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found","data":"items.nope"},"id":3}`))
+		Expect(body).To(HaveSuffix(`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]` + "\n"))
+
+		status, body = rpc(`[{"jsonrpc": "2.0", "method": "items.delete", "params": ["a"]}, {"jsonrpc": "2.0", "method": "items.delete", "params": ["b"]}]`)
+		Expect(status).To(Equal(http.StatusNoContent))
+		Expect(body).To(BeEmpty())
+		_, body = rpc(`{"jsonrpc": "2.0", "method": "items.list", "id": 1}`)
+		Expect(body).To(ContainSubstring(`"Count":0`))
+	})
+
+	DescribeTable("Bad calls get JSON-RPC errors",
+		func(request string, response string) {
+			status, body := rpc(request)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(MatchJSON(response))
+		},
+		Entry("invalid JSON", `{"jsonrpc": "2.0", "method"`,
+			`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`),
+		Entry("invalid JSON in a batch", `[{"jsonrpc": "2.0", "method": "items.list", "id": 1}, {]`,
+			`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`),
+		Entry("an empty batch", `[]`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request", "data": "batch is empty"}, "id": null}`),
+		Entry("too large a batch", "["+strings.Repeat(`{"jsonrpc": "2.0", "method": "items.list", "id": 1},`, MaxRPCBatch)+`{"jsonrpc": "2.0", "method": "items.list", "id": 1}]`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request", "data": "batch has more than 50 requests"}, "id": null}`),
+		Entry("the wrong version", `{"jsonrpc": "1.0", "method": "items.list", "id": 1}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": 1}`),
+		Entry("an object id", `{"jsonrpc": "2.0", "method": "items.list", "id": {}}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request", "data": "id must be a string, number or null"}, "id": null}`),
+		Entry("an unknown method", `{"jsonrpc": "2.0", "method": "items.nope", "id": 1}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found", "data": "items.nope"}, "id": 1}`),
+		Entry("params of the wrong type", `{"jsonrpc": "2.0", "method": "items.add", "params": {"id": "a", "item": "Wash car", "priority": "high"}, "id": 1}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32602, "message": "Invalid params", "data": {"errors": [{"field": "priority", "code": "invalid_type", "message": "priority must be a JSON integer"}]}}, "id": 1}`),
+		Entry("an invalid item", `{"jsonrpc": "2.0", "method": "items.add", "params": {"id": "a", "priority": 1}, "id": 1}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32602, "message": "Invalid params", "data": {"errors": [{"field": "item", "code": "required", "message": "item is required"}]}}, "id": 1}`),
+		Entry("a missing id", `{"jsonrpc": "2.0", "method": "items.get", "params": {}, "id": 1}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32602, "message": "Invalid params", "data": {"errors": [{"field": "id", "code": "required", "message": "id is required"}]}}, "id": 1}`),
+		Entry("a missing item", `{"jsonrpc": "2.0", "method": "items.delete", "params": ["missing"], "id": null}`,
+			`{"jsonrpc": "2.0", "error": {"code": -32001, "message": "unknown id"}, "id": null}`),
+	)
+})
@@ -0,0 +1,136 @@
+package todolist
+
+import (
+	"context"
+	"sync"
+)
+
+// loader batches lookups by key in the manner of DataLoader, so that
+// resolving a field for every item in a list costs one query rather than one
+// per item. Keys primed ahead of time, such as the ids of every item in a
+// list, are fetched along with the first key that is actually loaded, and
+// results are cached for the life of the loader, which is one request.
+// fetch may return values for more keys than it was given, which are cached
+// as well.
+type loader[V any] struct {
+	fetch func(ctx context.Context, keys []string) (map[string]V, error)
+
+	mu       sync.Mutex
+	pending  map[string]struct{}
+	inflight map[string]*loaderBatch[V]
+	cache    map[string]V
+	loaded   map[string]bool
+}
+
+// loaderBatch is a fetch in progress, whose result is shared by every caller
+// loading one of its keys.
+type loaderBatch[V any] struct {
+	done   chan struct{}
+	values map[string]V
+	err    error
+}
+
+func newLoader[V any](fetch func(ctx context.Context, keys []string) (map[string]V, error)) *loader[V] {
+	return &loader[V]{
+		fetch:    fetch,
+		pending:  make(map[string]struct{}),
+		inflight: make(map[string]*loaderBatch[V]),
+		cache:    make(map[string]V),
+		loaded:   make(map[string]bool),
+	}
+}
+
+// Prime adds keys to the next batch.
+func (l *loader[V]) Prime(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if !l.loaded[key] && l.inflight[key] == nil {
+			l.pending[key] = struct{}{}
+		}
+	}
+}
+
+// Set caches a value that is already known.
+func (l *loader[V]) Set(key string, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache[key] = value
+	l.loaded[key] = true
+	delete(l.pending, key)
+}
+
+// Load returns the value for key, reporting whether there is one. Callers
+// waiting while a batch is fetched share its result, and the loader is not
+// locked during the fetch, so keys cached already are not held up by it.
+func (l *loader[V]) Load(ctx context.Context, key string) (V, bool, error) {
+	var zero V
+
+	l.mu.Lock()
+	if l.loaded[key] {
+		value, ok := l.cache[key]
+		l.mu.Unlock()
+		return value, ok, nil
+	}
+	batch, waiting := l.inflight[key]
+	var keys []string
+	if !waiting {
+		batch, keys = l.startBatch(key)
+	}
+	l.mu.Unlock()
+
+	if waiting {
+		select {
+		case <-batch.done:
+		case <-ctx.Done():
+			return zero, false, ctx.Err()
+		}
+	} else {
+		l.finishBatch(ctx, batch, keys)
+	}
+
+	if batch.err != nil {
+		return zero, false, batch.err
+	}
+	value, ok := batch.values[key]
+	return value, ok, nil
+}
+
+// startBatch moves the pending keys, and key, into a new batch and returns
+// them. l.mu must be held.
+func (l *loader[V]) startBatch(key string) (*loaderBatch[V], []string) {
+	batch := &loaderBatch[V]{done: make(chan struct{})}
+	l.pending[key] = struct{}{}
+	keys := make([]string, 0, len(l.pending))
+	for k := range l.pending {
+		keys = append(keys, k)
+		l.inflight[k] = batch
+	}
+	l.pending = make(map[string]struct{})
+	return batch, keys
+}
+
+// finishBatch fetches the keys of batch and caches the result. Keys whose
+// fetch fails are not cached, so can be loaded again.
+func (l *loader[V]) finishBatch(ctx context.Context, batch *loaderBatch[V], keys []string) {
+	defer close(batch.done)
+
+	batch.values, batch.err = l.fetch(ctx, keys)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		delete(l.inflight, k)
+		if batch.err == nil {
+			l.loaded[k] = true
+		}
+	}
+	if batch.err != nil {
+		return
+	}
+	for k, v := range batch.values {
+		l.cache[k] = v
+		l.loaded[k] = true
+		delete(l.pending, k)
+	}
+}
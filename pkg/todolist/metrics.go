@@ -0,0 +1,51 @@
+package todolist
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"go.altair.com/todolist/pkg/logging"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var itemsDesc = prometheus.NewDesc("todolist_items", "Items in the list, by status.", []string{"status"}, nil)
+
+// itemsCollector counts the items in the store by status each time metrics
+// are gathered.
+type itemsCollector struct {
+	store store.Store
+}
+
+// NewItemsCollector returns a Prometheus collector reporting the number of
+// items in s with each status. Items without a status are counted as
+// needing action.
+func NewItemsCollector(s store.Store) prometheus.Collector {
+	return &itemsCollector{store: s}
+}
+
+func (c *itemsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- itemsDesc
+}
+
+func (c *itemsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts := map[string]int{}
+	err := c.store.View(func(tx store.Txn) error {
+		return tx.CountByStatus(ctx, counts)
+	})
+	if err != nil {
+		logging.For(ctx, "todolist").Warn().Err(err).Msg("Failed to count items for metrics")
+		ch <- prometheus.NewInvalidMetric(itemsDesc, err)
+		return
+	}
+
+	counts[structs.StatusNeedsAction] += counts[""]
+	for _, status := range []string{structs.StatusNeedsAction, structs.StatusInProcess, structs.StatusCompleted, structs.StatusCancelled} {
+		ch <- prometheus.MustNewConstMetric(itemsDesc, prometheus.GaugeValue, float64(counts[status]), status)
+	}
+}
@@ -0,0 +1,415 @@
+package todolist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+const (
+	MediaTypeYAML = "application/yaml"
+	MediaTypeForm = "application/x-www-form-urlencoded"
+)
+
+var (
+	// ErrUnsupportedMediaType is returned for request bodies in a media
+	// type the handlers cannot read.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	// ErrNotAcceptable is returned when none of the media types a client
+	// accepts can be written.
+	ErrNotAcceptable = errors.New("not acceptable")
+)
+
+// Request and response bodies are converted to and from JSON, so that every
+// media type is decoded with the same strict rules and field names.
+type codec struct {
+	Name      string
+	MediaType string
+	Aliases   []string
+	// ToJSON converts a request body to JSON for a value of type t.
+	ToJSON func(body []byte, t reflect.Type) ([]byte, error)
+	// FromJSON converts JSON to the response body, and is nil for media
+	// types that are only accepted in requests.
+	FromJSON func(data []byte) ([]byte, error)
+}
+
+// codecs lists the media types for request and response bodies, the first
+// being the default.
+var codecs = []*codec{
+	{Name: "JSON", MediaType: MediaTypeJSON, ToJSON: func(body []byte, t reflect.Type) ([]byte, error) { return body, nil }, FromJSON: func(data []byte) ([]byte, error) { return data, nil }},
+	{Name: "YAML", MediaType: MediaTypeYAML, Aliases: []string{"application/x-yaml", "text/yaml", "text/x-yaml"}, ToJSON: yamlToJSON, FromJSON: jsonToYAML},
+	{Name: "form data", MediaType: MediaTypeForm, ToJSON: formToJSON},
+}
+
+func (c *codec) matches(mediaType string) bool {
+	if mediaType == c.MediaType {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if mediaType == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// requestCodec picks the codec for a request body from its Content-Type,
+// treating a missing Content-Type as JSON.
+func requestCodec(r *http.Request) (*codec, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return codecs[0], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+	for _, c := range codecs {
+		if c.matches(mediaType) {
+			return c, nil
+		}
+	}
+	return nil, ErrUnsupportedMediaType
+}
+
+// responseCodec picks the codec for a response body from the Accept header.
+func responseCodec(r *http.Request) (*codec, error) {
+	var offers []string
+	for _, c := range codecs {
+		if c.FromJSON != nil {
+			offers = append(offers, c.MediaType)
+		}
+	}
+	mediaType, ok := negotiate(r.Header.Get("Accept"), offers)
+	if !ok {
+		return nil, ErrNotAcceptable
+	}
+	for _, c := range codecs {
+		if c.MediaType == mediaType {
+			return c, nil
+		}
+	}
+	return nil, ErrNotAcceptable
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate returns the offer a client most prefers according to an Accept
+// header, preferring earlier offers when the client does not mind. Aliases
+// of an offer are matched too.
+func negotiate(accept string, offers []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	// more specific ranges take precedence over wildcards
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		names := []string{offer}
+		for _, c := range codecs {
+			if c.MediaType == offer {
+				names = append(names, c.Aliases...)
+			}
+		}
+
+		q, matched := 0.0, false
+		for _, rng := range ranges {
+			for _, name := range names {
+				if mediaRangeMatches(rng.mediaType, name) {
+					q, matched = rng.q, true
+					break
+				}
+			}
+			if matched {
+				break
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+func mediaRangeMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return false
+}
+
+// writeValue writes v with the given status in the media type the client
+// prefers.
+func writeValue(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	c, err := responseCodec(r)
+	if err != nil {
+		negotiationError(w, err)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		data, err = c.FromJSON(data)
+	}
+	if err != nil {
+		http.Error(w, "Failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", c.MediaType+"; charset=UTF-8")
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	if c.MediaType == MediaTypeJSON {
+		// match json.Encoder, which ends values with a newline
+		data = append(data, '\n')
+	}
+	_, _ = w.Write(data)
+}
+
+// negotiationError reports a request whose Content-Type or Accept header
+// cannot be satisfied.
+func negotiationError(w http.ResponseWriter, err error) {
+	var offered []string
+	for _, c := range codecs {
+		if errors.Is(err, ErrNotAcceptable) && c.FromJSON == nil {
+			continue
+		}
+		offered = append(offered, c.MediaType)
+	}
+
+	if errors.Is(err, ErrNotAcceptable) {
+		http.Error(w, "acceptable media types are "+strings.Join(offered, ", "), http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Set("Accept", strings.Join(offered, ", "))
+	http.Error(w, "supported media types are "+strings.Join(offered, ", "), http.StatusUnsupportedMediaType)
+}
+
+func yamlToJSON(body []byte, t reflect.Type) ([]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		if errors.Is(err, io.EOF) {
+			// an empty document, reported as an empty body
+			return nil, nil
+		}
+		return nil, &syntaxError{err}
+	}
+	var extra interface{}
+	if err := decoder.Decode(&extra); !errors.Is(err, io.EOF) {
+		return nil, errTrailingData
+	}
+	return json.Marshal(jsonCompatible(v))
+}
+
+// jsonCompatible converts timestamps, which YAML resolves for unquoted
+// dates, into the form encoding/json produces.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = jsonCompatible(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonCompatible(value)
+		}
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// jsonToYAML re-encodes JSON as block-style YAML, keeping the order of
+// fields.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	// the encoder quotes any string that would otherwise read as another type
+	var blockStyle func(n *yaml.Node)
+	blockStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			blockStyle(child)
+		}
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
+
+// formToJSON converts a form submission into JSON for a struct, using the
+// JSON field names and converting values according to the field types.
+// Repeated or comma-separated values fill slices, and bare dates fill
+// times.
+func formToJSON(body []byte, t reflect.Type) ([]byte, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, &syntaxError{err}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if name != "-" && field.IsExported() {
+			fields[name] = field.Type
+		}
+	}
+
+	errs := &structs.ValidationError{}
+	out := map[string]interface{}{}
+	for key, vals := range values {
+		fieldType, ok := fields[key]
+		if !ok {
+			errs.Add(key, structs.CodeUnknownField, fmt.Sprintf("unknown field %q", key))
+			continue
+		}
+		value := vals[len(vals)-1]
+		if fieldType.Kind() == reflect.Ptr {
+			if value == "" {
+				continue
+			}
+			fieldType = fieldType.Elem()
+		}
+
+		switch {
+		case fieldType == reflect.TypeOf(time.Time{}):
+			if t, err := time.Parse("2006-01-02", value); err == nil {
+				out[key] = t
+			} else {
+				out[key] = value
+			}
+		case fieldType.Kind() == reflect.Slice:
+			var items []string
+			for _, v := range vals {
+				for _, item := range strings.Split(v, ",") {
+					if item = strings.TrimSpace(item); item != "" {
+						items = append(items, item)
+					}
+				}
+			}
+			out[key] = items
+		case fieldType.Kind() == reflect.Int || fieldType.Kind() == reflect.Int64:
+			if value == "" {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs.Add(key, structs.CodeInvalidType, key+" must be an integer")
+				continue
+			}
+			out[key] = n
+		case fieldType.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs.Add(key, structs.CodeInvalidType, key+" must be true or false")
+				continue
+			}
+			out[key] = b
+		case fieldType.Kind() == reflect.String:
+			out[key] = value
+		default:
+			errs.Add(key, structs.CodeInvalidType, key+" cannot be set from a form")
+		}
+	}
+	if err := errs.Err(); err != nil {
+		sort.Slice(errs.Errors, func(i, j int) bool { return errs.Errors[i].Field < errs.Errors[j].Field })
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+var errTrailingData = errors.New("trailing data")
+
+// syntaxError marks a request body that could not be parsed in its own
+// media type.
+type syntaxError struct {
+	err error
+}
+
+func (e *syntaxError) Error() string { return e.err.Error() }
+
+func (e *syntaxError) Unwrap() error { return e.err }
+
+func encodeYAML(w io.Writer, items []structs.TodoItem) error {
+	data, err := json.Marshal(structs.TodoItemList{Items: items, Count: len(items)})
+	if err == nil {
+		data, err = jsonToYAML(data)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// decodeYAML accepts the same shapes as decodeJSON.
+func decodeYAML(r io.Reader) ([]structs.TodoItem, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := yamlToJSON(body, nil)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return decodeJSON(bytes.NewReader(data))
+}
@@ -0,0 +1,371 @@
+package todolist
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// The OpenAPI document for the REST API. Operations are declared next to
+// the routes they describe, and the schemas are generated from the structs
+// the handlers encode, so the document follows changes to either.
+
+const openAPIVersion = "3.1.0"
+
+type apiParameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      map[string]interface{}
+}
+
+type apiOperation struct {
+	Method      string
+	Path        string
+	OperationId string
+	Summary     string
+	Parameters  []apiParameter
+	// Request and Responses map media types to the Go values, or schemas,
+	// that are sent; nil content means no body
+	Request   map[string]interface{}
+	Responses map[int]apiResponse
+}
+
+type apiResponse struct {
+	Description string
+	Content     map[string]interface{}
+}
+
+var idParameter = apiParameter{Name: "id", In: "path", Description: "Item id", Required: true, Schema: map[string]interface{}{"type": "string"}}
+
+var idempotencyKeyParameter = apiParameter{
+	Name:        IdempotencyKeyHeader,
+	In:          "header",
+	Description: "Makes the change safe to retry: a retry with the same key gets the first response rather than making the change again",
+	Schema:      map[string]interface{}{"type": "string", "maxLength": maxIdempotencyKey},
+}
+
+var formatParameter = apiParameter{
+	Name:        "format",
+	In:          "query",
+	Description: "Interchange format, overriding the media type",
+	Schema:      map[string]interface{}{"type": "string", "enum": formatNames()},
+}
+
+var (
+	badRequest = apiResponse{Description: "The request was invalid", Content: map[string]interface{}{MediaTypeJSON: structs.ValidationError{}, "text/plain": map[string]interface{}{"type": "string"}}}
+	notFound   = apiResponse{Description: "No item has the id", Content: errorContent}
+	conflict   = apiResponse{Description: "An item already has the id", Content: errorContent}
+	tooLarge   = apiResponse{Description: "The request body is too large", Content: errorContent}
+	keyReused  = apiResponse{Description: "The Idempotency-Key was used for a different request", Content: errorContent}
+
+	unsupported   = apiResponse{Description: "The request body is in a media type that is not supported", Content: errorContent}
+	notAcceptable = apiResponse{Description: "None of the acceptable media types can be sent", Content: errorContent}
+)
+
+var errorContent = map[string]interface{}{"text/plain": map[string]interface{}{"type": "string"}}
+
+// itemsOperations describes the routes in ItemsHandlers.ConfigureRoutes.
+var itemsOperations = []apiOperation{
+	{
+		Method: http.MethodGet, Path: "/openapi.json", OperationId: "getOpenAPI",
+		Summary:   "This document",
+		Responses: map[int]apiResponse{http.StatusOK: {Description: "The OpenAPI document", Content: map[string]interface{}{MediaTypeJSON: map[string]interface{}{"type": "object"}}}},
+	},
+	{
+		Method: http.MethodGet, Path: "/todolist.ics", OperationId: "getCalendarFeed",
+		Summary:   "The list as an iCalendar feed of VTODO components",
+		Responses: map[int]apiResponse{http.StatusOK: {Description: "The calendar", Content: map[string]interface{}{MediaTypeCalendar: map[string]interface{}{"type": "string"}}}, http.StatusBadRequest: badRequest},
+	},
+	{
+		Method: http.MethodPost, Path: "/todolist", OperationId: "addItem",
+		Summary:    "Adds an item",
+		Parameters: []apiParameter{idempotencyKeyParameter},
+		Request:    requestContent(structs.TodoItem{}),
+		Responses:  map[int]apiResponse{http.StatusAccepted: {Description: "The item was added"}, http.StatusBadRequest: badRequest, http.StatusRequestEntityTooLarge: tooLarge, http.StatusUnsupportedMediaType: unsupported, http.StatusConflict: conflict, http.StatusUnprocessableEntity: keyReused},
+	},
+	{
+		Method: http.MethodGet, Path: "/todolist", OperationId: "listItems",
+		Summary:   "Lists the items in priority order",
+		Responses: map[int]apiResponse{http.StatusOK: {Description: "The items", Content: responseContent(structs.TodoItemList{})}, http.StatusBadRequest: badRequest, http.StatusNotAcceptable: notAcceptable},
+	},
+	{
+		Method: http.MethodGet, Path: "/todolist/export", OperationId: "exportItems",
+		Summary:    "Downloads the list in an interchange format",
+		Parameters: []apiParameter{formatParameter},
+		Responses:  map[int]apiResponse{http.StatusOK: {Description: "The list as an attachment", Content: formatContent()}, http.StatusBadRequest: badRequest},
+	},
+	{
+		Method: http.MethodPost, Path: "/todolist/import", OperationId: "importItems",
+		Summary: "Imports items in an interchange format",
+		Parameters: []apiParameter{
+			formatParameter,
+			idempotencyKeyParameter,
+			{Name: "dry_run", In: "query", Description: "Report what would change without changing anything", Schema: map[string]interface{}{"type": "boolean"}},
+			{Name: "conflict", In: "query", Description: "What to do when an item id already exists", Schema: map[string]interface{}{"type": "string", "enum": []string{structs.ConflictSkip, structs.ConflictOverwrite, structs.ConflictRename}}},
+		},
+		Request:   formatContent(),
+		Responses: map[int]apiResponse{http.StatusOK: {Description: "What was imported", Content: responseContent(structs.ImportResult{})}, http.StatusBadRequest: badRequest, http.StatusNotAcceptable: notAcceptable, http.StatusRequestEntityTooLarge: tooLarge, http.StatusUnsupportedMediaType: unsupported, http.StatusUnprocessableEntity: keyReused},
+	},
+	{
+		Method: http.MethodGet, Path: "/todolist/events", OperationId: "streamEvents",
+		Summary: "Follows changes to items as server-sent events",
+		Responses: map[int]apiResponse{
+			http.StatusOK:       {Description: "A stream of events whose data is an ItemEvent", Content: map[string]interface{}{"text/event-stream": structs.ItemEvent{}}},
+			http.StatusNotFound: {Description: "The server has no event feed", Content: errorContent},
+		},
+	},
+	{
+		Method: http.MethodGet, Path: "/todolist/{id}", OperationId: "getItem",
+		Summary:    "Gets an item",
+		Parameters: []apiParameter{idParameter},
+		Responses:  map[int]apiResponse{http.StatusOK: {Description: "The item", Content: responseContent(structs.TodoItem{})}, http.StatusNotFound: notFound, http.StatusNotAcceptable: notAcceptable},
+	},
+	{
+		Method: http.MethodPut, Path: "/todolist/{id}", OperationId: "updateItem",
+		Summary:    "Replaces an item",
+		Parameters: []apiParameter{idParameter, idempotencyKeyParameter},
+		Request:    requestContent(structs.TodoItem{}),
+		Responses:  map[int]apiResponse{http.StatusAccepted: {Description: "The item was updated"}, http.StatusBadRequest: badRequest, http.StatusRequestEntityTooLarge: tooLarge, http.StatusUnsupportedMediaType: unsupported, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: keyReused},
+	},
+	{
+		Method: http.MethodDelete, Path: "/todolist/{id}", OperationId: "deleteItem",
+		Summary:    "Deletes an item",
+		Parameters: []apiParameter{idParameter, idempotencyKeyParameter},
+		Responses:  map[int]apiResponse{http.StatusNoContent: {Description: "The item was deleted"}, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: keyReused},
+	},
+	{
+		Method: http.MethodPost, Path: "/todolist/{id}/move", OperationId: "moveItem",
+		Summary:    "Moves an item to a position in the list, renumbering priorities",
+		Parameters: []apiParameter{idParameter, idempotencyKeyParameter},
+		Request:    requestContent(structs.MoveRequest{}),
+		Responses:  map[int]apiResponse{http.StatusAccepted: {Description: "The item was moved"}, http.StatusBadRequest: badRequest, http.StatusRequestEntityTooLarge: tooLarge, http.StatusUnsupportedMediaType: unsupported, http.StatusNotFound: notFound, http.StatusUnprocessableEntity: keyReused},
+	},
+}
+
+// requestContent offers every media type requests can be sent in.
+func requestContent(v interface{}) map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, c := range codecs {
+		content[c.MediaType] = v
+	}
+	return content
+}
+
+// responseContent offers every media type responses can be sent in.
+func responseContent(v interface{}) map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, c := range codecs {
+		if c.FromJSON != nil {
+			content[c.MediaType] = v
+		}
+	}
+	return content
+}
+
+func formatNames() []string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatContent() map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, format := range formats {
+		if format.Name == FormatJSON {
+			content[format.MediaType] = map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/TodoItem"}}
+		} else {
+			content[format.MediaType] = map[string]interface{}{"type": "string"}
+		}
+	}
+	return content
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+)
+
+// OpenAPISpec returns the OpenAPI document for the REST API as JSON.
+func OpenAPISpec() []byte {
+	openAPIOnce.Do(func() {
+		openAPIDoc, _ = json.MarshalIndent(buildOpenAPI(), "", "  ")
+	})
+	return openAPIDoc
+}
+
+func (h *ItemsHandlers) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(OpenAPISpec())
+}
+
+func buildOpenAPI() map[string]interface{} {
+	schemas := schemaSet{}
+	paths := map[string]map[string]interface{}{}
+
+	content := func(media map[string]interface{}) map[string]interface{} {
+		out := map[string]interface{}{}
+		for mediaType, v := range media {
+			schema, ok := v.(map[string]interface{})
+			if !ok {
+				schema = schemas.ref(reflect.TypeOf(v))
+			}
+			out[mediaType] = map[string]interface{}{"schema": schema}
+		}
+		return out
+	}
+
+	for _, op := range itemsOperations {
+		operation := map[string]interface{}{
+			"operationId": op.OperationId,
+			"summary":     op.Summary,
+		}
+		if len(op.Parameters) > 0 {
+			var params []interface{}
+			for _, p := range op.Parameters {
+				param := map[string]interface{}{"name": p.Name, "in": p.In, "schema": p.Schema}
+				if p.Description != "" {
+					param["description"] = p.Description
+				}
+				if p.Required {
+					param["required"] = true
+				}
+				params = append(params, param)
+			}
+			operation["parameters"] = params
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{"required": true, "content": content(op.Request)}
+		}
+		responses := map[string]interface{}{}
+		for status, resp := range op.Responses {
+			response := map[string]interface{}{"description": resp.Description}
+			if resp.Content != nil {
+				response["content"] = content(resp.Content)
+			}
+			responses[strconv.Itoa(status)] = response
+		}
+		operation["responses"] = responses
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	// the status field only accepts the VTODO statuses
+	if item, ok := schemas["TodoItem"]; ok {
+		item["properties"].(map[string]interface{})["status"] = map[string]interface{}{
+			"type": "string",
+			"enum": []string{"", structs.StatusNeedsAction, structs.StatusInProcess, structs.StatusCompleted, structs.StatusCancelled},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "Todolist API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// schemaSet collects JSON schemas for named struct types as they are
+// referenced.
+type schemaSet map[string]map[string]interface{}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s schemaSet) ref(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Struct && t != timeType {
+		if _, ok := s[t.Name()]; !ok {
+			// reserve the name first in case the type refers to itself
+			s[t.Name()] = map[string]interface{}{}
+			s[t.Name()] = s.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return s.schema(t)
+}
+
+func (s schemaSet) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.ref(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]interface{}{"oneOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+		}
+		schema["type"] = []interface{}{schema["type"], "null"}
+		return schema
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		return s.ref(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema follows the encoding/json rules for field names, treating
+// fields without omitempty as required.
+func (s schemaSet) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		omitempty := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				omitempty = omitempty || opt == "omitempty"
+			}
+		}
+		properties[name] = s.schema(field.Type)
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
@@ -0,0 +1,99 @@
+package todolist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var testingT *testing.T
+
+func TestTodolist(t *testing.T) {
+	testingT = t
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "todolist suite")
+}
+
+type openAPIDocument struct {
+	Openapi    string
+	Paths      map[string]map[string]json.RawMessage
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage
+			Required   []string
+		}
+	}
+}
+
+var _ = Describe("OpenAPI tests", func() {
+	var router *chi.Mux
+	var doc openAPIDocument
+
+	BeforeEach(func() {
+		router = chi.NewRouter()
+		(&ItemsHandlers{}).ConfigureRoutes(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(HavePrefix(MediaTypeJSON))
+		Expect(json.Unmarshal(w.Body.Bytes(), &doc)).To(Succeed())
+	})
+
+	Specify("Every registered route is described", func() {
+		Expect(doc.Openapi).To(Equal("3.1.0"))
+
+		routes := 0
+		err := chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			routes++
+			path := route
+			if len(path) > 1 {
+				path = strings.TrimSuffix(path, "/")
+			}
+			Expect(doc.Paths).To(HaveKey(path), "route %s %s is missing from the spec", method, route)
+			Expect(doc.Paths[path]).To(HaveKey(strings.ToLower(method)), "route %s %s is missing from the spec", method, route)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		operations := 0
+		for _, methods := range doc.Paths {
+			operations += len(methods)
+		}
+		Expect(operations).To(Equal(routes), "the spec describes routes that are not registered")
+	})
+
+	Specify("Schemas are generated from the structs", func() {
+		item := doc.Components.Schemas["TodoItem"]
+		Expect(item.Properties).To(HaveKey("id"))
+		Expect(item.Properties).To(HaveKey("due"))
+		Expect(item.Properties).To(HaveKey("projects"))
+		Expect(item.Required).To(ContainElements("id", "item", "priority"))
+		Expect(item.Required).NotTo(ContainElement("due"))
+		Expect(string(item.Properties["status"])).To(ContainSubstring(`"completed"`))
+		Expect(string(item.Properties["due"])).To(ContainSubstring(`"null"`))
+
+		Expect(doc.Components.Schemas["TodoItemList"].Properties).To(HaveKey("Items"))
+		Expect(doc.Components.Schemas).To(HaveKey("ImportResult"))
+		Expect(doc.Components.Schemas).To(HaveKey("ImportedItem"))
+		Expect(doc.Components.Schemas).To(HaveKey("MoveRequest"))
+
+		var getItem struct {
+			Parameters []struct{ Name, In string }
+			Responses  map[string]json.RawMessage
+		}
+		Expect(json.Unmarshal(doc.Paths["/todolist/{id}"]["get"], &getItem)).To(Succeed())
+		Expect(getItem.Parameters).To(ConsistOf(HaveField("Name", "id")))
+		Expect(getItem.Responses).To(HaveKey("200"))
+		Expect(getItem.Responses).To(HaveKey("404"))
+		Expect(string(getItem.Responses["200"])).To(ContainSubstring("#/components/schemas/TodoItem"))
+	})
+})
@@ -2,32 +2,82 @@ package todolist
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
+	"go.altair.com/todolist/pkg/logging"
 	"go.altair.com/todolist/pkg/structs"
 	"go.altair.com/todolist/pkg/todolist/store"
 )
 
+const (
+	EventItemCreated = "item.created"
+	EventItemUpdated = "item.updated"
+	EventItemDeleted = "item.deleted"
+)
+
 type ItemsService interface {
 	AddItem(ctx context.Context, def *structs.TodoItem) error
 	DeleteItem(ctx context.Context, id string) error
 	UpdateItem(ctx context.Context, def *structs.TodoItem) error
 	GetItem(ctx context.Context, id string) (*structs.TodoItem, error)
 	ListItems(ctx context.Context) (structs.TodoItemList, error)
+	ImportItems(ctx context.Context, items []structs.TodoItem, opts structs.ImportOptions) (structs.ImportResult, error)
+	MoveItem(ctx context.Context, id string, position int) error
+}
+
+// ItemsReader answers the batched lookups behind GraphQL queries. The
+// service returned by NewItemsService implements it.
+type ItemsReader interface {
+	// GetItems returns the items with the given ids, leaving out unknown ids.
+	GetItems(ctx context.Context, ids []string) ([]structs.TodoItem, error)
+	// ItemHistory returns the recorded changes to the given items, oldest
+	// first. Changes are forgotten once the relay prunes their events.
+	ItemHistory(ctx context.Context, ids []string) ([]structs.ItemEvent, error)
 }
 
-func NewItemsService(s store.Store) ItemsService {
-	return &itemsServiceImpl{
-		store: s,
+// ErrQuotaExceeded is returned when adding items would leave a client with
+// more than its quota.
+var ErrQuotaExceeded = errors.New("item quota exceeded")
+
+// ErrPreconditionFailed is returned when a change is made with a
+// precondition that the item does not meet.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ServiceOption configures the service returned by NewItemsService.
+type ServiceOption func(*itemsServiceImpl)
+
+// WithItemQuota caps the number of items each identified client may own,
+// counting those it created. Zero means no cap. Clients that are not
+// identified by a ClientIdentity are not limited.
+func WithItemQuota(items int) ServiceOption {
+	return func(s *itemsServiceImpl) {
+		s.itemQuota = items
+	}
+}
+
+func NewItemsService(s store.Store, opts ...ServiceOption) ItemsService {
+	service := &itemsServiceImpl{
+		store:             s,
+		idempotencyKeyTTL: defaultIdempotencyKeyTTL,
+	}
+	for _, opt := range opts {
+		opt(service)
 	}
+	return &tracedItemsService{service}
 }
 
 type itemsServiceImpl struct {
-	store store.Store
+	store             store.Store
+	itemQuota         int
+	idempotencyKeyTTL time.Duration
 }
 
 func (s *itemsServiceImpl) GetItem(ctx context.Context, deploymentId string) (*structs.TodoItem, error) {
 	var result structs.TodoItem
-	err := s.store.Update(func(tx store.Txn) error {
+	err := s.store.View(func(tx store.Txn) error {
 		err := tx.Get(ctx, deploymentId, &result)
 		return err
 	})
@@ -35,15 +85,59 @@ func (s *itemsServiceImpl) GetItem(ctx context.Context, deploymentId string) (*s
 }
 
 func (s *itemsServiceImpl) AddItem(ctx context.Context, def *structs.TodoItem) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	stampCompletion(def)
+	def.Owner = ownerOf(ctx)
 	return s.store.Update(func(tx store.Txn) error {
-		
-		return tx.Add(ctx, def)
+		if err := checkPrecondition(ctx, tx, def.Id); err != nil {
+			return err
+		}
+		if err := tx.Add(ctx, def); err != nil {
+			return err
+		}
+		if err := s.checkQuota(ctx, tx, def.Owner); err != nil {
+			return err
+		}
+		if err := enqueueItemEvent(ctx, tx, EventItemCreated, def.Id, def); err != nil {
+			return err
+		}
+		return s.saveResponse(ctx, tx, nil)
+	})
+}
+
+func (s *itemsServiceImpl) GetItems(ctx context.Context, ids []string) ([]structs.TodoItem, error) {
+	var result []structs.TodoItem
+	err := s.store.View(func(tx store.Txn) error {
+		return tx.GetMany(ctx, ids, &result)
 	})
+	return result, err
+}
+
+func (s *itemsServiceImpl) ItemHistory(ctx context.Context, ids []string) ([]structs.ItemEvent, error) {
+	var events []store.Event
+	err := s.store.View(func(tx store.Txn) error {
+		return tx.History(ctx, ids, &events)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]structs.ItemEvent, 0, len(events))
+	for _, event := range events {
+		itemEvent, err := itemEventFrom(event)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, itemEvent)
+	}
+	return history, nil
 }
 
 func (s *itemsServiceImpl) ListItems(ctx context.Context) (structs.TodoItemList, error) {
 	var result structs.TodoItemList
-	err := s.store.Update(func(tx store.Txn) error {
+	err := s.store.View(func(tx store.Txn) error {
 		err := tx.List(ctx, &result)
 		
 		return err
@@ -53,13 +147,279 @@ func (s *itemsServiceImpl) ListItems(ctx context.Context) (structs.TodoItemList,
 
 func (s *itemsServiceImpl) DeleteItem(ctx context.Context, deploymentId string) error {
 	return s.store.Update(func(tx store.Txn) error {
-		return tx.Delete(ctx, deploymentId)
+		if err := checkPrecondition(ctx, tx, deploymentId); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, deploymentId); err != nil {
+			return err
+		}
+		if err := enqueueItemEvent(ctx, tx, EventItemDeleted, deploymentId, &structs.TodoItem{Id: deploymentId}); err != nil {
+			return err
+		}
+		return s.saveResponse(ctx, tx, nil)
 	})
 }
 
 func (s *itemsServiceImpl) UpdateItem(ctx context.Context, def *structs.TodoItem) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	stampCompletion(def)
+	return s.store.Update(func(tx store.Txn) error {
+		if err := checkPrecondition(ctx, tx, def.Id); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, def); err != nil {
+			return err
+		}
+		if err := enqueueItemEvent(ctx, tx, EventItemUpdated, def.Id, def); err != nil {
+			return err
+		}
+		return s.saveResponse(ctx, tx, nil)
+	})
+}
+
+
+// MoveItem places an item at a 1-based position in the list, renumbering
+// priorities so that every item has a distinct one. Positions past the end
+// of the list move the item to the end.
+func (s *itemsServiceImpl) MoveItem(ctx context.Context, id string, position int) error {
+	move := structs.MoveRequest{Position: position}
+	if err := move.Validate(); err != nil {
+		return err
+	}
+
 	return s.store.Update(func(tx store.Txn) error {
-		return tx.Update(ctx, def)
+		var list structs.TodoItemList
+		if err := tx.List(ctx, &list); err != nil {
+			return err
+		}
+
+		ordered := make([]structs.TodoItem, 0, list.Count)
+		var moved *structs.TodoItem
+		for i := range list.Items {
+			if list.Items[i].Id == id {
+				moved = &list.Items[i]
+				continue
+			}
+			ordered = append(ordered, list.Items[i])
+		}
+		if moved == nil {
+			return store.ErrNotFound
+		}
+
+		if position > len(ordered)+1 {
+			position = len(ordered) + 1
+		}
+		ordered = append(ordered[:position-1], append([]structs.TodoItem{*moved}, ordered[position-1:]...)...)
+
+		for i := range ordered {
+			item := &ordered[i]
+			if item.Priority == i+1 {
+				continue
+			}
+			item.Priority = i + 1
+			if err := tx.Update(ctx, item); err != nil {
+				return err
+			}
+			if err := enqueueItemEvent(ctx, tx, EventItemUpdated, item.Id, item); err != nil {
+				return err
+			}
+		}
+		return s.saveResponse(ctx, tx, nil)
 	})
 }
 
+// errDryRun rolls back an import transaction once its outcome is known.
+var errDryRun = errors.New("dry run")
+
+// ImportItems adds items to the list in a single transaction. Items without
+// an id are given one, and items without a priority are appended after both
+// the existing and the imported items, in the order given. Items whose id is already in use are
+// handled according to opts.Conflict.
+func (s *itemsServiceImpl) ImportItems(ctx context.Context, items []structs.TodoItem, opts structs.ImportOptions) (structs.ImportResult, error) {
+	result := structs.ImportResult{DryRun: opts.DryRun, Items: make([]structs.ImportedItem, 0, len(items))}
+
+	conflict := opts.Conflict
+	if conflict == "" {
+		conflict = structs.ConflictSkip
+	}
+	if conflict != structs.ConflictSkip && conflict != structs.ConflictOverwrite && conflict != structs.ConflictRename {
+		return result, fmt.Errorf("unknown conflict strategy %q", opts.Conflict)
+	}
+
+	owner := ownerOf(ctx)
+	err := s.store.Update(func(tx store.Txn) error {
+		var existing structs.TodoItemList
+		if err := tx.List(ctx, &existing); err != nil {
+			return err
+		}
+		ids := make(map[string]bool, existing.Count)
+		nextPriority := 1
+		for _, item := range existing.Items {
+			ids[item.Id] = true
+			if item.Priority >= nextPriority {
+				nextPriority = item.Priority + 1
+			}
+		}
+		for _, item := range items {
+			if item.Priority >= nextPriority {
+				nextPriority = item.Priority + 1
+			}
+		}
+
+		for i := range items {
+			item := items[i]
+			imported := structs.ImportedItem{Id: item.Id, Action: "created"}
+
+			if item.Id == "" {
+				item.Id = structs.NewItemId()
+				imported.Id = item.Id
+			} else if ids[item.Id] {
+				switch conflict {
+				case structs.ConflictSkip:
+					result.Skipped++
+					result.Items = append(result.Items, structs.ImportedItem{Id: item.Id, Action: "skipped"})
+					continue
+				case structs.ConflictOverwrite:
+					imported.Action = "overwritten"
+				case structs.ConflictRename:
+					imported.Original_id = item.Id
+					item.Id = structs.NewItemId()
+					imported.Id = item.Id
+					imported.Action = "renamed"
+				}
+			}
+
+			if item.Priority == 0 {
+				item.Priority = nextPriority
+				nextPriority++
+			}
+			stampCompletion(&item)
+			if err := item.Validate(); err != nil {
+				var invalid *structs.ValidationError
+				if errors.As(err, &invalid) {
+					return invalid.Within(fmt.Sprintf("items[%d]", i))
+				}
+				return fmt.Errorf("item %d: %w", i+1, err)
+			}
+
+			var err error
+			if imported.Action == "overwritten" {
+				if err = tx.Update(ctx, &item); err == nil {
+					err = enqueueItemEvent(ctx, tx, EventItemUpdated, item.Id, &item)
+				}
+				result.Overwritten++
+			} else {
+				item.Owner = owner
+				if err = tx.Add(ctx, &item); err == nil {
+					err = enqueueItemEvent(ctx, tx, EventItemCreated, item.Id, &item)
+				}
+				if imported.Action == "renamed" {
+					result.Renamed++
+				} else {
+					result.Created++
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("item %d: %w", i+1, err)
+			}
+
+			ids[item.Id] = true
+			result.Items = append(result.Items, imported)
+		}
+
+		if result.Created+result.Renamed > 0 {
+			if err := s.checkQuota(ctx, tx, owner); err != nil {
+				return err
+			}
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return s.saveResponse(ctx, tx, result)
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return result, err
+}
+
+// ownerOf names the owner of items created for the client making the
+// request, empty if it is not identified.
+func ownerOf(ctx context.Context) string {
+	if identity, ok := ClientIdentityFrom(ctx); ok {
+		return identity.Name()
+	}
+	return ""
+}
+
+type preconditionKey struct{}
+
+// withPrecondition makes AddItem, UpdateItem and DeleteItem check the item
+// they change with holds, in the transaction that changes it, failing with
+// ErrPreconditionFailed if it returns false. holds is given nil if there is
+// no item with the id.
+func withPrecondition(ctx context.Context, holds func(existing *structs.TodoItem) bool) context.Context {
+	return context.WithValue(ctx, preconditionKey{}, holds)
+}
+
+func checkPrecondition(ctx context.Context, tx store.Txn, id string) error {
+	holds, ok := ctx.Value(preconditionKey{}).(func(existing *structs.TodoItem) bool)
+	if !ok {
+		return nil
+	}
+	var item structs.TodoItem
+	existing := &item
+	if err := tx.Get(ctx, id, existing); errors.Is(err, store.ErrNotFound) {
+		existing = nil
+	} else if err != nil {
+		return err
+	}
+	if !holds(existing) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// checkQuota fails with ErrQuotaExceeded if owner has more items than the
+// quota allows. It is called after adding items, so that they are rolled
+// back with the transaction.
+func (s *itemsServiceImpl) checkQuota(ctx context.Context, tx store.Txn, owner string) error {
+	if s.itemQuota == 0 || owner == "" {
+		return nil
+	}
+	var owned int
+	if err := tx.CountOwned(ctx, owner, &owned); err != nil {
+		return err
+	}
+	if owned > s.itemQuota {
+		logging.For(ctx, "todolist").Info().Str("owner", owner).Int("quota", s.itemQuota).Msg("Item quota reached")
+		return fmt.Errorf("%w: at most %d items are allowed", ErrQuotaExceeded, s.itemQuota)
+	}
+	return nil
+}
+
+// stampCompletion keeps Completed_at consistent with the item's status,
+// recording the time of completion if the caller did not supply one.
+func stampCompletion(item *structs.TodoItem) {
+	if !item.IsCompleted() {
+		item.Completed_at = nil
+	} else if item.Completed_at == nil {
+		now := time.Now()
+		item.Completed_at = &now
+	}
+}
+
+// enqueueItemEvent records a change to an item in the outbox as part of tx.
+func enqueueItemEvent(ctx context.Context, tx store.Txn, topic string, id string, item *structs.TodoItem) error {
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return tx.Enqueue(ctx, &store.Event{
+		Topic:        topic,
+		Aggregate_id: id,
+		Payload:      payload,
+	})
+}
@@ -0,0 +1,22 @@
+package store
+
+import "time"
+
+// SavedResponse is the response to a change requested with an idempotency
+// key. It is saved by the transaction that makes the change, so that a
+// retried request gets the same response without the change being made
+// again.
+type SavedResponse struct {
+	// Owner is the client that sent the key, as keys are only unique to
+	// each client.
+	Owner string
+	Key   string
+	// Fingerprint identifies the request the key was first sent with.
+	Fingerprint string
+	Status      int
+	// Header holds the response headers as JSON.
+	Header     string
+	Body       []byte
+	Created_at time.Time
+	Expires_at time.Time
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+)
+
+var _ = Describe("Idempotency key tests", func() {
+	var todostore Store
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		tododb, err := sqlitedb.OpenDb(filepath.Join(GinkgoT().TempDir(), "todolist.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(tododb.Close)
+		todostore = NewSqlStore(tododb)
+	})
+
+	save := func(owner, key string, ttl time.Duration) error {
+		now := time.Now()
+		return todostore.Update(func(tx Txn) error {
+			return tx.SaveResponse(ctx, &SavedResponse{
+				Owner:       owner,
+				Key:         key,
+				Fingerprint: "f1",
+				Status:      202,
+				Header:      `{"Location":["/todolist/one"]}`,
+				Body:        []byte("accepted"),
+				Created_at:  now,
+				Expires_at:  now.Add(ttl),
+			})
+		})
+	}
+
+	get := func(owner, key string) (SavedResponse, error) {
+		var response SavedResponse
+		err := todostore.Update(func(tx Txn) error {
+			return tx.GetResponse(ctx, owner, key, &response)
+		})
+		return response, err
+	}
+
+	Specify("Saved responses are read back by owner and key", func() {
+		Expect(save("alice", "k1", time.Hour)).To(Succeed())
+
+		response, err := get("alice", "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Fingerprint).To(Equal("f1"))
+		Expect(response.Status).To(Equal(202))
+		Expect(response.Header).To(Equal(`{"Location":["/todolist/one"]}`))
+		Expect(response.Body).To(Equal([]byte("accepted")))
+		Expect(response.Expires_at).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+		_, err = get("bob", "k1")
+		Expect(err).To(MatchError(ErrNotFound))
+	})
+
+	Specify("A key only has one response until it expires", func() {
+		Expect(save("alice", "k1", time.Hour)).To(Succeed())
+		Expect(save("alice", "k1", time.Hour)).To(MatchError(ErrConflict))
+		Expect(save("bob", "k1", time.Hour)).To(Succeed())
+
+		Expect(save("alice", "k2", -time.Second)).To(Succeed())
+		_, err := get("alice", "k2")
+		Expect(err).To(MatchError(ErrNotFound))
+		Expect(save("alice", "k2", time.Hour)).To(Succeed())
+		_, err = get("alice", "k2")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	txDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "todolist",
+		Subsystem: "store",
+		Name:      "transaction_duration_seconds",
+		Help:      "Time taken by store transactions, by whether they were committed or rolled back.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"outcome"})
+	txRollbacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "todolist",
+		Subsystem: "store",
+		Name:      "transaction_rollbacks_total",
+		Help:      "Store transactions rolled back, because the action failed or panicked.",
+	})
+)
+
+// Collectors returns the metrics kept by SQL stores, for registering with a
+// Prometheus registry.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{txDuration, txRollbacks}
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"go.altair.com/todolist/pkg/logging"
+)
+
+// Event is a domain event recorded in the outbox by the transaction that
+// caused it, so it is published if and only if that transaction commits.
+type Event struct {
+	Id           int64
+	Topic        string
+	Aggregate_id string
+	Payload      []byte
+	Attempts     int
+	Created_at   time.Time
+	Delivered_at *time.Time
+}
+
+// Sink receives events relayed from the outbox. Publish may be called more
+// than once for the same event, so sinks must tolerate duplicates.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, event Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+const (
+	defaultRelayInterval  = time.Second
+	defaultRelayBatchSize = 100
+	// delivered events are kept for a while as the items' history
+	defaultRelayRetention = 30 * 24 * time.Hour
+	relayPruneInterval    = time.Hour
+)
+
+// Relay moves events from the outbox to a Sink. An event is only marked
+// delivered once the sink has accepted it, giving at-least-once delivery.
+// Delivered events are removed once they are older than Retention, or kept
+// if it is zero.
+type Relay struct {
+	store     Store
+	sink      Sink
+	Interval  time.Duration
+	BatchSize int
+	Retention time.Duration
+}
+
+func NewRelay(s Store, sink Sink) *Relay {
+	return &Relay{
+		store:     s,
+		sink:      sink,
+		Interval:  defaultRelayInterval,
+		BatchSize: defaultRelayBatchSize,
+		Retention: defaultRelayRetention,
+	}
+}
+
+// Run flushes the outbox every Interval, and prunes it every hour, until
+// ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			logging.For(ctx, "store").Warn().Err(err).Msg("Outbox relay failed")
+		}
+		if time.Since(pruned) >= relayPruneInterval {
+			if err := r.Prune(ctx); err != nil && ctx.Err() == nil {
+				logging.For(ctx, "store").Warn().Err(err).Msg("Outbox pruning failed")
+			}
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes pending events in the order they were recorded, returning
+// how many were delivered. It stops at the first event the sink rejects so
+// that later events are not published ahead of it. Pending events are read
+// without the write lock, which is only taken to mark a batch once it has
+// been published.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	delivered := 0
+	for {
+		var events []Event
+		err := r.store.View(func(tx Txn) error {
+			return tx.Pending(ctx, r.BatchSize, &events)
+		})
+		if err != nil || len(events) == 0 {
+			return delivered, err
+		}
+
+		var published []int64
+		var publishErr error
+		failed := int64(-1)
+		for _, event := range events {
+			if publishErr = r.sink.Publish(ctx, event); publishErr != nil {
+				failed = event.Id
+				break
+			}
+			published = append(published, event.Id)
+		}
+
+		err = r.store.Update(func(tx Txn) error {
+			if err := tx.MarkDelivered(ctx, published); err != nil {
+				return err
+			}
+			if failed >= 0 {
+				return tx.MarkFailed(ctx, failed)
+			}
+			return nil
+		})
+		if err != nil {
+			// the published events will be published again
+			logging.For(ctx, "store").Error().Err(err).Int("events", len(published)).Msg("Failed to mark outbox events")
+			return delivered, err
+		}
+		delivered += len(published)
+
+		if publishErr != nil {
+			return delivered, publishErr
+		}
+		if len(events) < r.BatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// Prune removes the events delivered longer ago than Retention.
+func (r *Relay) Prune(ctx context.Context) error {
+	if r.Retention == 0 {
+		return nil
+	}
+	return r.store.Update(func(tx Txn) error {
+		return tx.PruneDelivered(ctx, time.Now().Add(-r.Retention))
+	})
+}
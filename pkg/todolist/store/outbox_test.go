@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+)
+
+var _ = Describe("Outbox tests", func() {
+	var tododb *sqlx.DB
+	var todostore Store
+	var ctx context.Context
+	var published []Event
+	var failPublish bool
+	var relay *Relay
+
+	Context("When database created", Ordered, func() {
+
+		BeforeAll(func() {
+			var err error
+			tododb, err = sqlitedb.CreateDb()
+			Expect(err).NotTo(HaveOccurred())
+			todostore = NewSqlStore(tododb)
+			ctx = context.Background()
+			relay = NewRelay(todostore, SinkFunc(func(ctx context.Context, event Event) error {
+				if failPublish {
+					return errors.New("sink unavailable")
+				}
+				published = append(published, event)
+				return nil
+			}))
+		})
+
+		AfterAll(func() {
+			err := tododb.Close()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		BeforeEach(func() {
+			published = nil
+			failPublish = false
+			_, err := relay.Flush(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			published = nil
+		})
+
+		Specify("Events are discarded when the transaction rolls back", func() {
+			err := todostore.Update(func(tx Txn) error {
+				if err := tx.Enqueue(ctx, &Event{Topic: "test", Aggregate_id: "a", Payload: []byte("{}")}); err != nil {
+					return err
+				}
+				return errors.New("abort")
+			})
+			Expect(err).To(HaveOccurred())
+
+			delivered, err := relay.Flush(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delivered).To(Equal(0))
+			Expect(published).To(BeEmpty())
+		})
+
+		Specify("Committed events are published in order and only once", func() {
+			err := todostore.Update(func(tx Txn) error {
+				for _, id := range []string{"a", "b", "c"} {
+					if err := tx.Enqueue(ctx, &Event{Topic: "test", Aggregate_id: id, Payload: []byte(`{"id":"` + id + `"}`)}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			delivered, err := relay.Flush(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delivered).To(Equal(3))
+			Expect(published).To(HaveLen(3))
+			Expect(published[0].Aggregate_id).To(Equal("a"))
+			Expect(published[1].Aggregate_id).To(Equal("b"))
+			Expect(published[2].Aggregate_id).To(Equal("c"))
+			Expect(string(published[0].Payload)).To(Equal(`{"id":"a"}`))
+
+			delivered, err = relay.Flush(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delivered).To(Equal(0))
+		})
+
+		Specify("Events rejected by the sink are retried", func() {
+			err := todostore.Update(func(tx Txn) error {
+				return tx.Enqueue(ctx, &Event{Topic: "test", Aggregate_id: "retry", Payload: []byte("{}")})
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			failPublish = true
+			delivered, err := relay.Flush(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(delivered).To(Equal(0))
+
+			failPublish = false
+			delivered, err = relay.Flush(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delivered).To(Equal(1))
+			Expect(published[0].Aggregate_id).To(Equal("retry"))
+			Expect(published[0].Attempts).To(Equal(1))
+		})
+
+		Specify("Delivered events are pruned after the retention", func() {
+			err := todostore.Update(func(tx Txn) error {
+				return tx.Enqueue(ctx, &Event{Topic: "test", Aggregate_id: "pruned", Payload: []byte("{}")})
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(relay.Flush(ctx)).To(Equal(1))
+
+			history := func() []Event {
+				var events []Event
+				Expect(todostore.View(func(tx Txn) error {
+					return tx.History(ctx, []string{"pruned"}, &events)
+				})).To(Succeed())
+				return events
+			}
+			Expect(relay.Prune(ctx)).To(Succeed())
+			Expect(history()).To(HaveLen(1))
+
+			relay.Retention = -time.Second
+			DeferCleanup(func() { relay.Retention = defaultRelayRetention })
+			Expect(relay.Prune(ctx)).To(Succeed())
+			Expect(history()).To(BeEmpty())
+		})
+	})
+})
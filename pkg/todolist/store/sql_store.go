@@ -3,11 +3,19 @@ package store
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"go.altair.com/todolist/pkg/logging"
 	"go.altair.com/todolist/pkg/structs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func NewSqlStore(db *sqlx.DB) Store {
@@ -21,6 +29,7 @@ type sqlStore struct {
 }
 
 func (s *sqlStore) Update(action func(tx Txn) error) error {
+	start := time.Now()
 	dbtx, err := s.db.Beginx()
 	if err != nil {
 		return err
@@ -29,6 +38,7 @@ func (s *sqlStore) Update(action func(tx Txn) error) error {
 	defer func() {
 		if r := recover(); r != nil {
 			_ = dbtx.Rollback()
+			observeRollback(start)
 			panic(r)
 		}
 	}()
@@ -40,24 +50,174 @@ func (s *sqlStore) Update(action func(tx Txn) error) error {
 	err = action(tx)
 	if err != nil {
 		_ = dbtx.Rollback()
+		observeRollback(start)
 		return err
 	}
 
-	return dbtx.Commit()
+	err = dbtx.Commit()
+	if err != nil {
+		observeRollback(start)
+		return err
+	}
+	txDuration.WithLabelValues("committed").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// View reads in a deferred transaction on a connection of its own, as
+// Beginx would take the write lock when the DSN asks for immediate
+// transactions.
+func (s *sqlStore) View(action func(tx Txn) error) error {
+	ctx := context.Background()
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN DEFERRED"); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(ctx, "ROLLBACK")
+	}()
+	return action(&sqlStoreTxn{txn: conn})
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// observeRollback records a transaction started at start as rolled back.
+func observeRollback(start time.Time) {
+	txDuration.WithLabelValues("rolled_back").Observe(time.Since(start).Seconds())
+	txRollbacks.Inc()
 }
 
 type sqlStoreTxn struct {
-	txn *sqlx.Tx
+	txn sqlRunner
+}
+
+// sqlRunner runs statements in a transaction, either a *sqlx.Tx or a
+// *sqlx.Conn on which View has begun one.
+type sqlRunner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	Rebind(query string) string
 }
 
 func readRecord(rows *sql.Rows, record *structs.TodoItem) error {
-	return rows.Scan(
+	var projects, contexts, attributes string
+	err := rows.Scan(
 		&record.Id,
 		&record.Item,
 		&record.Priority, 
+		&record.Status,
+		&record.Due,
+		&record.Completed_at,
+		&projects,
+		&contexts,
+		&attributes,
+		&record.Owner,
 		&record.Updated_at,
 		&record.Created_at,
 	)
+	if err != nil {
+		return err
+	}
+
+	record.Projects, record.Contexts, record.Attributes = nil, nil, nil
+	columns := []struct {
+		value string
+		dest  interface{}
+	}{
+		{projects, &record.Projects},
+		{contexts, &record.Contexts},
+		{attributes, &record.Attributes},
+	}
+	for _, column := range columns {
+		if column.value != "" {
+			if err := json.Unmarshal([]byte(column.value), column.dest); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tagColumn encodes a tag slice or map for storage, using an empty string
+// rather than JSON null when there is nothing to store.
+func tagColumn(v interface{}) string {
+	switch t := v.(type) {
+	case []string:
+		if len(t) == 0 {
+			return ""
+		}
+	case map[string]string:
+		if len(t) == 0 {
+			return ""
+		}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// tracer makes a span for each SQL statement, as a child of the span in the
+// context the store is called with.
+var tracer = otel.Tracer("go.altair.com/todolist/pkg/todolist/store")
+
+// startStatement starts the span for running query. The returned function
+// ends it, recording err if the statement failed, and logs the statement at
+// trace level. Statements run outside a trace, such as the outbox relay's
+// polling, are only logged, so as not to make a trace of their own each.
+func startStatement(ctx context.Context, query string) (context.Context, func(err error)) {
+	start := time.Now()
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		operation := strings.ToUpper(strings.Fields(query)[0])
+		ctx, span = tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(query),
+		))
+	}
+	return ctx, func(err error) {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		logging.For(ctx, "store").Trace().Ctx(ctx).Err(err).Str("query", query).Dur("duration", time.Since(start)).Msg("Ran statement")
+	}
+}
+
+func (tx *sqlStoreTxn) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, end := startStatement(ctx, query)
+	result, err := tx.txn.ExecContext(ctx, query, args...)
+	end(err)
+	return result, err
+}
+
+func (tx *sqlStoreTxn) get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, end := startStatement(ctx, query)
+	err := tx.txn.GetContext(ctx, dest, query, args...)
+	end(err)
+	return err
+}
+
+// query runs a query whose span lasts until the returned function closes
+// the rows, as SQLite does much of the work while they are read.
+func (tx *sqlStoreTxn) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, func(), error) {
+	ctx, end := startStatement(ctx, query)
+	rows, err := tx.txn.QueryContext(ctx, query, args...)
+	if err != nil {
+		end(err)
+		return nil, nil, err
+	}
+	return rows, func() {
+		_ = rows.Close()
+		end(rows.Err())
+	}, nil
 }
 
 func (tx *sqlStoreTxn) DbTx() interface{} {
@@ -66,19 +226,30 @@ func (tx *sqlStoreTxn) DbTx() interface{} {
 
 func (tx *sqlStoreTxn) Add(ctx context.Context, record *structs.TodoItem) error {
 	createdAt:=time.Now()
-	_, err := tx.txn.ExecContext(ctx,
-		tx.txn.Rebind("INSERT INTO TODOLIST(id, item, priority,updated_at,created_at) VALUES(?, ?, ?,?,?)"),
+	_, err := tx.exec(ctx,
+		tx.txn.Rebind("INSERT INTO TODOLIST(id, item, priority,status,due,completed_at,projects,contexts,attributes,owner,updated_at,created_at) VALUES(?, ?, ?,?,?,?,?,?,?,?,?,?)"),
 		record.Id,
 		record.Item,
 		record.Priority,
+		record.Status,
+		record.Due,
+		record.Completed_at,
+		tagColumn(record.Projects),
+		tagColumn(record.Contexts),
+		tagColumn(record.Attributes),
+		record.Owner,
 		createdAt,
 		createdAt,
 	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrConflict
+	}
 	return err
 }
 
 func (tx *sqlStoreTxn) Delete(ctx context.Context, id string) error {
-	result, err := tx.txn.ExecContext(ctx, tx.txn.Rebind("DELETE FROM TODOLIST WHERE ID=?"), id)
+	result, err := tx.exec(ctx, tx.txn.Rebind("DELETE FROM TODOLIST WHERE ID=?"), id)
 	if err != nil {
 		return err
 	}
@@ -87,21 +258,33 @@ func (tx *sqlStoreTxn) Delete(ctx context.Context, id string) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("unknown id")
+		return ErrNotFound
 	}
 	return nil
 }
 
 func (tx *sqlStoreTxn) Update(ctx context.Context, record *structs.TodoItem) error {
 	updatedAt:=time.Now()
-	result, err := tx.txn.ExecContext(ctx,
+	result, err := tx.exec(ctx,
 		tx.txn.Rebind(`UPDATE TODOLIST SET
 			item=?,
 			priority=?,
+			status=?,
+			due=?,
+			completed_at=?,
+			projects=?,
+			contexts=?,
+			attributes=?,
 			updated_at=?
 			WHERE id=?`),
 		record.Item,
 		record.Priority,
+		record.Status,
+		record.Due,
+		record.Completed_at,
+		tagColumn(record.Projects),
+		tagColumn(record.Contexts),
+		tagColumn(record.Attributes),
 		updatedAt,
 		record.Id,
 	)
@@ -114,22 +297,22 @@ func (tx *sqlStoreTxn) Update(ctx context.Context, record *structs.TodoItem) err
 		return err
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("unknown id")
+		return ErrNotFound
 	}
 	return nil
 }
 
 func (tx *sqlStoreTxn) Get(ctx context.Context, id string, item *structs.TodoItem) error {
-	queryStmt := "SELECT id, item,priority,updated_at,created_at FROM TODOLIST WHERE ID=?"
+	queryStmt := "SELECT id, item,priority,status,due,completed_at,projects,contexts,attributes,owner,updated_at,created_at FROM TODOLIST WHERE ID=?"
 
-	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt), id)
+	rows, closeRows, err := tx.query(ctx, tx.txn.Rebind(queryStmt), id)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	defer closeRows()
 
 	if !rows.Next() {
-		return fmt.Errorf("unknown id")
+		return ErrNotFound
 	}
 
 	if err := readRecord(rows, item); err != nil {
@@ -140,14 +323,14 @@ func (tx *sqlStoreTxn) Get(ctx context.Context, id string, item *structs.TodoIte
 }
 
 func (tx *sqlStoreTxn) List(ctx context.Context, items *structs.TodoItemList) error {
-	queryStmt := "SELECT id, item,priority,updated_at,created_at FROM TODOLIST ORDER BY priority ASC, updated_at DESC"
+	queryStmt := "SELECT id, item,priority,status,due,completed_at,projects,contexts,attributes,owner,updated_at,created_at FROM TODOLIST ORDER BY priority ASC, updated_at DESC"
 
-	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt))
+	rows, closeRows, err := tx.query(ctx, tx.txn.Rebind(queryStmt))
 
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	defer closeRows()
 
 	items.Items = make([]structs.TodoItem, 0)
 	var record structs.TodoItem
@@ -161,3 +344,176 @@ func (tx *sqlStoreTxn) List(ctx context.Context, items *structs.TodoItemList) er
 	}
 	return nil
 }
+
+func (tx *sqlStoreTxn) CountOwned(ctx context.Context, owner string, count *int) error {
+	return tx.get(ctx, count, tx.txn.Rebind("SELECT COUNT(*) FROM TODOLIST WHERE owner=?"), owner)
+}
+
+func (tx *sqlStoreTxn) CountByStatus(ctx context.Context, counts map[string]int) error {
+	rows, closeRows, err := tx.query(ctx, "SELECT status, COUNT(*) FROM TODOLIST GROUP BY status")
+	if err != nil {
+		return err
+	}
+	defer closeRows()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return err
+		}
+		counts[status] += count
+	}
+	return rows.Err()
+}
+
+func (tx *sqlStoreTxn) GetMany(ctx context.Context, ids []string, items *[]structs.TodoItem) error {
+	*items = make([]structs.TodoItem, 0, len(ids))
+	if len(ids) == 0 {
+		return nil
+	}
+
+	queryStmt, args, err := sqlx.In("SELECT id, item,priority,status,due,completed_at,projects,contexts,attributes,owner,updated_at,created_at FROM TODOLIST WHERE ID IN (?)", ids)
+	if err != nil {
+		return err
+	}
+	rows, closeRows, err := tx.query(ctx, tx.txn.Rebind(queryStmt), args...)
+	if err != nil {
+		return err
+	}
+	defer closeRows()
+
+	for rows.Next() {
+		var record structs.TodoItem
+		if err := readRecord(rows, &record); err != nil {
+			return err
+		}
+		*items = append(*items, record)
+	}
+	return rows.Err()
+}
+
+func (tx *sqlStoreTxn) Enqueue(ctx context.Context, event *Event) error {
+	event.Created_at = time.Now()
+	result, err := tx.exec(ctx,
+		tx.txn.Rebind("INSERT INTO OUTBOX(topic, aggregate_id, payload, created_at) VALUES(?, ?, ?, ?)"),
+		event.Topic,
+		event.Aggregate_id,
+		string(event.Payload),
+		event.Created_at,
+	)
+	if err != nil {
+		return err
+	}
+	event.Id, err = result.LastInsertId()
+	return err
+}
+
+func (tx *sqlStoreTxn) Pending(ctx context.Context, limit int, events *[]Event) error {
+	queryStmt := "SELECT id, topic, aggregate_id, payload, attempts, created_at FROM OUTBOX WHERE delivered_at IS NULL ORDER BY id ASC LIMIT ?"
+
+	rows, closeRows, err := tx.query(ctx, tx.txn.Rebind(queryStmt), limit)
+	if err != nil {
+		return err
+	}
+	defer closeRows()
+
+	*events = make([]Event, 0)
+	for rows.Next() {
+		var event Event
+		var payload string
+		if err := rows.Scan(&event.Id, &event.Topic, &event.Aggregate_id, &payload, &event.Attempts, &event.Created_at); err != nil {
+			return err
+		}
+		event.Payload = []byte(payload)
+		*events = append(*events, event)
+	}
+	return rows.Err()
+}
+
+func (tx *sqlStoreTxn) History(ctx context.Context, ids []string, events *[]Event) error {
+	*events = make([]Event, 0)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	queryStmt, args, err := sqlx.In("SELECT id, topic, aggregate_id, payload, attempts, created_at FROM OUTBOX WHERE aggregate_id IN (?) ORDER BY id ASC", ids)
+	if err != nil {
+		return err
+	}
+	rows, closeRows, err := tx.query(ctx, tx.txn.Rebind(queryStmt), args...)
+	if err != nil {
+		return err
+	}
+	defer closeRows()
+
+	for rows.Next() {
+		var event Event
+		var payload string
+		if err := rows.Scan(&event.Id, &event.Topic, &event.Aggregate_id, &payload, &event.Attempts, &event.Created_at); err != nil {
+			return err
+		}
+		event.Payload = []byte(payload)
+		*events = append(*events, event)
+	}
+	return rows.Err()
+}
+
+func (tx *sqlStoreTxn) MarkDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	queryStmt, args, err := sqlx.In("UPDATE OUTBOX SET delivered_at=?, attempts=attempts+1 WHERE id IN (?)", time.Now().UTC(), ids)
+	if err != nil {
+		return err
+	}
+	_, err = tx.exec(ctx, tx.txn.Rebind(queryStmt), args...)
+	return err
+}
+
+func (tx *sqlStoreTxn) MarkFailed(ctx context.Context, id int64) error {
+	_, err := tx.exec(ctx, tx.txn.Rebind("UPDATE OUTBOX SET attempts=attempts+1 WHERE id=?"), id)
+	return err
+}
+
+func (tx *sqlStoreTxn) PruneDelivered(ctx context.Context, before time.Time) error {
+	_, err := tx.exec(ctx, tx.txn.Rebind("DELETE FROM OUTBOX WHERE delivered_at IS NOT NULL AND delivered_at < ?"), before.UTC())
+	return err
+}
+
+func (tx *sqlStoreTxn) SaveResponse(ctx context.Context, response *SavedResponse) error {
+	if _, err := tx.exec(ctx, tx.txn.Rebind("DELETE FROM IDEMPOTENCY_KEYS WHERE expires_at <= ?"), time.Now().UTC()); err != nil {
+		return err
+	}
+	// a nil body would be stored as NULL
+	body := response.Body
+	if body == nil {
+		body = []byte{}
+	}
+	_, err := tx.exec(ctx,
+		tx.txn.Rebind("INSERT INTO IDEMPOTENCY_KEYS(owner, key, fingerprint, status, header, body, created_at, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)"),
+		response.Owner,
+		response.Key,
+		response.Fingerprint,
+		response.Status,
+		response.Header,
+		body,
+		response.Created_at.UTC(),
+		response.Expires_at.UTC(),
+	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrConflict
+	}
+	return err
+}
+
+func (tx *sqlStoreTxn) GetResponse(ctx context.Context, owner, key string, response *SavedResponse) error {
+	err := tx.get(ctx, response,
+		tx.txn.Rebind("SELECT owner, key, fingerprint, status, header, body, created_at, expires_at FROM IDEMPOTENCY_KEYS WHERE owner=? AND key=? AND expires_at > ?"),
+		owner, key, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -2,12 +2,26 @@ package store
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"go.altair.com/todolist/pkg/structs"
 )
 
+var (
+	// ErrNotFound is returned when no item has the requested id.
+	ErrNotFound = errors.New("unknown id")
+	// ErrConflict is returned when adding an item whose id is already in use.
+	ErrConflict = errors.New("id already exists")
+)
+
 type Store interface {
 	Update(action func(tx Txn) error) error
+	// View runs action against a consistent snapshot of the store without
+	// taking the write lock. Changes made by action are discarded.
+	View(action func(tx Txn) error) error
+	// Ping checks that the database can be reached.
+	Ping(ctx context.Context) error
 }
 
 type Txn interface {
@@ -16,5 +30,29 @@ type Txn interface {
 	Update(ctx context.Context, e *structs.TodoItem) error
 	Get(ctx context.Context, id string, item *structs.TodoItem) error
 	List(ctx context.Context, items *structs.TodoItemList) error
+	// GetMany reads the items with the given ids, in no particular order,
+	// leaving out ids that are unknown.
+	GetMany(ctx context.Context, ids []string, items *[]structs.TodoItem) error
+	// CountOwned counts the items with the given owner.
+	CountOwned(ctx context.Context, owner string, count *int) error
+	// CountByStatus adds the number of items with each status to counts.
+	CountByStatus(ctx context.Context, counts map[string]int) error
+	Enqueue(ctx context.Context, event *Event) error
+	Pending(ctx context.Context, limit int, events *[]Event) error
+	// MarkDelivered records that the events with the given ids have been
+	// published.
+	MarkDelivered(ctx context.Context, ids []int64) error
+	MarkFailed(ctx context.Context, id int64) error
+	// PruneDelivered removes events delivered before the given time.
+	PruneDelivered(ctx context.Context, before time.Time) error
+	// History reads the outbox events for the given items, oldest first.
+	History(ctx context.Context, ids []string, events *[]Event) error
+	// SaveResponse saves the response to a request made with an idempotency
+	// key, first removing responses that have expired so that their keys
+	// can be used again. It returns ErrConflict if the key already has one.
+	SaveResponse(ctx context.Context, response *SavedResponse) error
+	// GetResponse reads the response saved for an owner's key, returning
+	// ErrNotFound if there is none or it has expired.
+	GetResponse(ctx context.Context, owner, key string, response *SavedResponse) error
 	DbTx() interface{}
 }
@@ -0,0 +1,212 @@
+package todolist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// todo.txt (https://github.com/todotxt/todo.txt) serialisation. Priorities
+// (A) to (Z) map onto priorities 1 to 26; items outside that range are
+// written without a priority and so are appended in line order when read
+// back. The item id is kept in an id:key so that a file can be reconciled
+// with the database.
+
+const (
+	FormatTodoTxt    = "todotxt"
+	MediaTypeTodoTxt = "text/plain"
+
+	todoTxtDate = "2006-01-02"
+)
+
+var (
+	todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+	todoTxtKeyValue = regexp.MustCompile(`^([^\s:]+):([^\s:/][^\s]*)$`)
+)
+
+// todoTxtReservedKeys are key:value tags mapped onto item fields rather than
+// kept as attributes.
+var todoTxtReservedKeys = map[string]bool{"id": true, "due": true, "pri": true, "status": true}
+
+func todoTxtPriorityLetter(priority int) string {
+	if priority < 1 || priority > 26 {
+		return ""
+	}
+	return string(rune('A' + priority - 1))
+}
+
+// FormatTodoTxtLine renders a single item as a todo.txt line.
+func FormatTodoTxtLine(item *structs.TodoItem) string {
+	var parts []string
+	letter := todoTxtPriorityLetter(item.Priority)
+
+	if item.IsCompleted() {
+		parts = append(parts, "x")
+		if item.Completed_at != nil {
+			parts = append(parts, item.Completed_at.UTC().Format(todoTxtDate))
+			if !item.Created_at.IsZero() {
+				parts = append(parts, item.Created_at.UTC().Format(todoTxtDate))
+			}
+		}
+	} else {
+		if letter != "" {
+			parts = append(parts, "("+letter+")")
+		}
+		if !item.Created_at.IsZero() {
+			parts = append(parts, item.Created_at.UTC().Format(todoTxtDate))
+		}
+	}
+
+	parts = append(parts, strings.Join(strings.Fields(item.Item), " "))
+	for _, project := range item.Projects {
+		parts = append(parts, "+"+project)
+	}
+	for _, context := range item.Contexts {
+		parts = append(parts, "@"+context)
+	}
+
+	keys := make([]string, 0, len(item.Attributes))
+	for key := range item.Attributes {
+		if !todoTxtReservedKeys[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, key+":"+item.Attributes[key])
+	}
+
+	if item.Due != nil {
+		parts = append(parts, "due:"+item.Due.UTC().Format(todoTxtDate))
+	}
+	if item.IsCompleted() && letter != "" {
+		// completed tasks lose their (A) prefix, so keep it as a tag
+		parts = append(parts, "pri:"+letter)
+	}
+	if item.Status != "" && item.Status != structs.StatusNeedsAction && !item.IsCompleted() {
+		parts = append(parts, "status:"+item.Status)
+	}
+	if item.Id != "" {
+		parts = append(parts, "id:"+item.Id)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseTodoTxtLine parses a single todo.txt line. Blank lines yield nil.
+func ParseTodoTxtLine(line string) (*structs.TodoItem, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	item := &structs.TodoItem{}
+	parseDate := func() (*time.Time, bool) {
+		if len(fields) == 0 {
+			return nil, false
+		}
+		t, err := time.Parse(todoTxtDate, fields[0])
+		if err != nil {
+			return nil, false
+		}
+		fields = fields[1:]
+		return &t, true
+	}
+
+	if fields[0] == "x" {
+		item.Status = structs.StatusCompleted
+		fields = fields[1:]
+		if completed, ok := parseDate(); ok {
+			item.Completed_at = completed
+			if created, ok := parseDate(); ok {
+				item.Created_at = *created
+			}
+		}
+	} else {
+		if m := todoTxtPriority.FindStringSubmatch(fields[0]); m != nil {
+			item.Priority = int(m[1][0]-'A') + 1
+			fields = fields[1:]
+		}
+		if created, ok := parseDate(); ok {
+			item.Created_at = *created
+		}
+	}
+
+	var text []string
+	for _, field := range fields {
+		switch {
+		case len(field) > 1 && field[0] == '+':
+			item.Projects = append(item.Projects, field[1:])
+		case len(field) > 1 && field[0] == '@':
+			item.Contexts = append(item.Contexts, field[1:])
+		case todoTxtKeyValue.MatchString(field):
+			m := todoTxtKeyValue.FindStringSubmatch(field)
+			if err := applyTodoTxtTag(item, m[1], m[2]); err != nil {
+				return nil, err
+			}
+		default:
+			text = append(text, field)
+		}
+	}
+	item.Item = strings.Join(text, " ")
+	return item, nil
+}
+
+func applyTodoTxtTag(item *structs.TodoItem, key, value string) error {
+	switch key {
+	case "id":
+		item.Id = value
+	case "due":
+		due, err := time.Parse(todoTxtDate, value)
+		if err != nil {
+			return fmt.Errorf("todo.txt: invalid due date %q", value)
+		}
+		item.Due = &due
+	case "pri":
+		if len(value) == 1 && value[0] >= 'A' && value[0] <= 'Z' {
+			item.Priority = int(value[0]-'A') + 1
+		}
+	case "status":
+		if !item.IsCompleted() {
+			item.Status = value
+		}
+	default:
+		if item.Attributes == nil {
+			item.Attributes = make(map[string]string)
+		}
+		item.Attributes[key] = value
+	}
+	return nil
+}
+
+func encodeTodoTxt(w io.Writer, items []structs.TodoItem) error {
+	bw := bufio.NewWriter(w)
+	for i := range items {
+		if _, err := bw.WriteString(FormatTodoTxtLine(&items[i]) + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func decodeTodoTxt(r io.Reader) ([]structs.TodoItem, error) {
+	items := make([]structs.TodoItem, 0)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		item, err := ParseTodoTxtLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if item != nil {
+			items = append(items, *item)
+		}
+	}
+	return items, scanner.Err()
+}
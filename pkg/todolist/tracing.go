@@ -0,0 +1,95 @@
+package todolist
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+var tracer = otel.Tracer("go.altair.com/todolist/pkg/todolist")
+
+// tracedItemsService makes a span for each call to the service, around the
+// spans for the SQL statements it runs.
+type tracedItemsService struct {
+	*itemsServiceImpl
+}
+
+// startSpan starts the span for a service method. The returned function
+// ends it and returns err, after recording it on the span. Errors callers
+// are expected to handle, such as unknown ids, do not mark the span failed.
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, func(err error) error) {
+	ctx, span := tracer.Start(ctx, "ItemsService."+method, trace.WithAttributes(attrs...))
+	return ctx, func(err error) error {
+		if err != nil {
+			span.RecordError(err)
+			var invalid *structs.ValidationError
+			if !errors.Is(err, store.ErrNotFound) && !errors.Is(err, store.ErrConflict) &&
+				!errors.Is(err, ErrQuotaExceeded) && !errors.Is(err, ErrRequestInProgress) && !errors.As(err, &invalid) {
+				span.SetStatus(codes.Error, err.Error())
+			}
+		}
+		span.End()
+		return err
+	}
+}
+
+func itemId(id string) attribute.KeyValue {
+	return attribute.String("todolist.item.id", id)
+}
+
+func (s *tracedItemsService) AddItem(ctx context.Context, def *structs.TodoItem) error {
+	ctx, end := startSpan(ctx, "AddItem", itemId(def.Id))
+	return end(s.itemsServiceImpl.AddItem(ctx, def))
+}
+
+func (s *tracedItemsService) DeleteItem(ctx context.Context, id string) error {
+	ctx, end := startSpan(ctx, "DeleteItem", itemId(id))
+	return end(s.itemsServiceImpl.DeleteItem(ctx, id))
+}
+
+func (s *tracedItemsService) UpdateItem(ctx context.Context, def *structs.TodoItem) error {
+	ctx, end := startSpan(ctx, "UpdateItem", itemId(def.Id))
+	return end(s.itemsServiceImpl.UpdateItem(ctx, def))
+}
+
+func (s *tracedItemsService) GetItem(ctx context.Context, id string) (*structs.TodoItem, error) {
+	ctx, end := startSpan(ctx, "GetItem", itemId(id))
+	item, err := s.itemsServiceImpl.GetItem(ctx, id)
+	return item, end(err)
+}
+
+func (s *tracedItemsService) ListItems(ctx context.Context) (structs.TodoItemList, error) {
+	ctx, end := startSpan(ctx, "ListItems")
+	list, err := s.itemsServiceImpl.ListItems(ctx)
+	return list, end(err)
+}
+
+func (s *tracedItemsService) ImportItems(ctx context.Context, items []structs.TodoItem, opts structs.ImportOptions) (structs.ImportResult, error) {
+	ctx, end := startSpan(ctx, "ImportItems", attribute.Int("todolist.items", len(items)), attribute.Bool("todolist.dry_run", opts.DryRun))
+	result, err := s.itemsServiceImpl.ImportItems(ctx, items, opts)
+	return result, end(err)
+}
+
+func (s *tracedItemsService) MoveItem(ctx context.Context, id string, position int) error {
+	ctx, end := startSpan(ctx, "MoveItem", itemId(id), attribute.Int("todolist.position", position))
+	return end(s.itemsServiceImpl.MoveItem(ctx, id, position))
+}
+
+func (s *tracedItemsService) GetItems(ctx context.Context, ids []string) ([]structs.TodoItem, error) {
+	ctx, end := startSpan(ctx, "GetItems", attribute.Int("todolist.items", len(ids)))
+	items, err := s.itemsServiceImpl.GetItems(ctx, ids)
+	return items, end(err)
+}
+
+func (s *tracedItemsService) ItemHistory(ctx context.Context, ids []string) ([]structs.ItemEvent, error) {
+	ctx, end := startSpan(ctx, "ItemHistory", attribute.Int("todolist.items", len(ids)))
+	history, err := s.itemsServiceImpl.ItemHistory(ctx, ids)
+	return history, end(err)
+}
@@ -0,0 +1,5 @@
+// Package todolistpb holds the protobuf definition of the todolist gRPC API
+// and the code generated from it.
+package todolistpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative todolist.proto
@@ -0,0 +1,413 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: todolist.proto
+
+package todolistpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Todolist_AddItem_FullMethodName     = "/todolist.v1.Todolist/AddItem"
+	Todolist_DeleteItem_FullMethodName  = "/todolist.v1.Todolist/DeleteItem"
+	Todolist_UpdateItem_FullMethodName  = "/todolist.v1.Todolist/UpdateItem"
+	Todolist_GetItem_FullMethodName     = "/todolist.v1.Todolist/GetItem"
+	Todolist_ListItems_FullMethodName   = "/todolist.v1.Todolist/ListItems"
+	Todolist_ImportItems_FullMethodName = "/todolist.v1.Todolist/ImportItems"
+	Todolist_MoveItem_FullMethodName    = "/todolist.v1.Todolist/MoveItem"
+	Todolist_WatchItems_FullMethodName  = "/todolist.v1.Todolist/WatchItems"
+)
+
+// TodolistClient is the client API for Todolist service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Todolist mirrors the REST API and todolist.ItemsService.
+type TodolistClient interface {
+	AddItem(ctx context.Context, in *AddItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteItem(ctx context.Context, in *DeleteItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	UpdateItem(ctx context.Context, in *UpdateItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetItem(ctx context.Context, in *GetItemRequest, opts ...grpc.CallOption) (*TodoItem, error)
+	ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error)
+	ImportItems(ctx context.Context, in *ImportItemsRequest, opts ...grpc.CallOption) (*ImportItemsResponse, error)
+	// MoveItem places an item at a 1-based position in the list.
+	MoveItem(ctx context.Context, in *MoveItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// WatchItems streams changes to items until the client cancels.
+	WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (Todolist_WatchItemsClient, error)
+}
+
+type todolistClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTodolistClient(cc grpc.ClientConnInterface) TodolistClient {
+	return &todolistClient{cc}
+}
+
+func (c *todolistClient) AddItem(ctx context.Context, in *AddItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Todolist_AddItem_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todolistClient) DeleteItem(ctx context.Context, in *DeleteItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Todolist_DeleteItem_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todolistClient) UpdateItem(ctx context.Context, in *UpdateItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Todolist_UpdateItem_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todolistClient) GetItem(ctx context.Context, in *GetItemRequest, opts ...grpc.CallOption) (*TodoItem, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TodoItem)
+	err := c.cc.Invoke(ctx, Todolist_GetItem_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todolistClient) ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListItemsResponse)
+	err := c.cc.Invoke(ctx, Todolist_ListItems_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todolistClient) ImportItems(ctx context.Context, in *ImportItemsRequest, opts ...grpc.CallOption) (*ImportItemsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImportItemsResponse)
+	err := c.cc.Invoke(ctx, Todolist_ImportItems_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todolistClient) MoveItem(ctx context.Context, in *MoveItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Todolist_MoveItem_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todolistClient) WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (Todolist_WatchItemsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Todolist_ServiceDesc.Streams[0], Todolist_WatchItems_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todolistWatchItemsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Todolist_WatchItemsClient interface {
+	Recv() (*ItemEvent, error)
+	grpc.ClientStream
+}
+
+type todolistWatchItemsClient struct {
+	grpc.ClientStream
+}
+
+func (x *todolistWatchItemsClient) Recv() (*ItemEvent, error) {
+	m := new(ItemEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TodolistServer is the server API for Todolist service.
+// All implementations must embed UnimplementedTodolistServer
+// for forward compatibility
+//
+// Todolist mirrors the REST API and todolist.ItemsService.
+type TodolistServer interface {
+	AddItem(context.Context, *AddItemRequest) (*emptypb.Empty, error)
+	DeleteItem(context.Context, *DeleteItemRequest) (*emptypb.Empty, error)
+	UpdateItem(context.Context, *UpdateItemRequest) (*emptypb.Empty, error)
+	GetItem(context.Context, *GetItemRequest) (*TodoItem, error)
+	ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error)
+	ImportItems(context.Context, *ImportItemsRequest) (*ImportItemsResponse, error)
+	// MoveItem places an item at a 1-based position in the list.
+	MoveItem(context.Context, *MoveItemRequest) (*emptypb.Empty, error)
+	// WatchItems streams changes to items until the client cancels.
+	WatchItems(*WatchItemsRequest, Todolist_WatchItemsServer) error
+	mustEmbedUnimplementedTodolistServer()
+}
+
+// UnimplementedTodolistServer must be embedded to have forward compatible implementations.
+type UnimplementedTodolistServer struct {
+}
+
+func (UnimplementedTodolistServer) AddItem(context.Context, *AddItemRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddItem not implemented")
+}
+func (UnimplementedTodolistServer) DeleteItem(context.Context, *DeleteItemRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteItem not implemented")
+}
+func (UnimplementedTodolistServer) UpdateItem(context.Context, *UpdateItemRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateItem not implemented")
+}
+func (UnimplementedTodolistServer) GetItem(context.Context, *GetItemRequest) (*TodoItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetItem not implemented")
+}
+func (UnimplementedTodolistServer) ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListItems not implemented")
+}
+func (UnimplementedTodolistServer) ImportItems(context.Context, *ImportItemsRequest) (*ImportItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportItems not implemented")
+}
+func (UnimplementedTodolistServer) MoveItem(context.Context, *MoveItemRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MoveItem not implemented")
+}
+func (UnimplementedTodolistServer) WatchItems(*WatchItemsRequest, Todolist_WatchItemsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchItems not implemented")
+}
+func (UnimplementedTodolistServer) mustEmbedUnimplementedTodolistServer() {}
+
+// UnsafeTodolistServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TodolistServer will
+// result in compilation errors.
+type UnsafeTodolistServer interface {
+	mustEmbedUnimplementedTodolistServer()
+}
+
+func RegisterTodolistServer(s grpc.ServiceRegistrar, srv TodolistServer) {
+	s.RegisterService(&Todolist_ServiceDesc, srv)
+}
+
+func _Todolist_AddItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodolistServer).AddItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todolist_AddItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodolistServer).AddItem(ctx, req.(*AddItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todolist_DeleteItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodolistServer).DeleteItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todolist_DeleteItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodolistServer).DeleteItem(ctx, req.(*DeleteItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todolist_UpdateItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodolistServer).UpdateItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todolist_UpdateItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodolistServer).UpdateItem(ctx, req.(*UpdateItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todolist_GetItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodolistServer).GetItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todolist_GetItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodolistServer).GetItem(ctx, req.(*GetItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todolist_ListItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodolistServer).ListItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todolist_ListItems_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodolistServer).ListItems(ctx, req.(*ListItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todolist_ImportItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodolistServer).ImportItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todolist_ImportItems_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodolistServer).ImportItems(ctx, req.(*ImportItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todolist_MoveItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodolistServer).MoveItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todolist_MoveItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodolistServer).MoveItem(ctx, req.(*MoveItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todolist_WatchItems_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchItemsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodolistServer).WatchItems(m, &todolistWatchItemsServer{ServerStream: stream})
+}
+
+type Todolist_WatchItemsServer interface {
+	Send(*ItemEvent) error
+	grpc.ServerStream
+}
+
+type todolistWatchItemsServer struct {
+	grpc.ServerStream
+}
+
+func (x *todolistWatchItemsServer) Send(m *ItemEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Todolist_ServiceDesc is the grpc.ServiceDesc for Todolist service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Todolist_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "todolist.v1.Todolist",
+	HandlerType: (*TodolistServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddItem",
+			Handler:    _Todolist_AddItem_Handler,
+		},
+		{
+			MethodName: "DeleteItem",
+			Handler:    _Todolist_DeleteItem_Handler,
+		},
+		{
+			MethodName: "UpdateItem",
+			Handler:    _Todolist_UpdateItem_Handler,
+		},
+		{
+			MethodName: "GetItem",
+			Handler:    _Todolist_GetItem_Handler,
+		},
+		{
+			MethodName: "ListItems",
+			Handler:    _Todolist_ListItems_Handler,
+		},
+		{
+			MethodName: "ImportItems",
+			Handler:    _Todolist_ImportItems_Handler,
+		},
+		{
+			MethodName: "MoveItem",
+			Handler:    _Todolist_MoveItem_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchItems",
+			Handler:       _Todolist_WatchItems_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "todolist.proto",
+}